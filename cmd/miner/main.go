@@ -2,8 +2,10 @@ package main
 
 import (
 	"blockchain-node/pkg/blockchain"
+	"blockchain-node/pkg/mining"
 	"blockchain-node/pkg/wallet"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -22,6 +24,7 @@ type Miner struct {
 	mining     bool
 	stopChan   chan bool
 	difficulty uint32
+	solver     *blockchain.Miner // Searches for proof of work on every CPU
 }
 
 // MiningResult represents the result of mining operation
@@ -40,8 +43,8 @@ type NodeInfo struct {
 	LastHash   string `json:"last_hash"`
 }
 
-// NewMiner creates a new miner instance
-func NewMiner(nodeURL string, walletFile string) (*Miner, error) {
+// NewMiner creates a new miner instance; a new wallet gets an address for the given network
+func NewMiner(nodeURL string, walletFile string, params *blockchain.ChainParams) (*Miner, error) {
 	var minerWallet *wallet.Wallet
 	var err error
 	
@@ -54,7 +57,7 @@ func NewMiner(nodeURL string, walletFile string) (*Miner, error) {
 		}
 	} else {
 		fmt.Println("Creating new miner wallet...")
-		minerWallet, err = wallet.NewWallet()
+		minerWallet, err = wallet.NewWalletWithVersion(params.AddressVersion)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create wallet: %v", err)
 		}
@@ -77,7 +80,8 @@ func NewMiner(nodeURL string, walletFile string) (*Miner, error) {
 		wallet:     minerWallet,
 		mining:     false,
 		stopChan:   make(chan bool),
-		difficulty: 4, // Default difficulty
+		difficulty: params.GenesisBits,
+		solver:     blockchain.NewMiner(0),
 	}, nil
 }
 
@@ -139,32 +143,50 @@ func (m *Miner) mineBlock() MiningResult {
 		}
 	}
 	
-	fmt.Printf("Current blockchain height: %d, difficulty: %d\n", nodeInfo.Height, nodeInfo.Difficulty)
+	fmt.Printf("Current blockchain height: %d, difficulty: %08x\n", nodeInfo.Height, nodeInfo.Difficulty)
 	
-	// Mine a block via API
-	resp, err := http.Post(m.nodeURL+"/api/v1/blocks/mine", "application/json", nil)
+	// Fetch a block of pending transactions paying this miner, search for its
+	// proof of work locally and hand the solved block back to the node
+	template, err := m.getBlockTemplate()
 	if err != nil {
 		return MiningResult{
 			Success: false,
-			Error:   fmt.Sprintf("mining request failed: %v", err),
+			Error:   fmt.Sprintf("failed to get block template: %v", err),
 		}
 	}
-	defer resp.Body.Close()
 	
-	if resp.StatusCode != http.StatusOK {
-		body, _ := ioutil.ReadAll(resp.Body)
+	block := template.Block
+	fmt.Printf("Mining block %d with %d transactions paying %d in fees\n", block.Header.Height, len(template.Transactions), template.Fees)
+	
+	if err := m.solver.Solve(context.Background(), block); err != nil {
+		return MiningResult{
+			Success: false,
+			Error:   fmt.Sprintf("proof of work search failed: %v", err),
+		}
+	}
+	
+	data, err := json.Marshal(block)
+	if err != nil {
 		return MiningResult{
 			Success: false,
-			Error:   fmt.Sprintf("mining failed with status %d: %s", resp.StatusCode, string(body)),
+			Error:   fmt.Sprintf("failed to encode block: %v", err),
 		}
 	}
 	
-	// Parse the response to get block info
-	var block blockchain.Block
-	if err := json.NewDecoder(resp.Body).Decode(&block); err != nil {
+	resp, err := http.Post(m.nodeURL+"/api/v1/blockchain/blocks", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return MiningResult{
+			Success: false,
+			Error:   fmt.Sprintf("block submission failed: %v", err),
+		}
+	}
+	defer resp.Body.Close()
+	
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
 		return MiningResult{
 			Success: false,
-			Error:   fmt.Sprintf("failed to decode mining response: %v", err),
+			Error:   fmt.Sprintf("block rejected with status %d: %s", resp.StatusCode, string(body)),
 		}
 	}
 	
@@ -182,6 +204,30 @@ func (m *Miner) mineBlock() MiningResult {
 	}
 }
 
+// getBlockTemplate retrieves a block to mine whose coinbase pays the miner wallet
+func (m *Miner) getBlockTemplate() (*mining.BlockTemplate, error) {
+	resp, err := http.Get(fmt.Sprintf("%s/api/v1/blocks/template?address=%s", m.nodeURL, m.wallet.GetAddress()))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("template request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	
+	var template mining.BlockTemplate
+	if err := json.NewDecoder(resp.Body).Decode(&template); err != nil {
+		return nil, err
+	}
+	if template.Block == nil || len(template.Block.Transactions) == 0 {
+		return nil, fmt.Errorf("template has no block")
+	}
+	
+	return &template, nil
+}
+
 // getNodeInfo retrieves current node information
 func (m *Miner) getNodeInfo() (*NodeInfo, error) {
 	resp, err := http.Get(m.nodeURL + "/api/v1/info")
@@ -248,7 +294,7 @@ func (m *Miner) ShowStats() {
 	fmt.Printf("Miner Address: %s\n", m.wallet.GetAddress())
 	fmt.Printf("Current Balance: %d satoshis (%.8f coins)\n", balance, float64(balance)/100000000)
 	fmt.Printf("Blockchain Height: %d\n", nodeInfo.Height)
-	fmt.Printf("Current Difficulty: %d\n", nodeInfo.Difficulty)
+	fmt.Printf("Current Difficulty: %08x (%.2f)\n", nodeInfo.Difficulty, blockchain.CalcDifficultyRatio(nodeInfo.Difficulty))
 	fmt.Printf("Mining Status: %v\n", m.mining)
 	fmt.Println("========================")
 }
@@ -268,6 +314,7 @@ func displayHelp() {
 	fmt.Println("  -node <url>        Node URL (default: http://localhost:8080)")
 	fmt.Println("  -wallet <file>     Wallet file (default: miner.wallet)")
 	fmt.Println("  -interval <time>   Mining interval (default: 10s)")
+	fmt.Println("  -network <name>    Network: mainnet, testnet or regtest (default: mainnet)")
 	fmt.Println("  -stats             Show statistics and exit")
 	fmt.Println("  -help              Show this help")
 	fmt.Println()
@@ -277,6 +324,7 @@ func displayHelp() {
 	fmt.Println("  miner -interval 30s                     # Mine every 30 seconds")
 	fmt.Println("  miner -node http://192.168.1.100:8080   # Connect to remote node")
 	fmt.Println("  miner -stats                             # Show current stats")
+	fmt.Println("  miner -network regtest                  # Mine on a regtest node")
 }
 
 func main() {
@@ -284,6 +332,7 @@ func main() {
 	nodeURL := "http://localhost:8080"
 	walletFile := "miner.wallet"
 	interval := 10 * time.Second
+	network := "mainnet"
 	showStats := false
 	
 	// Parse command line arguments
@@ -310,6 +359,11 @@ func main() {
 				}
 				i++
 			}
+		case "-network":
+			if i+1 < len(args) {
+				network = args[i+1]
+				i++
+			}
 		case "-stats":
 			showStats = true
 		case "-help":
@@ -322,8 +376,13 @@ func main() {
 		}
 	}
 	
+	params, err := blockchain.ParamsForNetwork(network)
+	if err != nil {
+		log.Fatalf("Invalid network: %v", err)
+	}
+	
 	// Create miner
-	miner, err := NewMiner(nodeURL, walletFile)
+	miner, err := NewMiner(nodeURL, walletFile, params)
 	if err != nil {
 		log.Fatalf("Failed to create miner: %v", err)
 	}
@@ -2,12 +2,19 @@ package main
 
 import (
 	"blockchain-node/pkg/blockchain"
+	"blockchain-node/pkg/mempool"
+	"blockchain-node/pkg/mining"
 	"blockchain-node/pkg/storage"
 	"blockchain-node/pkg/wallet"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
@@ -17,23 +24,55 @@ import (
 // Node represents a blockchain node
 type Node struct {
 	blockchain *blockchain.Blockchain
+	mempool    *mempool.Mempool
+	generator  *mining.Generator
 	storage    storage.Storage
 	wallet     *wallet.Wallet
+	miner      *blockchain.Miner
 }
 
 // NodeInfo represents node information for API responses
 type NodeInfo struct {
-	Height     int64  `json:"height"`
-	Difficulty uint32 `json:"difficulty"`
-	LastHash   string `json:"last_hash"`
-	NodeWallet string `json:"node_wallet"`
+	Network        string  `json:"network"`
+	Height         int64   `json:"height"`
+	Difficulty     uint32  `json:"difficulty"`
+	LastHash       string  `json:"last_hash"`
+	MedianTimePast int64   `json:"median_time_past"`
+	NodeWallet     string  `json:"node_wallet"`
+	Orphans        int     `json:"orphans"`
+	Mempool        int     `json:"mempool"` // Transactions waiting to be mined
+	MiningThreads  int     `json:"mining_threads"`
+	HashRate       float64 `json:"hash_rate"` // Hashes per second of the last proof of work search
 }
 
 // TransactionRequest represents a transaction request
 type TransactionRequest struct {
-	From   string `json:"from"`
-	To     string `json:"to"`
-	Amount int64  `json:"amount"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Amount  int64  `json:"amount"`
+	Fee     int64  `json:"fee,omitempty"`      // Absolute fee in satoshis
+	FeeRate int64  `json:"fee_rate,omitempty"` // Fee in satoshis per byte
+}
+
+// MultiSigRequest represents a multisig address creation request
+type MultiSigRequest struct {
+	Required   int      `json:"required"`
+	PublicKeys []string `json:"public_keys"`
+}
+
+// MultiSigTransactionRequest represents a request for an unsigned spend from a multisig address
+type MultiSigTransactionRequest struct {
+	RedeemScript blockchain.Script `json:"redeem_script"`
+	To           string            `json:"to"`
+	Amount       int64             `json:"amount"`
+	Fee          int64             `json:"fee,omitempty"`
+	FeeRate      int64             `json:"fee_rate,omitempty"`
+}
+
+// ErrorResponse represents an error returned for a rejected block or transaction
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
 }
 
 // NewNode creates a new blockchain node
@@ -44,11 +83,25 @@ func NewNode() (*Node, error) {
 		return nil, fmt.Errorf("failed to initialize storage: %v", err)
 	}
 	
+	params, err := loadChainParams()
+	if err != nil {
+		return nil, err
+	}
+	
 	// Create blockchain
-	bc := blockchain.NewBlockchain()
+	bc, err := blockchain.NewBlockchainWithParams(params)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Reconnect blocks kept by a previous run. Signature checks are skipped
+	// up to the assume-valid block, so a restart does not re-verify them
+	if err := bc.ImportBlocks(loadStoredBlocks(store)); err != nil {
+		return nil, fmt.Errorf("failed to load stored blocks: %v", err)
+	}
 	
 	// Create node wallet for mining rewards
-	nodeWallet, err := wallet.NewWallet()
+	nodeWallet, err := wallet.NewWalletWithVersion(params.AddressVersion)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create node wallet: %v", err)
 	}
@@ -60,17 +113,130 @@ func NewNode() (*Node, error) {
 		log.Printf("Warning: failed to save genesis block to storage: %v", err)
 	}
 	
+	fmt.Printf("Network: %s, genesis: %s\n", params.Name, genesisBlock.Header.Hash)
 	fmt.Printf("Node wallet address: %s\n", nodeWallet.GetAddress())
 	
-	return &Node{
+	// Search for proof of work on MINING_THREADS goroutines, one per CPU by default
+	threads := 0
+	if value := os.Getenv("MINING_THREADS"); value != "" {
+		if threads, err = strconv.Atoi(value); err != nil || threads < 0 {
+			log.Printf("Warning: ignoring invalid MINING_THREADS %q", value)
+			threads = 0
+		}
+	}
+	
+	pool := mempool.New(bc, mempool.DefaultConfig())
+	
+	node := &Node{
 		blockchain: bc,
+		mempool:    pool,
+		generator:  mining.NewGenerator(bc, pool),
 		storage:    store,
 		wallet:     nodeWallet,
-	}, nil
+		miner:      blockchain.NewMiner(threads),
+	}
+	
+	// Keep the active chain in storage for the next start to import
+	bc.Subscribe(node.storeChainChange)
+	
+	return node, nil
+}
+
+// storeChainChange saves blocks connected to the active chain and deletes
+// those a reorganization disconnects, so storage holds the active chain by
+// height
+func (n *Node) storeChainChange(notification blockchain.Notification) {
+	block := notification.Block
+	
+	var err error
+	switch notification.Type {
+	case blockchain.NTBlockConnected:
+		err = n.storage.SaveBlock(block)
+	case blockchain.NTBlockDisconnected:
+		err = n.storage.DeleteBlock(block.Header.Hash)
+	}
+	if err != nil {
+		log.Printf("Warning: failed to store %s of block %d (%s): %v", notification.Type, block.Header.Height, block.Header.Hash, err)
+	}
+}
+
+// loadChainParams selects the network named by NETWORK (mainnet by default) and
+// applies consensus overrides from the environment to its parameters
+func loadChainParams() (*blockchain.ChainParams, error) {
+	network := os.Getenv("NETWORK")
+	if network == "" {
+		network = "mainnet"
+	}
+	
+	params, err := blockchain.ParamsForNetwork(network)
+	if err != nil {
+		return nil, err
+	}
+	
+	if blockTime := os.Getenv("BLOCK_TIME"); blockTime != "" {
+		if seconds, err := strconv.Atoi(blockTime); err == nil && seconds > 0 {
+			params.TargetSpacing = time.Duration(seconds) * time.Second
+		} else {
+			log.Printf("Warning: ignoring invalid BLOCK_TIME %q", blockTime)
+		}
+	}
+	
+	if window := os.Getenv("RETARGET_WINDOW"); window != "" {
+		if blocks, err := strconv.ParseInt(window, 10, 64); err == nil && blocks > 0 {
+			params.RetargetWindow = blocks
+		} else {
+			log.Printf("Warning: ignoring invalid RETARGET_WINDOW %q", window)
+		}
+	}
+	
+	if drift := os.Getenv("MAX_FUTURE_BLOCK_TIME"); drift != "" {
+		if seconds, err := strconv.Atoi(drift); err == nil && seconds >= 0 {
+			params.MaxFutureBlockTime = time.Duration(seconds) * time.Second
+		} else {
+			log.Printf("Warning: ignoring invalid MAX_FUTURE_BLOCK_TIME %q", drift)
+		}
+	}
+	
+	if maturity := os.Getenv("COINBASE_MATURITY"); maturity != "" {
+		if blocks, err := strconv.ParseInt(maturity, 10, 64); err == nil && blocks >= 0 {
+			params.CoinbaseMaturity = blocks
+		} else {
+			log.Printf("Warning: ignoring invalid COINBASE_MATURITY %q", maturity)
+		}
+	}
+	
+	if assumeValid := os.Getenv("ASSUME_VALID"); assumeValid != "" {
+		params.AssumeValid = assumeValid
+	}
+	
+	return params, nil
+}
+
+// loadStoredBlocks returns the stored blocks above genesis in height order,
+// stopping at the first gap
+func loadStoredBlocks(store storage.Storage) []*blockchain.Block {
+	var blocks []*blockchain.Block
+	for height := int64(1); ; height++ {
+		block, err := store.GetBlockByHeight(height)
+		if err != nil {
+			return blocks
+		}
+		blocks = append(blocks, block)
+	}
 }
 
 // Start starts the blockchain node server
 func (n *Node) Start(port string) error {
+	router := n.router()
+	
+	fmt.Printf("Starting blockchain node on port %s\n", port)
+	fmt.Printf("API endpoints available at http://localhost:%s/api/v1/\n", port)
+	
+	return http.ListenAndServe(":"+port, router)
+}
+
+// router returns the node's API routes
+func (n *Node) router() *mux.Router {
 	router := mux.NewRouter()
 	
 	// API routes
@@ -81,25 +247,39 @@ func (n *Node) Start(port string) error {
 	
 	// Blockchain routes
 	api.HandleFunc("/blocks", n.handleGetBlocks).Methods("GET")
+	api.HandleFunc("/blocks", n.handleSubmitBlock).Methods("POST")
 	api.HandleFunc("/blocks/{height:[0-9]+}", n.handleGetBlock).Methods("GET")
 	api.HandleFunc("/blocks/latest", n.handleGetLatestBlock).Methods("GET")
 	api.HandleFunc("/blocks/mine", n.handleMineBlock).Methods("POST")
+	api.HandleFunc("/blocks/template", n.handleGetBlockTemplate).Methods("GET")
+	
+	// Blockchain routes under the paths the API server serves them at
+	chain := api.PathPrefix("/blockchain").Subrouter()
+	chain.HandleFunc("/blocks", n.handleGetBlocks).Methods("GET")
+	chain.HandleFunc("/blocks", n.handleSubmitBlock).Methods("POST")
+	chain.HandleFunc("/transactions/{txid}/proof", n.handleGetTransactionProof).Methods("GET")
 	
 	// Transaction routes
 	api.HandleFunc("/transactions", n.handleCreateTransaction).Methods("POST")
+	api.HandleFunc("/transactions/submit", n.handleSubmitTransaction).Methods("POST")
 	api.HandleFunc("/transactions/{txid}", n.handleGetTransaction).Methods("GET")
+	api.HandleFunc("/transactions/{txid}/proof", n.handleGetTransactionProof).Methods("GET")
+	
+	// Mempool routes
+	api.HandleFunc("/mempool", n.handleGetMempool).Methods("GET")
 	
 	// Wallet routes
 	api.HandleFunc("/wallet/balance/{address}", n.handleGetBalance).Methods("GET")
+	api.HandleFunc("/wallet/utxos/{address}", n.handleGetUTXOs).Methods("GET")
 	api.HandleFunc("/wallet/new", n.handleCreateWallet).Methods("POST")
+	api.HandleFunc("/wallet/multisig", n.handleCreateMultiSig).Methods("POST")
+	api.HandleFunc("/wallet/multisig/transaction", n.handleCreateMultiSigTransaction).Methods("POST")
+	api.HandleFunc("/wallet/multisig/submit", n.handleSubmitMultiSigTransaction).Methods("POST")
 	
 	// Add CORS middleware
 	router.Use(corsMiddleware)
 	
-	fmt.Printf("Starting blockchain node on port %s\n", port)
-	fmt.Printf("API endpoints available at http://localhost:%s/api/v1/\n", port)
-	
-	return http.ListenAndServe(":"+port, router)
+	return router
 }
 
 // handleNodeInfo returns node information
@@ -107,10 +287,16 @@ func (n *Node) handleNodeInfo(w http.ResponseWriter, r *http.Request) {
 	latestBlock := n.blockchain.GetLatestBlock()
 	
 	info := NodeInfo{
-		Height:     n.blockchain.GetHeight(),
-		Difficulty: n.blockchain.GetDifficulty(),
-		LastHash:   latestBlock.Header.Hash,
-		NodeWallet: n.wallet.GetAddress(),
+		Network:        n.blockchain.Params().Name,
+		Height:         n.blockchain.GetHeight(),
+		Difficulty:     n.blockchain.GetDifficulty(),
+		LastHash:       latestBlock.Header.Hash,
+		MedianTimePast: n.blockchain.GetMedianTimePast(),
+		NodeWallet:     n.wallet.GetAddress(),
+		Orphans:        n.blockchain.OrphanCount(),
+		Mempool:        n.mempool.Count(),
+		MiningThreads:  n.miner.Workers(),
+		HashRate:       n.miner.Stats().HashRate,
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
@@ -154,20 +340,15 @@ func (n *Node) handleGetLatestBlock(w http.ResponseWriter, r *http.Request) {
 
 // handleMineBlock mines a new block
 func (n *Node) handleMineBlock(w http.ResponseWriter, r *http.Request) {
-	// Create coinbase transaction (mining reward)
-	reward := int64(5000000000) // 50 coins * 100000000 satoshis
-	coinbase := blockchain.NewCoinbaseTransaction(n.wallet.GetAddress(), reward)
-	
-	// Add block to blockchain
-	err := n.blockchain.AddBlock([]blockchain.Transaction{*coinbase})
+	// Mine a block of the best-paying pending transactions whose coinbase pays
+	// the block subsidy and their fees to the node wallet, giving up if the
+	// client goes away
+	latestBlock, err := n.generator.Mine(r.Context(), n.miner, n.wallet.GetAddress())
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to mine block: %v", err), http.StatusInternalServerError)
+		writeChainError(w, "Failed to mine block", err)
 		return
 	}
 	
-	// Get the newly mined block
-	latestBlock := n.blockchain.GetLatestBlock()
-	
 	// Update wallet balance
 	n.wallet.UpdateBalance(n.blockchain)
 	
@@ -177,7 +358,78 @@ func (n *Node) handleMineBlock(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(latestBlock)
 }
 
-// handleCreateTransaction creates a new transaction
+// handleGetBlockTemplate returns an unsolved block of the best-paying pending
+// transactions whose coinbase pays the miner's address, for external miners
+// to search for proof of work and submit to /blocks
+func (n *Node) handleGetBlockTemplate(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if !n.blockchain.Params().IsValidAddress(address) {
+		http.Error(w, fmt.Sprintf("Invalid %s address: %q", n.blockchain.Params().Name, address), http.StatusBadRequest)
+		return
+	}
+	
+	template, err := n.generator.NewBlockTemplate(address)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to build block template: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+// maxBlockBodySize bounds a submitted block's request body. JSON spells out
+// field names and hex, so it allows several times the binary size limit
+const maxBlockBodySize = 4 * blockchain.MaxBlockSize
+
+// handleSubmitBlock accepts a fully mined block from an external miner or peer,
+// as JSON or in the binary wire format when sent as application/octet-stream
+func (n *Node) handleSubmitBlock(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBlockBodySize)
+	
+	var block *blockchain.Block
+	var err error
+	if r.Header.Get("Content-Type") == "application/octet-stream" {
+		var data []byte
+		if data, err = io.ReadAll(r.Body); err == nil {
+			block, err = blockchain.DeserializeBlockBinary(data)
+		}
+	} else {
+		block = &blockchain.Block{}
+		err = json.NewDecoder(r.Body).Decode(block)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid block body: %v", err), http.StatusBadRequest)
+		return
+	}
+	
+	isOrphan, err := n.blockchain.ProcessBlock(block, requestSource(r))
+	if err != nil {
+		writeChainError(w, "Block rejected", err)
+		return
+	}
+	
+	if isOrphan {
+		// Held until its parent arrives; tell the sender which block is missing
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":        "orphan",
+			"hash":          block.Header.Hash,
+			"missing_block": n.blockchain.OrphanRoot(block.Header.Hash),
+		})
+		return
+	}
+	
+	n.wallet.UpdateBalance(n.blockchain)
+	
+	fmt.Printf("Block accepted! Height: %d, Hash: %s\n", block.Header.Height, block.Header.Hash)
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(block)
+}
+
+// handleCreateTransaction sends coins from the node wallet, signing them
 func (n *Node) handleCreateTransaction(w http.ResponseWriter, r *http.Request) {
 	var req TransactionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -186,28 +438,81 @@ func (n *Node) handleCreateTransaction(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Validate input
-	if req.From == "" || req.To == "" || req.Amount <= 0 {
+	if req.From == "" || req.To == "" || req.Amount <= 0 || req.Fee < 0 || req.FeeRate < 0 {
 		http.Error(w, "Invalid transaction parameters", http.StatusBadRequest)
 		return
 	}
 	
-	// Create transaction
-	tx, err := n.blockchain.CreateTransaction(req.From, req.To, req.Amount)
+	if !n.blockchain.Params().IsValidAddress(req.To) {
+		http.Error(w, fmt.Sprintf("Invalid %s address: %s", n.blockchain.Params().Name, req.To), http.StatusBadRequest)
+		return
+	}
+	
+	// The node can only sign for its own wallet; anyone else signs their
+	// transaction and submits it
+	if req.From != n.wallet.GetAddress() {
+		http.Error(w, "Can only send from the node wallet; sign the transaction and POST it to /api/v1/transactions/submit", http.StatusBadRequest)
+		return
+	}
+	
+	tx, err := n.wallet.CreateTransaction(req.To, req.Amount, req.Fee, req.FeeRate, n.blockchain, n.mempool)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create transaction: %v", err), http.StatusBadRequest)
 		return
 	}
 	
-	// In a real implementation, you'd add this to a mempool
-	// For now, we'll immediately add it to a new block
-	err = n.blockchain.AddBlock([]blockchain.Transaction{*tx})
+	n.acceptTransaction(w, tx)
+}
+
+// handleSubmitTransaction accepts a transaction signed elsewhere, such as by the
+// wallet CLI, into the mempool
+func (n *Node) handleSubmitTransaction(w http.ResponseWriter, r *http.Request) {
+	var tx blockchain.Transaction
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	
+	if err := tx.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid transaction: %v", err), http.StatusBadRequest)
+		return
+	}
+	
+	n.acceptTransaction(w, &tx)
+}
+
+// acceptTransaction adds a transaction to the mempool, where it waits to be
+// mined, and reports what the pool accepted
+func (n *Node) acceptTransaction(w http.ResponseWriter, tx *blockchain.Transaction) {
+	desc, err := n.mempool.AddTransaction(tx)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to add transaction to blockchain: %v", err), http.StatusInternalServerError)
+		writeChainError(w, "Transaction rejected", err)
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(tx)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       tx.ID,
+		"fee":      desc.Fee,
+		"size":     desc.Size,
+		"fee_rate": desc.FeeRate(),
+		"status":   "pending",
+	})
+}
+
+// handleGetMempool lists the transactions waiting to be mined, highest fee rate first
+func (n *Node) handleGetMempool(w http.ResponseWriter, r *http.Request) {
+	descs := n.mempool.TxDescs()
+	
+	response := map[string]interface{}{
+		"count":        len(descs),
+		"size":         n.mempool.Size(),
+		"transactions": descs,
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
 // handleGetTransaction returns a specific transaction
@@ -215,14 +520,29 @@ func (n *Node) handleGetTransaction(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	txID := vars["txid"]
 	
-	tx, err := n.blockchain.GetTransactionByID(txID)
+	details, err := n.blockchain.GetTransactionDetails(txID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(tx)
+	json.NewEncoder(w).Encode(details)
+}
+
+// handleGetTransactionProof returns a merkle proof that a transaction is in its block
+func (n *Node) handleGetTransactionProof(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	txID := vars["txid"]
+	
+	proof, err := n.blockchain.GetTransactionProof(txID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(proof)
 }
 
 // handleGetBalance returns the balance for an address
@@ -230,11 +550,39 @@ func (n *Node) handleGetBalance(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	address := vars["address"]
 	
-	balance := n.blockchain.GetBalance(address)
+	balance := n.blockchain.GetBalanceDetails(address)
 	
 	response := map[string]interface{}{
-		"address": address,
-		"balance": balance,
+		"address":           address,
+		"balance":           balance.Total,
+		"spendable_balance": balance.Spendable,
+		"mature_balance":    balance.Mature,
+		"immature_balance":  balance.Immature,
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleGetUTXOs returns the outputs an address can spend now, leaving out those
+// already spent by mempool transactions, for clients that build and sign
+// transactions themselves
+func (n *Node) handleGetUTXOs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	address := vars["address"]
+	
+	utxos := []blockchain.UTXO{}
+	var totalValue int64
+	for _, utxo := range n.blockchain.FindAvailableUTXO(address, n.mempool) {
+		utxos = append(utxos, utxo)
+		totalValue += utxo.Value
+	}
+	
+	response := map[string]interface{}{
+		"address":     address,
+		"utxos":       utxos,
+		"count":       len(utxos),
+		"total_value": totalValue,
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
@@ -243,7 +591,7 @@ func (n *Node) handleGetBalance(w http.ResponseWriter, r *http.Request) {
 
 // handleCreateWallet creates a new wallet
 func (n *Node) handleCreateWallet(w http.ResponseWriter, r *http.Request) {
-	newWallet, err := wallet.NewWallet()
+	newWallet, err := wallet.NewWalletWithVersion(n.blockchain.Params().AddressVersion)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create wallet: %v", err), http.StatusInternalServerError)
 		return
@@ -259,6 +607,109 @@ func (n *Node) handleCreateWallet(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// handleCreateMultiSig creates an M-of-N multisig address from co-signers' public keys
+func (n *Node) handleCreateMultiSig(w http.ResponseWriter, r *http.Request) {
+	var req MultiSigRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	
+	ms, err := wallet.NewMultiSig(req.Required, req.PublicKeys, n.blockchain.Params().ScriptAddressVersion)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid multisig: %v", err), http.StatusBadRequest)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ms)
+}
+
+// handleCreateMultiSigTransaction builds an unsigned spend from a multisig address for its co-signers to sign
+func (n *Node) handleCreateMultiSigTransaction(w http.ResponseWriter, r *http.Request) {
+	var req MultiSigTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	
+	if req.To == "" || req.Amount <= 0 || req.Fee < 0 || req.FeeRate < 0 {
+		http.Error(w, "Invalid transaction parameters", http.StatusBadRequest)
+		return
+	}
+	
+	if !n.blockchain.Params().IsValidAddress(req.To) {
+		http.Error(w, fmt.Sprintf("Invalid %s address: %s", n.blockchain.Params().Name, req.To), http.StatusBadRequest)
+		return
+	}
+	
+	ms, err := wallet.MultiSigFromRedeemScript(req.RedeemScript, n.blockchain.Params().ScriptAddressVersion)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid redeem script: %v", err), http.StatusBadRequest)
+		return
+	}
+	
+	mtx, err := wallet.NewMultiSigTransaction(ms, n.blockchain.FindAvailableUTXO(ms.Address, n.mempool), req.To, req.Amount, req.Fee, req.FeeRate)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create transaction: %v", err), http.StatusBadRequest)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mtx)
+}
+
+// handleSubmitMultiSigTransaction finalizes a multisig transaction once enough co-signers have signed and submits it to the mempool
+func (n *Node) handleSubmitMultiSigTransaction(w http.ResponseWriter, r *http.Request) {
+	var mtx wallet.MultiSigTransaction
+	if err := json.NewDecoder(r.Body).Decode(&mtx); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	
+	tx, err := mtx.Finalize()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to finalize transaction: %v", err), http.StatusBadRequest)
+		return
+	}
+	
+	n.acceptTransaction(w, tx)
+}
+
+// requestSource identifies the client that sent a request by its host, so that
+// per-source limits are not evaded by opening new connections
+func requestSource(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// writeChainError reports consensus rule and policy violations as 400 with their
+// rule code or policy reason, and anything else as an internal error
+func writeChainError(w http.ResponseWriter, message string, err error) {
+	var code string
+	var ruleErr blockchain.RuleError
+	var policyErr blockchain.PolicyError
+	switch {
+	case errors.As(err, &ruleErr):
+		code = ruleErr.Code.String()
+	case errors.As(err, &policyErr):
+		code = policyErr.Reason
+	default:
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error: fmt.Sprintf("%s: %v", message, err),
+		Code:  code,
+	})
+}
+
 // corsMiddleware adds CORS headers
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -288,16 +739,12 @@ func main() {
 		for {
 			time.Sleep(30 * time.Second)
 			
-			// Create coinbase transaction
-			reward := int64(5000000000) // 50 coins
-			coinbase := blockchain.NewCoinbaseTransaction(node.wallet.GetAddress(), reward)
-			
-			// Mine block
-			err := node.blockchain.AddBlock([]blockchain.Transaction{*coinbase})
+			// Mine pending transactions, paying the block subsidy and their fees to the node wallet
+			_, err := node.generator.Mine(context.Background(), node.miner, node.wallet.GetAddress())
 			if err != nil {
 				log.Printf("Auto-mining failed: %v", err)
 			} else {
-				fmt.Printf("Auto-mined block at height: %d\n", node.blockchain.GetHeight())
+				fmt.Printf("Auto-mined block at height: %d (%.0f hashes/s)\n", node.blockchain.GetHeight(), node.miner.Stats().HashRate)
 			}
 		}
 	}()
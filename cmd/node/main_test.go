@@ -0,0 +1,265 @@
+package main
+
+import (
+	"blockchain-node/internal/testutil"
+	"blockchain-node/pkg/blockchain"
+	"blockchain-node/pkg/mempool"
+	"blockchain-node/pkg/storage"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestSource(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"10.0.0.1:5000", "10.0.0.1"},
+		{"10.0.0.1:5001", "10.0.0.1"},
+		{"[::1]:8080", "::1"},
+		{"10.0.0.1", "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/blocks", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if got := requestSource(r); got != tt.want {
+			t.Errorf("requestSource(%q) = %q, want %q", tt.remoteAddr, got, tt.want)
+		}
+	}
+}
+
+func TestHandleSubmitBlockChargesOrphansToRemoteHost(t *testing.T) {
+	params := blockchain.RegTestParams
+	bc, err := blockchain.NewBlockchainWithParams(&params)
+	if err != nil {
+		t.Fatalf("NewBlockchainWithParams: %v", err)
+	}
+	n := &Node{blockchain: bc}
+
+	// submit posts a block on an unknown parent, distinct for each i, from
+	// remoteAddr
+	submit := func(i int, remoteAddr string) {
+		t.Helper()
+
+		coinbase := blockchain.NewCoinbaseTransaction("miner", 50, 5)
+		block := blockchain.NewBlock([]blockchain.Transaction{*coinbase}, fmt.Sprintf("%064x", i+1), 5)
+		block.Mine(params.GenesisBits)
+		body, err := json.Marshal(block)
+		if err != nil {
+			t.Fatalf("encoding block: %v", err)
+		}
+
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/blocks", bytes.NewReader(body))
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		n.handleSubmitBlock(w, r)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("orphan %d answered %d %s, want %d", i, w.Code, w.Body, http.StatusAccepted)
+		}
+	}
+
+	// New connections from one host share its quota
+	for i := 0; i < blockchain.MaxOrphansPerSource+5; i++ {
+		submit(i, fmt.Sprintf("10.0.0.1:%d", 5000+i))
+	}
+	if got := n.blockchain.OrphanCount(); got != blockchain.MaxOrphansPerSource {
+		t.Fatalf("OrphanCount = %d, want %d", got, blockchain.MaxOrphansPerSource)
+	}
+
+	submit(100, "10.0.0.2:5000")
+	if got := n.blockchain.OrphanCount(); got != blockchain.MaxOrphansPerSource+1 {
+		t.Errorf("OrphanCount after another host = %d, want %d", got, blockchain.MaxOrphansPerSource+1)
+	}
+}
+
+func TestRouterServesBlockSubmission(t *testing.T) {
+	params := blockchain.RegTestParams
+	bc, err := blockchain.NewBlockchainWithParams(&params)
+	if err != nil {
+		t.Fatalf("NewBlockchainWithParams: %v", err)
+	}
+	router := (&Node{blockchain: bc}).router()
+
+	for i, path := range []string{"/api/v1/blockchain/blocks", "/api/v1/blocks"} {
+		coinbase := blockchain.NewCoinbaseTransaction("miner", 50, 5)
+		block := blockchain.NewBlock([]blockchain.Transaction{*coinbase}, fmt.Sprintf("%064x", i+1), 5)
+		block.Mine(params.GenesisBits)
+		body, err := json.Marshal(block)
+		if err != nil {
+			t.Fatalf("encoding block: %v", err)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		if w.Code != http.StatusAccepted {
+			t.Errorf("POST %s answered %d %s, want the orphan accepted with %d", path, w.Code, w.Body, http.StatusAccepted)
+		}
+	}
+	if got := bc.OrphanCount(); got != 2 {
+		t.Errorf("OrphanCount = %d, want 2", got)
+	}
+}
+
+func TestHandleCreateTransaction(t *testing.T) {
+	bc := testutil.NewChain(t, testutil.NewClock())
+	n := &Node{
+		blockchain: bc,
+		mempool:    mempool.New(bc, mempool.DefaultConfig()),
+		wallet:     testutil.NewWallet(t),
+	}
+	other := testutil.NewWallet(t)
+	testutil.MineBlocks(t, bc, n.wallet.GetAddress(), int(blockchain.RegTestParams.CoinbaseMaturity)+2)
+
+	// create asks the node to send a coin's worth from from
+	create := func(from string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		body, err := json.Marshal(TransactionRequest{From: from, To: other.GetAddress(), Amount: blockchain.RegTestParams.InitialSubsidy / 2, Fee: 1000})
+		if err != nil {
+			t.Fatalf("encoding request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		n.handleCreateTransaction(w, httptest.NewRequest(http.MethodPost, "/api/v1/transactions", bytes.NewReader(body)))
+		return w
+	}
+
+	if w := create(other.GetAddress()); w.Code != http.StatusBadRequest {
+		t.Errorf("sending from another address answered %d %s, want %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+
+	// The second payment must not select the coin the first spent
+	for i := 0; i < 2; i++ {
+		if w := create(n.wallet.GetAddress()); w.Code != http.StatusAccepted {
+			t.Fatalf("payment %d answered %d %s, want %d", i, w.Code, w.Body, http.StatusAccepted)
+		}
+	}
+	if got := n.mempool.Count(); got != 2 {
+		t.Errorf("mempool holds %d transactions, want 2", got)
+	}
+}
+
+func TestStoreChainChange(t *testing.T) {
+	clock := testutil.NewClock()
+	bc := testutil.NewChain(t, clock)
+	n := &Node{blockchain: bc, storage: storage.NewMemoryStorage()}
+	bc.Subscribe(n.storeChainChange)
+
+	testutil.MineBlocks(t, bc, testutil.NewWallet(t).GetAddress(), 2)
+
+	// A longer branch from genesis replaces both stored blocks
+	other := testutil.NewChain(t, clock)
+	branch := testutil.MineBlocks(t, other, testutil.NewWallet(t).GetAddress(), 3)
+	for _, block := range branch {
+		if err := bc.SubmitBlock(block); err != nil {
+			t.Fatalf("SubmitBlock(%d): %v", block.Header.Height, err)
+		}
+	}
+
+	stored := loadStoredBlocks(n.storage)
+	if len(stored) != len(branch) {
+		t.Fatalf("storage holds %d blocks, want %d", len(stored), len(branch))
+	}
+	for i, block := range stored {
+		if block.Header.Hash != branch[i].Header.Hash {
+			t.Errorf("stored block %d is %s, want %s", block.Header.Height, block.Header.Hash, branch[i].Header.Hash)
+		}
+	}
+
+	// A restarted node imports the stored chain
+	restarted := testutil.NewChain(t, clock)
+	if err := restarted.ImportBlocks(stored); err != nil {
+		t.Fatalf("ImportBlocks: %v", err)
+	}
+	if got, want := restarted.GetLatestBlock().Header.Hash, bc.GetLatestBlock().Header.Hash; got != want {
+		t.Errorf("restarted tip %s, want %s", got, want)
+	}
+}
+
+func TestRejectionsAnswerJSONErrors(t *testing.T) {
+	bc := testutil.NewChain(t, testutil.NewClock())
+	n := &Node{blockchain: bc, mempool: mempool.New(bc, mempool.DefaultConfig())}
+	router := n.router()
+	w := testutil.NewWallet(t)
+	testutil.MineBlocks(t, bc, w.GetAddress(), int(blockchain.RegTestParams.CoinbaseMaturity)+1)
+	coin := testutil.Output(&bc.GetAllBlocks()[1].Transactions[0], 0)
+
+	tip := bc.GetLatestBlock()
+	badMerkleRoot := blockchain.NewBlock([]blockchain.Transaction{*blockchain.NewCoinbaseTransaction(w.GetAddress(), 50, tip.Header.Height+1)}, tip.Header.Hash, tip.Header.Height+1)
+	badMerkleRoot.Header.Timestamp = tip.Header.Timestamp + 1
+	badMerkleRoot.Header.MerkleRoot = strings.Repeat("0", 64)
+	badMerkleRoot.Mine(tip.Header.Difficulty)
+
+	missing := coin
+	missing.OutPoint.TxID = strings.Repeat("c", 64)
+
+	tests := []struct {
+		name     string
+		path     string
+		body     interface{}
+		wantCode string
+	}{
+		{"block breaking a consensus rule", "/api/v1/blockchain/blocks", badMerkleRoot, blockchain.ErrBadMerkleRoot.String()},
+		{"transaction breaking a consensus rule", "/api/v1/transactions/submit", testutil.Spend(t, w, missing, 1000000, 1000, 0), blockchain.ErrMissingInput.String()},
+		{"transaction breaking policy", "/api/v1/transactions/submit", testutil.Spend(t, w, coin, 100, 1000, 0), "dust"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(tt.body)
+			if err != nil {
+				t.Fatalf("encoding request: %v", err)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(body)))
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("answered %d %s, want %d", rec.Code, rec.Body, http.StatusBadRequest)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+			var response ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decoding %s: %v", rec.Body, err)
+			}
+			if response.Code != tt.wantCode || response.Error == "" {
+				t.Errorf("answered %+v, want code %s", response, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRouterServesTransactionProof(t *testing.T) {
+	bc := testutil.NewChain(t, testutil.NewClock())
+	router := (&Node{blockchain: bc}).router()
+	block := testutil.MineBlocks(t, bc, testutil.NewWallet(t).GetAddress(), 1)[0]
+	txID := block.Transactions[0].ID
+
+	for _, path := range []string{"/api/v1/blockchain/transactions/", "/api/v1/transactions/"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+txID+"/proof", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s answered %d %s, want %d", path, w.Code, w.Body, http.StatusOK)
+		}
+
+		var proof blockchain.TransactionProof
+		if err := json.Unmarshal(w.Body.Bytes(), &proof); err != nil {
+			t.Fatalf("decoding %s: %v", w.Body, err)
+		}
+		if proof.BlockHash != block.Header.Hash || !blockchain.VerifyTransactionProof(&block.Header, txID, proof.Proof) {
+			t.Errorf("GET %s answered a proof that does not verify against block %s", path, block.Header.Hash)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/blockchain/transactions/"+strings.Repeat("c", 64)+"/proof", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("proof of an unknown transaction answered %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"blockchain-node/pkg/blockchain"
+	"blockchain-node/pkg/crypto"
 	"blockchain-node/pkg/wallet"
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -11,19 +14,23 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // WalletCLI represents the wallet command line interface
 type WalletCLI struct {
 	nodeURL string
+	params  *blockchain.ChainParams
 }
 
 // APIResponse represents a generic API response
 type APIResponse struct {
-	Address    string `json:"address,omitempty"`
-	Balance    int64  `json:"balance,omitempty"`
-	PublicKey  string `json:"public_key,omitempty"`
-	PrivateKey string `json:"private_key,omitempty"`
+	Address          string `json:"address,omitempty"`
+	Balance          int64  `json:"balance,omitempty"`
+	SpendableBalance int64  `json:"spendable_balance,omitempty"`
+	ImmatureBalance  int64  `json:"immature_balance,omitempty"`
+	PublicKey        string `json:"public_key,omitempty"`
+	PrivateKey       string `json:"private_key,omitempty"`
 }
 
 // TransactionRequest represents a transaction request to the node
@@ -31,21 +38,23 @@ type TransactionRequest struct {
 	From   string `json:"from"`
 	To     string `json:"to"`
 	Amount int64  `json:"amount"`
+	Fee    int64  `json:"fee,omitempty"`
 }
 
 // NewWalletCLI creates a new wallet CLI instance
-func NewWalletCLI(nodeURL string) *WalletCLI {
+func NewWalletCLI(nodeURL string, params *blockchain.ChainParams) *WalletCLI {
 	return &WalletCLI{
 		nodeURL: nodeURL,
+		params:  params,
 	}
 }
 
 // createWallet creates a new wallet
 func (cli *WalletCLI) createWallet(filename string) {
-	fmt.Println("Creating new wallet...")
+	fmt.Printf("Creating new %s wallet...\n", cli.params.Name)
 	
 	// Generate new wallet
-	w, err := wallet.NewWallet()
+	w, err := wallet.NewWalletWithVersion(cli.params.AddressVersion)
 	if err != nil {
 		log.Fatalf("Failed to create wallet: %v", err)
 	}
@@ -97,15 +106,21 @@ func (cli *WalletCLI) getBalance(address string) {
 	
 	fmt.Printf("Address: %s\n", response.Address)
 	fmt.Printf("Balance: %d satoshis (%.8f coins)\n", response.Balance, float64(response.Balance)/100000000)
+	fmt.Printf("Spendable: %d satoshis\n", response.SpendableBalance)
+	if response.ImmatureBalance > 0 {
+		fmt.Printf("Immature: %d satoshis (mining rewards awaiting confirmations)\n", response.ImmatureBalance)
+	}
 }
 
-// sendTransaction sends a transaction
-func (cli *WalletCLI) sendTransaction(fromAddress, toAddress string, amount int64) {
+// sendTransaction asks the node to send coins from an address of its own
+// wallet, which signs them; the node accepts it into its mempool with 202
+func (cli *WalletCLI) sendTransaction(fromAddress, toAddress string, amount, fee int64) {
 	// Create transaction request
 	txReq := TransactionRequest{
 		From:   fromAddress,
 		To:     toAddress,
 		Amount: amount,
+		Fee:    fee,
 	}
 	
 	jsonData, err := json.Marshal(txReq)
@@ -121,7 +136,7 @@ func (cli *WalletCLI) sendTransaction(fromAddress, toAddress string, amount int6
 	}
 	defer resp.Body.Close()
 	
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode/100 != 2 {
 		body, _ := ioutil.ReadAll(resp.Body)
 		log.Fatalf("Transaction failed: %s", string(body))
 	}
@@ -136,6 +151,290 @@ func (cli *WalletCLI) sendTransaction(fromAddress, toAddress string, amount int6
 	if txID, ok := response["id"]; ok {
 		fmt.Printf("Transaction ID: %s\n", txID)
 	}
+	if fee, ok := response["fee"]; ok {
+		fmt.Printf("Fee: %v satoshis\n", fee)
+	}
+}
+
+// createMultiSig derives an M-of-N multisig address from co-signers' public keys
+func (cli *WalletCLI) createMultiSig(required int, publicKeys []string) {
+	ms, err := wallet.NewMultiSig(required, publicKeys, cli.params.ScriptAddressVersion)
+	if err != nil {
+		log.Fatalf("Failed to create multisig address: %v", err)
+	}
+	
+	fmt.Printf("%d-of-%d multisig address: %s\n", ms.Required, len(ms.PublicKeys), ms.Address)
+	fmt.Printf("Redeem script: %x\n", []byte(ms.RedeemScript))
+	fmt.Println("\nEvery co-signer needs the redeem script to spend from this address.")
+}
+
+// createMultiSigSpend asks the node for an unsigned spend from a multisig address
+// and saves it to filename for the co-signers to sign
+func (cli *WalletCLI) createMultiSigSpend(redeemScriptHex, toAddress string, amount, fee int64, filename string) {
+	redeemScript, err := hex.DecodeString(redeemScriptHex)
+	if err != nil {
+		log.Fatalf("Invalid redeem script: %v", err)
+	}
+	
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"redeem_script": blockchain.Script(redeemScript),
+		"to":            toAddress,
+		"amount":        amount,
+		"fee":           fee,
+	})
+	if err != nil {
+		log.Fatalf("Failed to marshal request: %v", err)
+	}
+	
+	url := fmt.Sprintf("%s/api/v1/wallet/multisig/transaction", cli.nodeURL)
+	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		log.Fatalf("Failed to create transaction: %v", err)
+	}
+	defer resp.Body.Close()
+	
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("Transaction failed: %s", string(body))
+	}
+	
+	if err := ioutil.WriteFile(filename, body, 0600); err != nil {
+		log.Fatalf("Failed to save transaction: %v", err)
+	}
+	
+	fmt.Printf("Unsigned transaction saved to: %s\n", filename)
+	fmt.Println("Pass it to each co-signer to run 'wallet cosign', then 'wallet multisig-submit'.")
+}
+
+// loadMultiSigTransaction reads a multisig transaction saved by multisig-spend or cosign
+func (cli *WalletCLI) loadMultiSigTransaction(filename string) *wallet.MultiSigTransaction {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		log.Fatalf("Failed to read transaction file: %v", err)
+	}
+	
+	var mtx wallet.MultiSigTransaction
+	if err := json.Unmarshal(data, &mtx); err != nil {
+		log.Fatalf("Failed to decode transaction file: %v", err)
+	}
+	return &mtx
+}
+
+// cosignMultiSig adds a wallet's signatures to a multisig transaction file. Signing
+// happens locally, so the private key never leaves this machine
+func (cli *WalletCLI) cosignMultiSig(walletFile, txFile string) {
+	w := cli.loadWallet(walletFile)
+	mtx := cli.loadMultiSigTransaction(txFile)
+	
+	if err := w.SignMultiSig(mtx); err != nil {
+		log.Fatalf("Failed to sign transaction: %v", err)
+	}
+	
+	data, err := json.MarshalIndent(mtx, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode transaction: %v", err)
+	}
+	if err := ioutil.WriteFile(txFile, data, 0600); err != nil {
+		log.Fatalf("Failed to save transaction: %v", err)
+	}
+	
+	missing, err := mtx.Missing()
+	if err != nil {
+		log.Fatalf("Invalid transaction: %v", err)
+	}
+	
+	fmt.Printf("Signed transaction %s as %s\n", mtx.Transaction.ID, w.GetPublicKey())
+	if missing > 0 {
+		fmt.Printf("%d more signature(s) needed\n", missing)
+	} else {
+		fmt.Println("Transaction has enough signatures and can be submitted")
+	}
+}
+
+// submitMultiSig sends a fully signed multisig transaction file to the node
+func (cli *WalletCLI) submitMultiSig(txFile string) {
+	data, err := ioutil.ReadFile(txFile)
+	if err != nil {
+		log.Fatalf("Failed to read transaction file: %v", err)
+	}
+	
+	url := fmt.Sprintf("%s/api/v1/wallet/multisig/submit", cli.nodeURL)
+	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		log.Fatalf("Failed to submit transaction: %v", err)
+	}
+	defer resp.Body.Close()
+	
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		log.Fatalf("Transaction failed: %s", string(body))
+	}
+	
+	var response map[string]interface{}
+	json.Unmarshal(body, &response)
+	
+	fmt.Println("Transaction sent successfully!")
+	if fee, ok := response["fee"]; ok {
+		fmt.Printf("Fee: %v satoshis\n", fee)
+	}
+}
+
+// parseUnlock reads when a vesting payment unlocks: a block height, a Unix time,
+// a date (YYYY-MM-DD or RFC 3339), or +<blocks> after the payment is mined
+func parseUnlock(unlock string, pubKeyHash []byte) (blockchain.Script, error) {
+	if strings.HasPrefix(unlock, "+") {
+		blocks, err := strconv.ParseUint(unlock[1:], 10, 16)
+		if err != nil || blocks == 0 {
+			return nil, fmt.Errorf("relative lock must be 1 to %d blocks", blockchain.SequenceLockTimeMask)
+		}
+		return blockchain.RelativeTimeLockScript(uint32(blocks), pubKeyHash), nil
+	}
+	
+	if lockTime, err := strconv.ParseInt(unlock, 10, 64); err == nil {
+		if lockTime <= 0 {
+			return nil, fmt.Errorf("lock time must be positive")
+		}
+		return blockchain.TimeLockScript(lockTime, pubKeyHash), nil
+	}
+	
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if date, err := time.Parse(layout, unlock); err == nil {
+			if date.Unix() < blockchain.LockTimeThreshold {
+				return nil, fmt.Errorf("date %s is too early", unlock)
+			}
+			return blockchain.TimeLockScript(date.Unix(), pubKeyHash), nil
+		}
+	}
+	
+	return nil, fmt.Errorf("expected a height, Unix time, date or +<blocks>, got %q", unlock)
+}
+
+// vest pays amount from a wallet to toAddress in an output only toAddress's key
+// can spend, and only once unlock is reached. The transaction is built and
+// signed locally from the wallet's coins
+func (cli *WalletCLI) vest(walletFile, toAddress string, amount, fee int64, unlock string) {
+	w := cli.loadWallet(walletFile)
+	
+	if !cli.params.IsValidAddress(toAddress) || crypto.IsScriptAddress(toAddress) {
+		log.Fatalf("Invalid %s address: %s", cli.params.Name, toAddress)
+	}
+	pubKeyHash, err := crypto.ExtractPublicKeyHash(toAddress)
+	if err != nil {
+		log.Fatalf("Invalid address: %v", err)
+	}
+	
+	script, err := parseUnlock(unlock, pubKeyHash)
+	if err != nil {
+		log.Fatalf("Invalid unlock: %v", err)
+	}
+	
+	tx, prevOuts, err := blockchain.NewTxBuilder(cli.getUTXOs(w.GetAddress()), w.GetAddress()).
+		AddScriptOutput(script, amount).
+		SetFee(fee).
+		Build()
+	if err != nil {
+		log.Fatalf("Failed to create transaction: %v", err)
+	}
+	
+	if err := w.SignTransaction(tx, prevOuts); err != nil {
+		log.Fatalf("Failed to sign transaction: %v", err)
+	}
+	
+	cli.submitTransaction(tx)
+	fmt.Printf("Locked %d satoshis for %s until %s\n", amount, toAddress, unlock)
+	fmt.Printf("The recipient claims them with: wallet claim <wallet_file> %s 0\n", tx.ID)
+}
+
+// claim spends a time-locked output paid to a wallet's key back to the wallet
+// once it has unlocked
+func (cli *WalletCLI) claim(walletFile, txID string, outputIndex int, fee int64) {
+	w := cli.loadWallet(walletFile)
+	
+	resp, err := http.Get(fmt.Sprintf("%s/api/v1/transactions/%s", cli.nodeURL, txID))
+	if err != nil {
+		log.Fatalf("Failed to get transaction: %v", err)
+	}
+	defer resp.Body.Close()
+	
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("Transaction not found: %s", string(body))
+	}
+	
+	var details blockchain.TransactionDetails
+	if err := json.Unmarshal(body, &details); err != nil {
+		log.Fatalf("Failed to decode transaction: %v", err)
+	}
+	if outputIndex < 0 || outputIndex >= len(details.Outputs) {
+		log.Fatalf("Transaction %s has no output %d", txID, outputIndex)
+	}
+	
+	output := details.Outputs[outputIndex]
+	prevOut := blockchain.UTXO{
+		OutPoint:      blockchain.OutPoint{TxID: details.ID, Index: outputIndex},
+		Value:         output.Value,
+		Address:       output.Address,
+		LockingScript: output.LockingScript,
+		Height:        details.BlockHeight,
+	}
+	
+	tx, err := w.SpendTimeLocked(prevOut, fee, 0)
+	if err != nil {
+		log.Fatalf("Failed to create transaction: %v", err)
+	}
+	
+	cli.submitTransaction(tx)
+}
+
+// getUTXOs fetches the outputs an address can spend from the node
+func (cli *WalletCLI) getUTXOs(address string) []blockchain.UTXO {
+	resp, err := http.Get(fmt.Sprintf("%s/api/v1/wallet/utxos/%s", cli.nodeURL, address))
+	if err != nil {
+		log.Fatalf("Failed to get unspent outputs: %v", err)
+	}
+	defer resp.Body.Close()
+	
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("Failed to get unspent outputs: %s", string(body))
+	}
+	
+	var response struct {
+		UTXOs []blockchain.UTXO `json:"utxos"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		log.Fatalf("Failed to decode unspent outputs: %v", err)
+	}
+	return response.UTXOs
+}
+
+// submitTransaction sends a signed transaction to the node
+func (cli *WalletCLI) submitTransaction(tx *blockchain.Transaction) {
+	jsonData, err := json.Marshal(tx)
+	if err != nil {
+		log.Fatalf("Failed to marshal transaction: %v", err)
+	}
+	
+	url := fmt.Sprintf("%s/api/v1/transactions/submit", cli.nodeURL)
+	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		log.Fatalf("Failed to submit transaction: %v", err)
+	}
+	defer resp.Body.Close()
+	
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		log.Fatalf("Transaction failed: %s", string(body))
+	}
+	
+	var response map[string]interface{}
+	json.Unmarshal(body, &response)
+	
+	fmt.Println("Transaction sent successfully!")
+	fmt.Printf("Transaction ID: %s\n", tx.ID)
+	if fee, ok := response["fee"]; ok {
+		fmt.Printf("Fee: %v satoshis\n", fee)
+	}
 }
 
 // listWallets lists all wallet files in current directory
@@ -168,7 +467,13 @@ func (cli *WalletCLI) displayHelp() {
 	fmt.Println("Commands:")
 	fmt.Println("  create [filename]           - Create a new wallet")
 	fmt.Println("  balance <address>           - Get balance for an address")
-	fmt.Println("  send <from> <to> <amount>   - Send coins (amount in satoshis)")
+	fmt.Println("  send <from> <to> <amount> [fee] - Send coins from the node's wallet (amount and fee in satoshis)")
+	fmt.Println("  multisig <m> <pubkey>...    - Create an m-of-n multisig address")
+	fmt.Println("  multisig-spend <redeem_script> <to> <amount> <file> [fee] - Save an unsigned spend from a multisig address")
+	fmt.Println("  cosign <wallet_file> <file> - Add your signatures to a multisig spend")
+	fmt.Println("  multisig-submit <file>      - Send a multisig spend once enough co-signers have signed")
+	fmt.Println("  vest <wallet_file> <to> <amount> <unlock> [fee] - Pay coins that unlock at a height, time, date or +<blocks>")
+	fmt.Println("  claim <wallet_file> <txid> <output> [fee] - Spend a vested output once it has unlocked")
 	fmt.Println("  list                        - List all wallet files")
 	fmt.Println("  info <filename>             - Display wallet information")
 	fmt.Println("  help                        - Display this help")
@@ -176,10 +481,12 @@ func (cli *WalletCLI) displayHelp() {
 	fmt.Println("Examples:")
 	fmt.Println("  wallet create my-wallet.wallet")
 	fmt.Println("  wallet balance 1A2B3C4D5E...")
-	fmt.Println("  wallet send 1A2B3C... 1X2Y3Z... 1000000")
+	fmt.Println("  wallet send 1A2B3C... 1X2Y3Z... 1000000 1000")
+	fmt.Println("  wallet vest my-wallet.wallet 1X2Y3Z... 1000000 2027-01-01")
 	fmt.Println("  wallet list")
 	fmt.Println()
 	fmt.Println("Note: 1 coin = 100,000,000 satoshis")
+	fmt.Println("Set NETWORK=testnet or NETWORK=regtest to create wallets for other networks")
 }
 
 // displayWalletInfo displays information about a wallet file
@@ -204,7 +511,18 @@ func main() {
 		nodeURL = customURL
 	}
 	
-	cli := NewWalletCLI(nodeURL)
+	// Network determines the address version of new wallets
+	network := "mainnet"
+	if customNetwork := os.Getenv("NETWORK"); customNetwork != "" {
+		network = customNetwork
+	}
+	
+	params, err := blockchain.ParamsForNetwork(network)
+	if err != nil {
+		log.Fatalf("Invalid NETWORK: %v", err)
+	}
+	
+	cli := NewWalletCLI(nodeURL, params)
 	
 	// Parse command line arguments
 	if len(os.Args) < 2 {
@@ -234,7 +552,7 @@ func main() {
 	case "send":
 		if len(os.Args) < 5 {
 			fmt.Println("Error: Missing arguments")
-			fmt.Println("Usage: wallet send <from_address> <to_address> <amount>")
+			fmt.Println("Usage: wallet send <from_address> <to_address> <amount> [fee]")
 			return
 		}
 		
@@ -245,7 +563,110 @@ func main() {
 			log.Fatalf("Invalid amount: %v", err)
 		}
 		
-		cli.sendTransaction(fromAddress, toAddress, amount)
+		var fee int64
+		if len(os.Args) > 5 {
+			fee, err = strconv.ParseInt(os.Args[5], 10, 64)
+			if err != nil || fee < 0 {
+				log.Fatalf("Invalid fee: %s", os.Args[5])
+			}
+		}
+		
+		cli.sendTransaction(fromAddress, toAddress, amount, fee)
+		
+	case "multisig":
+		if len(os.Args) < 4 {
+			fmt.Println("Error: Missing arguments")
+			fmt.Println("Usage: wallet multisig <required> <public_key>...")
+			return
+		}
+		
+		required, err := strconv.Atoi(os.Args[2])
+		if err != nil {
+			log.Fatalf("Invalid number of required signatures: %v", err)
+		}
+		cli.createMultiSig(required, os.Args[3:])
+		
+	case "multisig-spend":
+		if len(os.Args) < 6 {
+			fmt.Println("Error: Missing arguments")
+			fmt.Println("Usage: wallet multisig-spend <redeem_script> <to_address> <amount> <file> [fee]")
+			return
+		}
+		
+		amount, err := strconv.ParseInt(os.Args[4], 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid amount: %v", err)
+		}
+		
+		var fee int64
+		if len(os.Args) > 6 {
+			fee, err = strconv.ParseInt(os.Args[6], 10, 64)
+			if err != nil || fee < 0 {
+				log.Fatalf("Invalid fee: %s", os.Args[6])
+			}
+		}
+		
+		cli.createMultiSigSpend(os.Args[2], os.Args[3], amount, fee, os.Args[5])
+		
+	case "cosign":
+		if len(os.Args) < 4 {
+			fmt.Println("Error: Missing arguments")
+			fmt.Println("Usage: wallet cosign <wallet_file> <transaction_file>")
+			return
+		}
+		cli.cosignMultiSig(os.Args[2], os.Args[3])
+		
+	case "multisig-submit":
+		if len(os.Args) < 3 {
+			fmt.Println("Error: Transaction file required")
+			fmt.Println("Usage: wallet multisig-submit <transaction_file>")
+			return
+		}
+		cli.submitMultiSig(os.Args[2])
+		
+	case "vest":
+		if len(os.Args) < 6 {
+			fmt.Println("Error: Missing arguments")
+			fmt.Println("Usage: wallet vest <wallet_file> <to_address> <amount> <unlock> [fee]")
+			return
+		}
+		
+		amount, err := strconv.ParseInt(os.Args[4], 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid amount: %v", err)
+		}
+		
+		var fee int64
+		if len(os.Args) > 6 {
+			fee, err = strconv.ParseInt(os.Args[6], 10, 64)
+			if err != nil || fee < 0 {
+				log.Fatalf("Invalid fee: %s", os.Args[6])
+			}
+		}
+		
+		cli.vest(os.Args[2], os.Args[3], amount, fee, os.Args[5])
+		
+	case "claim":
+		if len(os.Args) < 5 {
+			fmt.Println("Error: Missing arguments")
+			fmt.Println("Usage: wallet claim <wallet_file> <txid> <output_index> [fee]")
+			return
+		}
+		
+		outputIndex, err := strconv.Atoi(os.Args[4])
+		if err != nil {
+			log.Fatalf("Invalid output index: %v", err)
+		}
+		
+		var fee int64
+		if len(os.Args) > 5 {
+			fee, err = strconv.ParseInt(os.Args[5], 10, 64)
+			if err != nil || fee < 0 {
+				log.Fatalf("Invalid fee: %s", os.Args[5])
+			}
+		}
+		
+		cli.claim(os.Args[2], os.Args[3], outputIndex, fee)
 		
 	case "list":
 		cli.listWallets()
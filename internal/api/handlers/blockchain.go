@@ -4,6 +4,8 @@ import (
 	"blockchain-node/pkg/blockchain"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"strconv"
 
@@ -27,11 +29,16 @@ func (h *BlockchainHandler) GetBlockchainInfo(w http.ResponseWriter, r *http.Req
 	latestBlock := h.blockchain.GetLatestBlock()
 	
 	info := map[string]interface{}{
-		"height":       h.blockchain.GetHeight(),
-		"difficulty":   h.blockchain.GetDifficulty(),
-		"latest_hash":  latestBlock.Header.Hash,
-		"total_blocks": len(h.blockchain.GetAllBlocks()),
-		"network":      "testnet", // Could be configurable
+		"height":           h.blockchain.GetHeight(),
+		"difficulty":       h.blockchain.GetDifficulty(),
+		"difficulty_ratio": blockchain.CalcDifficultyRatio(h.blockchain.GetDifficulty()),
+		"chain_work":       h.blockchain.GetChainWork().String(),
+		"network_hashrate": h.blockchain.EstimateHashRate(10),
+		"median_time_past": h.blockchain.GetMedianTimePast(),
+		"latest_hash":      latestBlock.Header.Hash,
+		"total_blocks":     len(h.blockchain.GetAllBlocks()),
+		"network":          h.blockchain.Params().Name,
+		"orphans":          h.blockchain.OrphanCount(),
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
@@ -153,6 +160,83 @@ func (h *BlockchainHandler) GetLatestBlock(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// SubmitBlock handles POST /api/v1/blockchain/blocks. The block is read as JSON,
+// or in the binary wire format when sent as application/octet-stream.
+func (h *BlockchainHandler) SubmitBlock(w http.ResponseWriter, r *http.Request) {
+	block, err := decodeBlock(w, r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid block body: %v", err), http.StatusBadRequest)
+		return
+	}
+	
+	isOrphan, err := h.blockchain.ProcessBlock(block, requestSource(r))
+	if err != nil {
+		writeChainError(w, "Block rejected", err)
+		return
+	}
+	
+	if isOrphan {
+		// Held until its parent arrives; tell the sender which block is missing
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":        "orphan",
+			"hash":          block.Header.Hash,
+			"missing_block": h.blockchain.OrphanRoot(block.Header.Hash),
+		})
+		return
+	}
+	
+	latestBlock := h.blockchain.GetLatestBlock()
+	
+	response := map[string]interface{}{
+		"status":      "accepted",
+		"hash":        block.Header.Hash,
+		"height":      block.Header.Height,
+		"is_tip":      latestBlock.Header.Hash == block.Header.Hash,
+		"latest_hash": latestBlock.Header.Hash,
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// requestSource identifies the client that sent a request by its host, so that
+// per-source limits are not evaded by opening new connections
+func requestSource(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// maxBlockBodySize bounds a submitted block's request body. JSON spells out
+// field names and hex, so it allows several times the binary size limit
+const maxBlockBodySize = 4 * blockchain.MaxBlockSize
+
+// decodeBlock reads a block from the request body in the format named by its Content-Type
+func decodeBlock(w http.ResponseWriter, r *http.Request) (*blockchain.Block, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBlockBodySize)
+	
+	if r.Header.Get("Content-Type") == "application/octet-stream" {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		return blockchain.DeserializeBlockBinary(data)
+	}
+	
+	var block blockchain.Block
+	if err := json.NewDecoder(r.Body).Decode(&block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
 // ValidateChain handles GET /api/v1/blockchain/validate
 func (h *BlockchainHandler) ValidateChain(w http.ResponseWriter, r *http.Request) {
 	err := h.blockchain.ValidateChain()
@@ -182,14 +266,32 @@ func (h *BlockchainHandler) GetTransaction(w http.ResponseWriter, r *http.Reques
 		return
 	}
 	
-	tx, err := h.blockchain.GetTransactionByID(txID)
+	details, err := h.blockchain.GetTransactionDetails(txID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Transaction not found: %v", err), http.StatusNotFound)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(details); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetTransactionProof handles GET /api/v1/blockchain/transactions/{txid}/proof
+func (h *BlockchainHandler) GetTransactionProof(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	txID := vars["txid"]
+	
+	proof, err := h.blockchain.GetTransactionProof(txID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Transaction not found: %v", err), http.StatusNotFound)
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(tx); err != nil {
+	if err := json.NewEncoder(w).Encode(proof); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
 	}
@@ -218,7 +320,7 @@ func (h *BlockchainHandler) SearchTransactions(w http.ResponseWriter, r *http.Re
 				
 				// Check inputs
 				for _, input := range tx.Inputs {
-					if input.PublicKey == address {
+					if input.PublicKey() == address {
 						involved = true
 						break
 					}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"blockchain-node/pkg/blockchain"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrorResponse represents an error returned for a rejected block or transaction
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+// writeChainError reports consensus rule and policy violations as 400 with their
+// rule code or policy reason, and anything else as an internal error
+func writeChainError(w http.ResponseWriter, message string, err error) {
+	var code string
+	var ruleErr blockchain.RuleError
+	var policyErr blockchain.PolicyError
+	switch {
+	case errors.As(err, &ruleErr):
+		code = ruleErr.Code.String()
+	case errors.As(err, &policyErr):
+		code = policyErr.Reason
+	default:
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error: fmt.Sprintf("%s: %v", message, err),
+		Code:  code,
+	})
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"blockchain-node/pkg/blockchain"
+	"blockchain-node/pkg/mempool"
 	"blockchain-node/pkg/wallet"
 	"encoding/json"
 	"fmt"
@@ -13,12 +14,17 @@ import (
 // WalletHandler handles wallet-related HTTP requests
 type WalletHandler struct {
 	blockchain *blockchain.Blockchain
+	mempool    *mempool.Mempool
+	nodeWallet *wallet.Wallet
 }
 
-// NewWalletHandler creates a new wallet handler
-func NewWalletHandler(bc *blockchain.Blockchain) *WalletHandler {
+// NewWalletHandler creates a new wallet handler submitting transactions to
+// pool. CreateTransaction signs with nodeWallet and only sends from its address
+func NewWalletHandler(bc *blockchain.Blockchain, pool *mempool.Mempool, nodeWallet *wallet.Wallet) *WalletHandler {
 	return &WalletHandler{
 		blockchain: bc,
+		mempool:    pool,
+		nodeWallet: nodeWallet,
 	}
 }
 
@@ -39,18 +45,52 @@ type CreateWalletResponse struct {
 
 // BalanceResponse represents a balance query response
 type BalanceResponse struct {
-	Address       string                     `json:"address"`
-	Balance       int64                      `json:"balance"`
-	BalanceCoins  float64                    `json:"balance_coins"`
-	UTXOs         []blockchain.TxOutput      `json:"utxos"`
-	Transactions  []blockchain.Transaction   `json:"transactions,omitempty"`
+	Address          string                   `json:"address"`
+	Balance          int64                    `json:"balance"`
+	BalanceCoins     float64                  `json:"balance_coins"`
+	SpendableBalance int64                    `json:"spendable_balance"`
+	MatureBalance    int64                    `json:"mature_balance"`   // Coinbase outputs past maturity
+	ImmatureBalance  int64                    `json:"immature_balance"` // Coinbase outputs not yet spendable
+	UTXOs            []blockchain.UTXO        `json:"utxos"`
+	SpendableUTXOs   []blockchain.UTXO        `json:"spendable_utxos"`
+	Transactions     []blockchain.Transaction `json:"transactions,omitempty"`
 }
 
 // TransactionRequest represents a transaction creation request
 type TransactionRequest struct {
-	From   string `json:"from"`
-	To     string `json:"to"`
-	Amount int64  `json:"amount"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Amount  int64  `json:"amount"`
+	Fee     int64  `json:"fee,omitempty"`      // Absolute fee in satoshis
+	FeeRate int64  `json:"fee_rate,omitempty"` // Fee in satoshis per byte
+}
+
+// MultiSigRequest represents a multisig address creation request
+type MultiSigRequest struct {
+	Required   int      `json:"required"`
+	PublicKeys []string `json:"public_keys"`
+}
+
+// MultiSigTransactionRequest represents a request for an unsigned spend from a multisig address
+type MultiSigTransactionRequest struct {
+	RedeemScript blockchain.Script `json:"redeem_script"`
+	To           string            `json:"to"`
+	Amount       int64             `json:"amount"`
+	Fee          int64             `json:"fee,omitempty"`
+	FeeRate      int64             `json:"fee_rate,omitempty"`
+}
+
+// MultiSigSignature is one co-signer's signature of one input
+type MultiSigSignature struct {
+	InputIndex int    `json:"input_index"`
+	PublicKey  string `json:"public_key"`
+	Signature  string `json:"signature"`
+}
+
+// MultiSigSignRequest adds co-signer signatures to a multisig transaction
+type MultiSigSignRequest struct {
+	Transaction *wallet.MultiSigTransaction `json:"transaction"`
+	Signatures  []MultiSigSignature         `json:"signatures"`
 }
 
 // CreateWallet handles POST /api/v1/wallet/create
@@ -62,7 +102,7 @@ func (h *WalletHandler) CreateWallet(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Create new wallet
-	newWallet, err := wallet.NewWallet()
+	newWallet, err := wallet.NewWalletWithVersion(h.blockchain.Params().AddressVersion)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create wallet: %v", err), http.StatusInternalServerError)
 		return
@@ -108,19 +148,24 @@ func (h *WalletHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Get balance from blockchain
-	balance := h.blockchain.GetBalance(address)
+	balance := h.blockchain.GetBalanceDetails(address)
 	
 	// Get UTXOs
 	utxos := h.blockchain.FindUTXO(address)
+	spendableUTXOs := h.blockchain.FindSpendableUTXO(address)
 	
 	// Check if detailed info is requested
 	includeTransactions := r.URL.Query().Get("include_transactions") == "true"
 	
 	response := BalanceResponse{
-		Address:      address,
-		Balance:      balance,
-		BalanceCoins: float64(balance) / 100000000.0,
-		UTXOs:        utxos,
+		Address:          address,
+		Balance:          balance.Total,
+		BalanceCoins:     float64(balance.Total) / 100000000.0,
+		SpendableBalance: balance.Spendable,
+		MatureBalance:    balance.Mature,
+		ImmatureBalance:  balance.Immature,
+		UTXOs:            utxos,
+		SpendableUTXOs:   spendableUTXOs,
 	}
 	
 	// Include transaction history if requested
@@ -136,7 +181,7 @@ func (h *WalletHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
 				
 				// Check if address is involved in inputs
 				for _, input := range tx.Inputs {
-					if input.PublicKey == address {
+					if input.PublicKey() == address {
 						involved = true
 						break
 					}
@@ -177,36 +222,85 @@ func (h *WalletHandler) CreateTransaction(w http.ResponseWriter, r *http.Request
 	}
 	
 	// Validate request
-	if req.From == "" || req.To == "" || req.Amount <= 0 {
+	if req.From == "" || req.To == "" || req.Amount <= 0 || req.Fee < 0 || req.FeeRate < 0 {
 		http.Error(w, "Invalid transaction parameters", http.StatusBadRequest)
 		return
 	}
 	
-	// Create transaction through blockchain
-	tx, err := h.blockchain.CreateTransaction(req.From, req.To, req.Amount)
+	if !h.blockchain.Params().IsValidAddress(req.To) {
+		http.Error(w, fmt.Sprintf("Invalid %s address: %s", h.blockchain.Params().Name, req.To), http.StatusBadRequest)
+		return
+	}
+	
+	// Only the node wallet's coins can be signed here; anyone else signs
+	// their transaction and submits it
+	if h.nodeWallet == nil || req.From != h.nodeWallet.GetAddress() {
+		http.Error(w, "Can only send from the node wallet; sign the transaction and POST it to /api/v1/wallet/transaction/submit", http.StatusBadRequest)
+		return
+	}
+	
+	tx, err := h.nodeWallet.CreateTransaction(req.To, req.Amount, req.Fee, req.FeeRate, h.blockchain, h.mempool)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create transaction: %v", err), http.StatusBadRequest)
 		return
 	}
 	
-	// In a real implementation, this would go to a mempool
-	// For now, we immediately add it to a block
-	err = h.blockchain.AddBlock([]blockchain.Transaction{*tx})
+	// The transaction waits in the mempool until a block is mined
+	desc, err := h.mempool.AddTransaction(tx)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to add transaction to blockchain: %v", err), http.StatusInternalServerError)
+		writeChainError(w, "Transaction rejected", err)
 		return
 	}
 	
 	response := map[string]interface{}{
 		"transaction_id": tx.ID,
-		"from":          req.From,
-		"to":            req.To,
-		"amount":        req.Amount,
-		"status":        "confirmed",
-		"block_height":  h.blockchain.GetHeight(),
+		"from":           req.From,
+		"to":             req.To,
+		"amount":         req.Amount,
+		"fee":            desc.Fee,
+		"size":           desc.Size,
+		"fee_rate":       desc.FeeRate(),
+		"status":         "pending",
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// SubmitTransaction handles POST /api/v1/wallet/transaction/submit for
+// transactions the client has signed
+func (h *WalletHandler) SubmitTransaction(w http.ResponseWriter, r *http.Request) {
+	var tx blockchain.Transaction
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	
+	if err := tx.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid transaction: %v", err), http.StatusBadRequest)
+		return
+	}
+	
+	desc, err := h.mempool.AddTransaction(&tx)
+	if err != nil {
+		writeChainError(w, "Transaction rejected", err)
+		return
+	}
+	
+	response := map[string]interface{}{
+		"transaction_id": tx.ID,
+		"fee":            desc.Fee,
+		"size":           desc.Size,
+		"fee_rate":       desc.FeeRate(),
+		"status":         "pending",
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
@@ -243,7 +337,7 @@ func (h *WalletHandler) GetWalletInfo(w http.ResponseWriter, r *http.Request) {
 			
 			// Check inputs
 			for _, input := range tx.Inputs {
-				if input.PublicKey == address {
+				if input.PublicKey() == address {
 					involved = true
 					break
 				}
@@ -291,10 +385,13 @@ func (h *WalletHandler) ListUTXOs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	utxos := h.blockchain.FindUTXO(address)
+	// Only outputs the address can spend now: mature, and not already spent
+	// by a transaction waiting in the mempool
+	utxos := []blockchain.UTXO{}
 	totalValue := int64(0)
 	
-	for _, utxo := range utxos {
+	for _, utxo := range h.blockchain.FindAvailableUTXO(address, h.mempool) {
+		utxos = append(utxos, utxo)
 		totalValue += utxo.Value
 	}
 	
@@ -310,4 +407,136 @@ func (h *WalletHandler) ListUTXOs(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
 	}
-}
\ No newline at end of file
+}
+
+// CreateMultiSig handles POST /api/v1/wallet/multisig
+func (h *WalletHandler) CreateMultiSig(w http.ResponseWriter, r *http.Request) {
+	var req MultiSigRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	
+	ms, err := wallet.NewMultiSig(req.Required, req.PublicKeys, h.blockchain.Params().ScriptAddressVersion)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid multisig: %v", err), http.StatusBadRequest)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ms); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// CreateMultiSigTransaction handles POST /api/v1/wallet/multisig/transaction. It
+// returns an unsigned transaction for the co-signers to sign.
+func (h *WalletHandler) CreateMultiSigTransaction(w http.ResponseWriter, r *http.Request) {
+	var req MultiSigTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	
+	if req.To == "" || req.Amount <= 0 || req.Fee < 0 || req.FeeRate < 0 {
+		http.Error(w, "Invalid transaction parameters", http.StatusBadRequest)
+		return
+	}
+	
+	if !h.blockchain.Params().IsValidAddress(req.To) {
+		http.Error(w, fmt.Sprintf("Invalid %s address: %s", h.blockchain.Params().Name, req.To), http.StatusBadRequest)
+		return
+	}
+	
+	ms, err := wallet.MultiSigFromRedeemScript(req.RedeemScript, h.blockchain.Params().ScriptAddressVersion)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid redeem script: %v", err), http.StatusBadRequest)
+		return
+	}
+	
+	mtx, err := wallet.NewMultiSigTransaction(ms, h.blockchain.FindAvailableUTXO(ms.Address, h.mempool), req.To, req.Amount, req.Fee, req.FeeRate)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create transaction: %v", err), http.StatusBadRequest)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(mtx); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// SignMultiSigTransaction handles POST /api/v1/wallet/multisig/sign. Co-signers
+// sign offline and send their signatures, which are checked and merged into the
+// transaction.
+func (h *WalletHandler) SignMultiSigTransaction(w http.ResponseWriter, r *http.Request) {
+	var req MultiSigSignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Transaction == nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	
+	for _, sig := range req.Signatures {
+		if err := req.Transaction.AddSignature(sig.InputIndex, sig.PublicKey, sig.Signature); err != nil {
+			http.Error(w, fmt.Sprintf("Signature rejected: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	
+	missing, err := req.Transaction.Missing()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid multisig transaction: %v", err), http.StatusBadRequest)
+		return
+	}
+	
+	response := map[string]interface{}{
+		"transaction": req.Transaction,
+		"missing":     missing,
+		"complete":    missing == 0,
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// SubmitMultiSigTransaction handles POST /api/v1/wallet/multisig/submit
+func (h *WalletHandler) SubmitMultiSigTransaction(w http.ResponseWriter, r *http.Request) {
+	var mtx wallet.MultiSigTransaction
+	if err := json.NewDecoder(r.Body).Decode(&mtx); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	
+	tx, err := mtx.Finalize()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to finalize transaction: %v", err), http.StatusBadRequest)
+		return
+	}
+	
+	// Like CreateTransaction, the transaction waits in the mempool
+	desc, err := h.mempool.AddTransaction(tx)
+	if err != nil {
+		writeChainError(w, "Transaction rejected", err)
+		return
+	}
+	
+	response := map[string]interface{}{
+		"transaction_id": tx.ID,
+		"fee":            desc.Fee,
+		"size":           desc.Size,
+		"fee_rate":       desc.FeeRate(),
+		"status":         "pending",
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"blockchain-node/internal/api/handlers"
 	"blockchain-node/internal/api/middleware"
 	"blockchain-node/pkg/blockchain"
+	"blockchain-node/pkg/mempool"
 	"blockchain-node/pkg/wallet"
 
 	"github.com/gorilla/mux"
@@ -16,11 +17,12 @@ type Router struct {
 	miningHandler     *handlers.MiningHandler
 }
 
-// NewRouter creates a new API router
-func NewRouter(bc *blockchain.Blockchain, minerWallet *wallet.Wallet) *Router {
+// NewRouter creates a new API router submitting transactions to the node's
+// mempool pool
+func NewRouter(bc *blockchain.Blockchain, pool *mempool.Mempool, minerWallet *wallet.Wallet) *Router {
 	return &Router{
 		blockchainHandler: handlers.NewBlockchainHandler(bc),
-		walletHandler:     handlers.NewWalletHandler(bc),
+		walletHandler:     handlers.NewWalletHandler(bc, pool, minerWallet),
 		miningHandler:     handlers.NewMiningHandler(bc, minerWallet),
 	}
 }
@@ -65,6 +67,7 @@ func (r *Router) setupBlockchainRoutes(api *mux.Router) {
 	
 	// Blocks
 	blockchain.HandleFunc("/blocks", r.blockchainHandler.GetAllBlocks).Methods("GET")
+	blockchain.HandleFunc("/blocks", r.blockchainHandler.SubmitBlock).Methods("POST")
 	blockchain.HandleFunc("/blocks/{height:[0-9]+}", r.blockchainHandler.GetBlock).Methods("GET")
 	blockchain.HandleFunc("/blocks/hash/{hash}", r.blockchainHandler.GetBlockByHash).Methods("GET")
 	blockchain.HandleFunc("/blocks/latest", r.blockchainHandler.GetLatestBlock).Methods("GET")
@@ -72,6 +75,7 @@ func (r *Router) setupBlockchainRoutes(api *mux.Router) {
 	// Transactions
 	blockchain.HandleFunc("/transactions", r.blockchainHandler.SearchTransactions).Methods("GET")
 	blockchain.HandleFunc("/transactions/{txid}", r.blockchainHandler.GetTransaction).Methods("GET")
+	blockchain.HandleFunc("/transactions/{txid}/proof", r.blockchainHandler.GetTransactionProof).Methods("GET")
 }
 
 // setupWalletRoutes configures wallet-related routes
@@ -89,6 +93,13 @@ func (r *Router) setupWalletRoutes(api *mux.Router) {
 	
 	// Transactions
 	wallet.HandleFunc("/transaction", r.walletHandler.CreateTransaction).Methods("POST")
+	wallet.HandleFunc("/transaction/submit", r.walletHandler.SubmitTransaction).Methods("POST")
+	
+	// Multisig addresses, and collecting co-signer signatures to spend from them
+	wallet.HandleFunc("/multisig", r.walletHandler.CreateMultiSig).Methods("POST")
+	wallet.HandleFunc("/multisig/transaction", r.walletHandler.CreateMultiSigTransaction).Methods("POST")
+	wallet.HandleFunc("/multisig/sign", r.walletHandler.SignMultiSigTransaction).Methods("POST")
+	wallet.HandleFunc("/multisig/submit", r.walletHandler.SubmitMultiSigTransaction).Methods("POST")
 }
 
 // setupMiningRoutes configures mining-related routes
@@ -110,12 +121,15 @@ func (r *Router) setupMiningRoutes(api *mux.Router) {
 func (r *Router) setupLegacyRoutes(api *mux.Router) {
 	// Legacy routes from the original node implementation
 	api.HandleFunc("/blocks", r.blockchainHandler.GetAllBlocks).Methods("GET")
+	api.HandleFunc("/blocks", r.blockchainHandler.SubmitBlock).Methods("POST")
 	api.HandleFunc("/blocks/{height:[0-9]+}", r.blockchainHandler.GetBlock).Methods("GET")
 	api.HandleFunc("/blocks/latest", r.blockchainHandler.GetLatestBlock).Methods("GET")
 	api.HandleFunc("/blocks/mine", r.miningHandler.MineBlock).Methods("POST")
 	
 	api.HandleFunc("/transactions", r.walletHandler.CreateTransaction).Methods("POST")
+	api.HandleFunc("/transactions/submit", r.walletHandler.SubmitTransaction).Methods("POST")
 	api.HandleFunc("/transactions/{txid}", r.blockchainHandler.GetTransaction).Methods("GET")
+	api.HandleFunc("/transactions/{txid}/proof", r.blockchainHandler.GetTransactionProof).Methods("GET")
 	
 	api.HandleFunc("/wallet/balance/{address}", r.walletHandler.GetBalance).Methods("GET")
 	api.HandleFunc("/wallet/new", r.walletHandler.CreateWallet).Methods("POST")
@@ -0,0 +1,102 @@
+// Package testutil holds the fixtures shared by the tests of packages built
+// on the blockchain: a regtest chain on a clock the test moves by hand,
+// wallets, and signed spends between them.
+package testutil
+
+import (
+	"blockchain-node/pkg/blockchain"
+	"blockchain-node/pkg/wallet"
+	"testing"
+	"time"
+)
+
+// Start is a time after the regtest genesis block.
+var Start = time.Unix(blockchain.RegTestParams.GenesisTimestamp, 0).Add(24 * time.Hour)
+
+// Clock is a blockchain.Clock the test moves by hand. It starts at Start.
+type Clock struct {
+	now time.Time
+}
+
+func NewClock() *Clock {
+	return &Clock{now: Start}
+}
+
+func (c *Clock) Now() time.Time {
+	return c.now
+}
+
+// Set moves the clock to now.
+func (c *Clock) Set(now time.Time) {
+	c.now = now
+}
+
+// Advance moves the clock on by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// NewChain returns a regtest chain reading the time from clock.
+func NewChain(t *testing.T, clock blockchain.Clock) *blockchain.Blockchain {
+	t.Helper()
+
+	params := blockchain.RegTestParams
+	bc, err := blockchain.NewBlockchainWithParams(&params)
+	if err != nil {
+		t.Fatalf("NewBlockchainWithParams: %v", err)
+	}
+	bc.SetClock(clock)
+	return bc
+}
+
+// NewWallet returns a wallet with a regtest address.
+func NewWallet(t *testing.T) *wallet.Wallet {
+	t.Helper()
+
+	w, err := wallet.NewWalletWithVersion(blockchain.RegTestParams.AddressVersion)
+	if err != nil {
+		t.Fatalf("NewWalletWithVersion: %v", err)
+	}
+	return w
+}
+
+// MineBlocks mines n empty blocks paying address.
+func MineBlocks(t *testing.T, bc *blockchain.Blockchain, address string, n int) []*blockchain.Block {
+	t.Helper()
+
+	blocks := make([]*blockchain.Block, n)
+	for i := range blocks {
+		block, err := bc.MineBlock(address, nil)
+		if err != nil {
+			t.Fatalf("MineBlock: %v", err)
+		}
+		blocks[i] = block
+	}
+	return blocks
+}
+
+// Output returns output i of tx as a coin to spend.
+func Output(tx *blockchain.Transaction, i int) blockchain.UTXO {
+	return blockchain.UTXO{
+		OutPoint: blockchain.OutPoint{TxID: tx.ID, Index: i},
+		Value:    tx.Outputs[i].Value,
+		Address:  tx.Outputs[i].Address,
+	}
+}
+
+// Spend builds a transaction paying value from coin back to w, with lock
+// time lockTime, and signs it with w.
+func Spend(t *testing.T, w *wallet.Wallet, coin blockchain.UTXO, value, fee, lockTime int64) *blockchain.Transaction {
+	t.Helper()
+
+	tx, prevOuts, err := blockchain.NewTxBuilder([]blockchain.UTXO{coin}, w.GetAddress()).AddOutput(w.GetAddress(), value).SetFee(fee).Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	tx.LockTime = lockTime
+	tx.SetID()
+	if err := w.SignTransaction(tx, prevOuts); err != nil {
+		t.Fatalf("SignTransaction: %v", err)
+	}
+	return tx
+}
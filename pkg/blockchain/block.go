@@ -1,13 +1,21 @@
 package blockchain
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"blockchain-node/pkg/merkle"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 )
 
+// Consensus limits on a block. The size is measured on the binary wire
+// encoding.
+const (
+	MaxBlockSize         = 1000000
+	MaxBlockTransactions = 10000
+)
+
 type Block struct {
 	Header       BlockHeader   `json:"header"`
 	Transactions []Transaction `json:"transactions"`
@@ -18,14 +26,18 @@ type BlockHeader struct {
 	PreviousHash string `json:"previous_hash"` // Hash of previous block
 	MerkleRoot   string `json:"merkle_root"`   // Merkle root of transactions
 	Timestamp    int64  `json:"timestamp"`     // Block creation timestamp
-	Difficulty   uint32 `json:"difficulty"`    // Mining difficulty target
+	Difficulty   uint32 `json:"difficulty"`    // Compact encoding of the proof of work target
 	Nonce        uint64 `json:"nonce"`         // Proof of work nonce
 	Hash         string `json:"hash"`          // Block hash
 	Height       int64  `json:"height"`        // Block height/index
 }
 
 
+// NewBlock assembles an unmined block. When the block spends anything, the
+// coinbase in first position is given the block's witness commitment.
 func NewBlock(transactions []Transaction, previousHash string, height int64) *Block {
+	transactions = append([]Transaction(nil), transactions...)
+	
 	block := &Block{
 		Header: BlockHeader{
 			Version:      1,
@@ -38,176 +50,211 @@ func NewBlock(transactions []Transaction, previousHash string, height int64) *Bl
 		Transactions: transactions,
 	}
 	
+	if len(transactions) > 1 && transactions[0].IsCoinbase() {
+		transactions[0].WitnessCommitment = block.calculateWitnessRoot()
+		transactions[0].SetID()
+	}
+	
 	block.Header.MerkleRoot = block.calculateMerkleRoot()
 	
 	return block
 }
 
 
-func NewGenesisBlock() *Block {
-	coinbase := NewCoinbaseTransaction("genesis", 5000000000) 
+const zeroHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// NewGenesisBlock builds the network's genesis block entirely from params and
+// mines it from nonce zero, so every node on a network derives the same block.
+func NewGenesisBlock(params *ChainParams) *Block {
+	coinbase := Transaction{
+		Inputs: []TxInput{},
+		Outputs: []TxOutput{{
+			Value:   CalcBlockSubsidy(0, params),
+			Address: "genesis",
+		}},
+		Timestamp: params.GenesisTimestamp,
+	}
+	coinbase.SetID()
 	
 	genesis := &Block{
 		Header: BlockHeader{
 			Version:      1,
-			PreviousHash: "0000000000000000000000000000000000000000000000000000000000000000",
-			Timestamp:    time.Now().Unix(),
-			Difficulty:   1,
+			PreviousHash: zeroHash,
+			Timestamp:    params.GenesisTimestamp,
 			Nonce:        0,
 			Height:       0,
 		},
-		Transactions: []Transaction{*coinbase},
+		Transactions: []Transaction{coinbase},
 	}
 	
 	genesis.Header.MerkleRoot = genesis.calculateMerkleRoot()
-	genesis.Header.Hash = genesis.calculateHash()
+	genesis.Mine(params.GenesisBits)
 	
 	return genesis
 }
 
+// calculateHash returns the double SHA-256 of the binary header, or an empty
+// string if the header holds a malformed hash and cannot be serialized.
 func (b *Block) calculateHash() string {
-	headerData := fmt.Sprintf("%d%s%s%d%d%d%d",
-		b.Header.Version,
-		b.Header.PreviousHash,
-		b.Header.MerkleRoot,
-		b.Header.Timestamp,
-		b.Header.Difficulty,
-		b.Header.Nonce,
-		b.Header.Height,
-	)
-	
-	hash := sha256.Sum256([]byte(headerData))
-	return hex.EncodeToString(hash[:])
-}
-
-func (b *Block) calculateMerkleRoot() string {
-	if len(b.Transactions) == 0 {
+	headerBytes, err := b.Header.Serialize()
+	if err != nil {
 		return ""
 	}
 	
-	var txHashes []string
-	for _, tx := range b.Transactions {
-		txHashes = append(txHashes, tx.ID)
-	}
-	
-	return b.buildMerkleTree(txHashes)
+	return hashHeader(headerBytes)
 }
 
+// calculateMerkleRoot builds the header's merkle tree over transaction IDs,
+// which leave out signatures.
+func (b *Block) calculateMerkleRoot() string {
+	return merkle.Root(b.transactionIDs())
+}
 
-func (b *Block) buildMerkleTree(hashes []string) string {
-	if len(hashes) == 0 {
-		return ""
+func (b *Block) transactionIDs() []string {
+	txIDs := make([]string, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		txIDs[i] = tx.ID
 	}
-	
-	if len(hashes) == 1 {
-		return hashes[0]
+	return txIDs
+}
+
+// calculateWitnessRoot builds a merkle tree over witness hashes, which cover
+// signatures. The coinbase's leaf is all zeros because the coinbase carries
+// the resulting commitment.
+func (b *Block) calculateWitnessRoot() string {
+	if len(b.Transactions) == 0 {
+		return ""
 	}
 	
-	var newLevel []string
-	for i := 0; i < len(hashes); i += 2 {
-		var combined string
-		if i+1 < len(hashes) {
-			combined = hashes[i] + hashes[i+1]
-		} else {
-			combined = hashes[i] + hashes[i]
-		}
-		
-		hash := sha256.Sum256([]byte(combined))
-		newLevel = append(newLevel, hex.EncodeToString(hash[:]))
+	witnessHashes := []string{zeroHash}
+	for _, tx := range b.Transactions[1:] {
+		witnessHashes = append(witnessHashes, tx.WitnessHash())
 	}
 	
-	return b.buildMerkleTree(newLevel)
+	return merkle.Root(witnessHashes)
 }
 
+
 func (b *Block) SetHash(hash string) {
 	b.Header.Hash = hash
 }
 
+// Mine sets the block's difficulty and searches for its proof of work on a
+// single goroutine. The search is deterministic, which the genesis block
+// relies on; use a Miner to search on every CPU or to be able to cancel.
 func (b *Block) Mine(difficulty uint32) {
 	b.Header.Difficulty = difficulty
-	target := getTarget(difficulty)
-	
-	for {
-		b.Header.Nonce++
-		hash := b.calculateHash()
-		
-		if isHashValid(hash, target) {
-			b.Header.Hash = hash
-			fmt.Printf("Block mined: %s\n", hash)
-			break
-		}
-	}
-}
-
-
-func getTarget(difficulty uint32) string {
-	target := ""
-	for i := uint32(0); i < difficulty; i++ {
-		target += "0"
-	}
-	return target
-}
-
-func isHashValid(hash, target string) bool {
-	return hash[:len(target)] == target
+	NewMiner(1).Solve(context.Background(), b)
 }
 
 func (b *Block) Validate(previousBlock *Block) error {
-	expectedHash := b.calculateHash()
+	headerBytes, err := b.Header.Serialize()
+	if err != nil {
+		return ruleError(ErrBadBlockHash, "malformed block header: %v", err)
+	}
+	
+	expectedHash := hashHeader(headerBytes)
 	if b.Header.Hash != expectedHash {
-		return fmt.Errorf("invalid block hash")
+		return ruleError(ErrBadBlockHash, "invalid block hash")
+	}
+	
+	if err := checkProofOfWork(b.Header.Hash, b.Header.Difficulty); err != nil {
+		return err
 	}
 	
 	if previousBlock != nil {
 		if b.Header.PreviousHash != previousBlock.Header.Hash {
-			return fmt.Errorf("invalid previous hash")
+			return ruleError(ErrBadPrevHash, "invalid previous hash")
 		}
 	
 		if b.Header.Height != previousBlock.Header.Height+1 {
-			return fmt.Errorf("invalid block height")
+			return ruleError(ErrBadHeight, "invalid block height")
 		}
 	}
 	
-	expectedMerkleRoot := b.calculateMerkleRoot()
+	if len(b.Transactions) > MaxBlockTransactions {
+		return ruleError(ErrTooManyTransactions, "block has %d transactions, limit is %d", len(b.Transactions), MaxBlockTransactions)
+	}
+	
+	if size := b.GetSize(); size > MaxBlockSize {
+		return ruleError(ErrBlockTooBig, "block is %d bytes, limit is %d", size, MaxBlockSize)
+	}
+	
+	// A mutated list, one that repeats trailing transactions, has the same
+	// merkle root and so the same block hash as the list the miner built.
+	// It is rejected without any record of the hash, leaving the genuine
+	// block free to be accepted when it arrives
+	expectedMerkleRoot, mutated := merkle.RootMutated(b.transactionIDs())
+	if mutated {
+		return ruleError(ErrMutatedBlock, "block transaction list is mutated: it repeats transactions under the same merkle root")
+	}
+	
 	if b.Header.MerkleRoot != expectedMerkleRoot {
-		return fmt.Errorf("invalid merkle root")
+		return ruleError(ErrBadMerkleRoot, "invalid merkle root")
 	}
 	
 
 	if len(b.Transactions) == 0 {
-		return fmt.Errorf("block must contain at least one transaction")
+		return ruleError(ErrNoTransactions, "block must contain at least one transaction")
 	}
 	
 	
 	if !b.Transactions[0].IsCoinbase() {
-		return fmt.Errorf("first transaction must be coinbase")
+		return ruleError(ErrFirstTxNotCoinbase, "first transaction must be coinbase")
+	}
+	
+	if b.Transactions[0].Height != b.Header.Height {
+		return ruleError(ErrBadCoinbaseHeight, "coinbase height %d does not match block height %d", b.Transactions[0].Height, b.Header.Height)
 	}
 	
 
 	coinbaseCount := 0
+	seen := make(map[string]bool, len(b.Transactions))
 	for _, tx := range b.Transactions {
 		if tx.IsCoinbase() {
 			coinbaseCount++
 		}
 		
+		if seen[tx.ID] {
+			return ruleError(ErrDuplicateTx, "block contains transaction %s more than once", tx.ID)
+		}
+		seen[tx.ID] = true
+		
 		if err := tx.Validate(); err != nil {
-			return fmt.Errorf("invalid transaction: %v", err)
+			code := ErrInvalidTransaction
+			var ruleErr RuleError
+			if errors.As(err, &ruleErr) {
+				code = ruleErr.Code
+			}
+			return ruleError(code, "invalid transaction %s: %v", tx.ID, err)
 		}
 	}
 	
 	if coinbaseCount != 1 {
-		return fmt.Errorf("block must contain exactly one coinbase transaction")
+		return ruleError(ErrMultipleCoinbases, "block must contain exactly one coinbase transaction")
+	}
+	
+	// Transaction IDs leave signatures out of the merkle root, so the coinbase
+	// commits to them instead
+	commitment := b.Transactions[0].WitnessCommitment
+	if len(b.Transactions) > 1 || commitment != "" {
+		if expected := b.calculateWitnessRoot(); commitment != expected {
+			return ruleError(ErrBadWitnessCommitment, "coinbase witness commitment %q does not match witness root %s", commitment, expected)
+		}
 	}
 	
 	return nil
 }
 
 
+// GetSize returns the length of the binary encoding, which the block size
+// limit is measured on.
 func (b *Block) GetSize() int {
-	data, _ := b.Serialize()
+	data, _ := b.SerializeBinary()
 	return len(data)
 }
 
+// Serialize encodes the block as JSON. See SerializeBinary for the wire format.
 func (b *Block) Serialize() ([]byte, error) {
 	return json.Marshal(b)
 }
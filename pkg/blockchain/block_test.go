@@ -0,0 +1,88 @@
+package blockchain
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBlockValidateLimits(t *testing.T) {
+	genesis := NewGenesisBlock(&RegTestParams)
+
+	// block returns a mined block on genesis holding n transactions after
+	// its coinbase, each paying address. The size limits are checked before
+	// the merkle root, so the root is left empty
+	block := func(n int, address string) *Block {
+		transactions := []Transaction{*NewCoinbaseTransaction("miner", 50, 1)}
+		for i := 0; i < n; i++ {
+			tx := NewTransaction([]TxInput{{TxID: zeroHash, OutputIndex: i}}, []TxOutput{{Value: 1, Address: address}})
+			transactions = append(transactions, *tx)
+		}
+		b := &Block{
+			Header:       BlockHeader{PreviousHash: genesis.Header.Hash, Timestamp: genesis.Header.Timestamp + 1, Height: 1},
+			Transactions: transactions,
+		}
+		b.Mine(PowLimitBits)
+		return b
+	}
+
+	// Each large transaction is under the transaction size limit, but three
+	// of them are over the block's
+	large := strings.Repeat("b", MaxBlockSize/3)
+
+	tests := []struct {
+		name     string
+		block    *Block
+		wantCode ErrorCode
+	}{
+		{"transactions at the limit", block(MaxBlockTransactions-1, "bob"), ErrBadMerkleRoot},
+		{"too many transactions", block(MaxBlockTransactions, "bob"), ErrTooManyTransactions},
+		{"size at the limit", block(2, large), ErrBadMerkleRoot},
+		{"too big", block(3, large), ErrBlockTooBig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ruleErr RuleError
+			if err := tt.block.Validate(genesis); !errors.As(err, &ruleErr) || ruleErr.Code != tt.wantCode {
+				t.Errorf("Validate = %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestProcessBlockRejectsMutatedTransactionList(t *testing.T) {
+	bc, _ := newTestChain(t)
+	key := newTestKey(t)
+	mineBlocks(t, bc, key.address, 1)
+	prev := fund(bc, key.address, 5000, 6000)
+
+	// Two spends make three transactions, an odd count whose last can be
+	// repeated without changing the merkle root
+	var txs []Transaction
+	for i := range prev.Outputs {
+		tx := NewTransaction([]TxInput{{TxID: prev.ID, OutputIndex: i}}, []TxOutput{{Value: prev.Outputs[i].Value, Address: key.address}})
+		key.signInput(t, tx, 0, output(prev, i))
+		txs = append(txs, *tx)
+	}
+	block := childBlock(bc.GetLatestBlock(), key.address, 50, txs...)
+
+	mutated := *block
+	mutated.Transactions = append(append([]Transaction(nil), block.Transactions...), block.Transactions[len(block.Transactions)-1])
+	if got := mutated.calculateMerkleRoot(); got != block.Header.MerkleRoot {
+		t.Fatalf("mutated merkle root %s differs from the block's %s", got, block.Header.MerkleRoot)
+	}
+
+	var ruleErr RuleError
+	if err := bc.SubmitBlock(&mutated); !errors.As(err, &ruleErr) || ruleErr.Code != ErrMutatedBlock {
+		t.Fatalf("SubmitBlock of the mutated block = %v, want %s", err, ErrMutatedBlock)
+	}
+
+	// The hash was not marked invalid, so the genuine block still connects
+	if err := bc.SubmitBlock(block); err != nil {
+		t.Fatalf("SubmitBlock of the genuine block: %v", err)
+	}
+	if tip := bc.GetLatestBlock().Header.Hash; tip != block.Header.Hash {
+		t.Errorf("tip is %s, want %s", tip, block.Header.Hash)
+	}
+}
@@ -1,60 +1,238 @@
 package blockchain
 
 import (
+	"blockchain-node/pkg/merkle"
+	"context"
 	"errors"
 	"fmt"
+	"math/big"
 	"sync"
 )
 
 type Blockchain struct {
-	blocks     []*Block
-	difficulty uint32
-	mutex      sync.RWMutex
-	utxoSet    map[string][]TxOutput 
+	index        map[string]*blockNode
+	bestChain    []*blockNode
+	undo         map[string][]UTXO
+	params       *ChainParams
+	clock        Clock
+	assumedValid map[string]bool // blocks whose signatures ImportBlocks trusts
+	tipChanged   chan struct{}   // closed when the tip changes, see TipChanged
+	orphans      *orphanPool
+	mutex        sync.RWMutex
+	utxoSet      *UTXOSet
+
+	subscribers   []func(Notification) // see Subscribe
+	notifications []Notification       // queued for delivery after the chain lock is released
+	notifyMutex   sync.Mutex           // serializes delivery
 }
 
+// NewBlockchain starts a mainnet chain.
 func NewBlockchain() *Blockchain {
-	genesis := NewGenesisBlock()
+	params := MainNetParams
+	bc, err := NewBlockchainWithParams(&params)
+	if err != nil {
+		panic(fmt.Sprintf("invalid mainnet parameters: %v", err))
+	}
+	return bc
+}
+
+// NewBlockchainWithParams starts a chain with params, which must pass
+// ChainParams.Validate.
+func NewBlockchainWithParams(params *ChainParams) (*Blockchain, error) {
+	if err := params.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s parameters: %v", params.Name, err)
+	}
+	
+	genesis := NewGenesisBlock(params)
+	for _, checkpoint := range params.Checkpoints {
+		if checkpoint.Height == 0 && checkpoint.Hash != genesis.Header.Hash {
+			return nil, fmt.Errorf("%s genesis block %s does not match checkpoint %s", params.Name, genesis.Header.Hash, checkpoint.Hash)
+		}
+	}
+	
+	genesisNode := newBlockNode(genesis, nil)
+	genesisNode.status = statusConnected
 	
 	bc := &Blockchain{
-		blocks:     []*Block{genesis},
-		difficulty: 4, 
-		utxoSet:    make(map[string][]TxOutput),
+		index:      map[string]*blockNode{genesis.Header.Hash: genesisNode},
+		bestChain:  []*blockNode{genesisNode},
+		undo:       make(map[string][]UTXO),
+		params:     params,
+		clock:      systemClock{},
+		tipChanged: make(chan struct{}),
+		orphans:    newOrphanPool(),
+		utxoSet:    NewUTXOSet(),
 	}
 	
-	bc.updateUTXOSet(genesis)
+	bc.undo[genesis.Header.Hash] = bc.updateUTXOSet(genesis)
 	
-	return bc
+	return bc, nil
 }
 
-func (bc *Blockchain) AddBlock(transactions []Transaction) error {
+// Params returns the chain's parameters. Callers must not modify them.
+func (bc *Blockchain) Params() *ChainParams {
+	return bc.params
+}
+
+// SetClock replaces the clock block timestamps are checked against and
+// stamped from.
+func (bc *Blockchain) SetClock(clock Clock) {
 	bc.mutex.Lock()
 	defer bc.mutex.Unlock()
 	
-	lastBlock := bc.blocks[len(bc.blocks)-1]
+	bc.clock = clock
+}
+
+// AddBlock mines a block on the current tip containing exactly transactions.
+func (bc *Blockchain) AddBlock(transactions []Transaction) error {
+	_, err := bc.mine(context.Background(), NewMiner(0), func(tip *blockNode) *Block {
+		return NewBlock(transactions, tip.hash, tip.height+1)
+	})
+	return err
+}
+
+// MineBlock mines a block on the current tip containing transactions, preceded
+// by a coinbase paying the block subsidy plus the transactions' fees to minerAddress.
+func (bc *Blockchain) MineBlock(minerAddress string, transactions []Transaction) (*Block, error) {
+	return bc.MineBlockContext(context.Background(), NewMiner(0), minerAddress, transactions)
+}
+
+// MineBlockContext is MineBlock searching with miner until ctx is done.
+func (bc *Blockchain) MineBlockContext(ctx context.Context, miner *Miner, minerAddress string, transactions []Transaction) (*Block, error) {
+	return bc.mine(ctx, miner, func(tip *blockNode) *Block {
+		return bc.newCoinbaseBlock(tip, minerAddress, transactions)
+	})
+}
+
+// BuildBlock returns an unsolved block on the current tip for a miner to
+// search for proof of work: transactions, preceded by a coinbase paying the
+// block subsidy plus their fees to minerAddress, with the timestamp and
+// difficulty set. The transactions are checked against the UTXO set, without
+// running scripts, so a block built from a stale selection is refused rather
+// than mined, with a TxError naming the first transaction refused.
+func (bc *Blockchain) BuildBlock(minerAddress string, transactions []Transaction) (*Block, error) {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
 	
-	newBlock := NewBlock(transactions, lastBlock.Header.Hash, lastBlock.Header.Height+1)
+	tip := bc.tip()
+	block := bc.newCoinbaseBlock(tip, minerAddress, transactions)
+	block.Header.Timestamp = bc.nextBlockTime(tip)
+	block.Header.Difficulty = bc.calcNextRequiredDifficulty(tip)
 	
-	newBlock.Mine(bc.difficulty)
+	if len(block.Transactions) > MaxBlockTransactions {
+		return nil, ruleError(ErrTooManyTransactions, "block has %d transactions, limit is %d", len(block.Transactions), MaxBlockTransactions)
+	}
+	
+	if size := block.GetSize(); size > MaxBlockSize {
+		return nil, ruleError(ErrBlockTooBig, "block is %d bytes, limit is %d", size, MaxBlockSize)
+	}
 	
-	if err := newBlock.Validate(lastBlock); err != nil {
-		return fmt.Errorf("block validation failed: %v", err)
+	if err := bc.validateTransactions(block, false); err != nil {
+		return nil, err
 	}
 	
+	return block, nil
+}
+
+// newCoinbaseBlock assembles a block on tip containing transactions, preceded
+// by a coinbase paying the block subsidy plus their fees to minerAddress. Must
+// be called with the chain lock held.
+func (bc *Blockchain) newCoinbaseBlock(tip *blockNode, minerAddress string, transactions []Transaction) *Block {
+	height := tip.height + 1
+	
+	reward := CalcBlockSubsidy(height, bc.params) + bc.calcFees(transactions)
+	coinbase := NewCoinbaseTransaction(minerAddress, reward, height)
+	
+	return NewBlock(append([]Transaction{*coinbase}, transactions...), tip.hash, height)
+}
 
-	if err := bc.validateTransactions(newBlock); err != nil {
-		return fmt.Errorf("transaction validation failed: %v", err)
+// mine builds a block on the tip with build, which is called with the read
+// lock held, then searches for its proof of work with the lock released so
+// readers are not blocked. If the tip changes during the search the block
+// is stale, so it is rebuilt on the new tip and the search starts over.
+func (bc *Blockchain) mine(ctx context.Context, miner *Miner, build func(tip *blockNode) *Block) (*Block, error) {
+	for {
+		bc.mutex.RLock()
+		tip := bc.tip()
+		block := build(tip)
+		block.Header.Timestamp = bc.nextBlockTime(tip)
+		block.Header.Difficulty = bc.calcNextRequiredDifficulty(tip)
+		tipChanged := bc.tipChanged
+		bc.mutex.RUnlock()
+		
+		searchCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-tipChanged:
+				cancel()
+			case <-searchCtx.Done():
+			}
+		}()
+		
+		err := miner.Solve(searchCtx, block)
+		cancel()
+		
+		if err != nil {
+			if errors.Is(err, context.Canceled) && ctx.Err() == nil {
+				continue
+			}
+			return nil, err
+		}
+		
+		if err := bc.SubmitBlock(block); err != nil {
+			return nil, err
+		}
+		
+		return block, nil
 	}
+}
+
+// TipChanged returns a channel that is closed the next time the active
+// chain's tip changes.
+func (bc *Blockchain) TipChanged() <-chan struct{} {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
 	
+	return bc.tipChanged
+}
+
+// notifyTipChanged wakes everyone waiting on TipChanged. Must be called with
+// the chain lock held.
+func (bc *Blockchain) notifyTipChanged() {
+	close(bc.tipChanged)
+	bc.tipChanged = make(chan struct{})
+}
+
+// nextBlockTime returns the timestamp for a block mined on parent: the
+// current time, pushed past the median time past when the clock lags it.
+func (bc *Blockchain) nextBlockTime(parent *blockNode) int64 {
+	timestamp := bc.clock.Now().Unix()
+	if minTime := parent.medianTimePast(bc.params.MedianTimeBlocks) + 1; timestamp < minTime {
+		timestamp = minTime
+	}
+	return timestamp
+}
+
+// SubmitBlock validates and connects a block produced by this node, such as
+// one it mined. There is no peer to charge an orphan to, so a block whose
+// parent is unknown is rejected with ErrOrphanBlock rather than held; blocks
+// from the network go through ProcessBlock with their source instead.
+// Orphans waiting on the block are connected after it.
+func (bc *Blockchain) SubmitBlock(block *Block) error {
+	if block == nil {
+		return errors.New("block cannot be nil")
+	}
 	
-	bc.blocks = append(bc.blocks, newBlock)
+	defer bc.deliverNotifications()
 	
-	bc.updateUTXOSet(newBlock)
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
 	
-	if newBlock.Header.Height%10 == 0 {
-		bc.adjustDifficulty()
+	if err := bc.processBlock(block); err != nil {
+		return err
 	}
 	
+	bc.processOrphans(block.Header.Hash)
 	return nil
 }
 
@@ -63,10 +241,10 @@ func (bc *Blockchain) GetLatestBlock() *Block {
 	bc.mutex.RLock()
 	defer bc.mutex.RUnlock()
 	
-	if len(bc.blocks) == 0 {
+	if len(bc.bestChain) == 0 {
 		return nil
 	}
-	return bc.blocks[len(bc.blocks)-1]
+	return bc.tip().block
 }
 
 
@@ -74,11 +252,11 @@ func (bc *Blockchain) GetBlock(height int64) (*Block, error) {
 	bc.mutex.RLock()
 	defer bc.mutex.RUnlock()
 	
-	if height < 0 || height >= int64(len(bc.blocks)) {
+	if height < 0 || height >= int64(len(bc.bestChain)) {
 		return nil, errors.New("block height out of range")
 	}
 	
-	return bc.blocks[height], nil
+	return bc.bestChain[height].block, nil
 }
 
 
@@ -86,13 +264,12 @@ func (bc *Blockchain) GetBlockByHash(hash string) (*Block, error) {
 	bc.mutex.RLock()
 	defer bc.mutex.RUnlock()
 	
-	for _, block := range bc.blocks {
-		if block.Header.Hash == hash {
-			return block, nil
-		}
+	node, exists := bc.index[hash]
+	if !exists {
+		return nil, errors.New("block not found")
 	}
 	
-	return nil, errors.New("block not found")
+	return node.block, nil
 }
 
 
@@ -100,7 +277,24 @@ func (bc *Blockchain) GetHeight() int64 {
 	bc.mutex.RLock()
 	defer bc.mutex.RUnlock()
 	
-	return int64(len(bc.blocks) - 1)
+	return int64(len(bc.bestChain) - 1)
+}
+
+
+func (bc *Blockchain) GetChainWork() *big.Int {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+	
+	return new(big.Int).Set(bc.tip().chainWork)
+}
+
+
+// GetMedianTimePast returns the time a block extending the tip must be stamped after.
+func (bc *Blockchain) GetMedianTimePast() int64 {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+	
+	return bc.tip().medianTimePast(bc.params.MedianTimeBlocks)
 }
 
 
@@ -108,7 +302,34 @@ func (bc *Blockchain) GetDifficulty() uint32 {
 	bc.mutex.RLock()
 	defer bc.mutex.RUnlock()
 	
-	return bc.difficulty
+	return bc.calcNextRequiredDifficulty(bc.tip())
+}
+
+
+// EstimateHashRate returns the average hashes per second over the last
+// window blocks of the active chain, derived from their proof of work.
+func (bc *Blockchain) EstimateHashRate(window int) float64 {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+	
+	if window < 1 || len(bc.bestChain) < 2 {
+		return 0
+	}
+	if window > len(bc.bestChain)-1 {
+		window = len(bc.bestChain) - 1
+	}
+	
+	last := bc.tip()
+	first := bc.bestChain[len(bc.bestChain)-1-window]
+	
+	timeSpan := last.block.Header.Timestamp - first.block.Header.Timestamp
+	if timeSpan <= 0 {
+		return 0
+	}
+	
+	work := new(big.Int).Sub(last.chainWork, first.chainWork)
+	hashRate, _ := new(big.Rat).SetFrac(work, big.NewInt(timeSpan)).Float64()
+	return hashRate
 }
 
 
@@ -116,9 +337,19 @@ func (bc *Blockchain) ValidateChain() error {
 	bc.mutex.RLock()
 	defer bc.mutex.RUnlock()
 	
-	for i := 1; i < len(bc.blocks); i++ {
-		currentBlock := bc.blocks[i]
-		previousBlock := bc.blocks[i-1]
+	// Blocks up to the latest checkpoint are pinned by its hash, so only
+	// the blocks above it are revalidated
+	start := 1
+	if checkpoint, exists := bc.latestCheckpoint(); exists {
+		if hash := bc.bestChain[checkpoint.Height].hash; hash != checkpoint.Hash {
+			return fmt.Errorf("block %d hash %s does not match checkpoint %s", checkpoint.Height, hash, checkpoint.Hash)
+		}
+		start = int(checkpoint.Height) + 1
+	}
+	
+	for i := start; i < len(bc.bestChain); i++ {
+		currentBlock := bc.bestChain[i].block
+		previousBlock := bc.bestChain[i-1].block
 		
 		if err := currentBlock.Validate(previousBlock); err != nil {
 			return fmt.Errorf("block %d validation failed: %v", i, err)
@@ -132,157 +363,409 @@ func (bc *Blockchain) GetBalance(address string) int64 {
 	bc.mutex.RLock()
 	defer bc.mutex.RUnlock()
 	
-	var balance int64
-	
+	return bc.utxoSet.Balance(address)
+}
 
-	if outputs, exists := bc.utxoSet[address]; exists {
-		for _, output := range outputs {
-			balance += output.Value
-		}
-	}
+
+func (bc *Blockchain) FindUTXO(address string) []UTXO {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
 	
-	return balance
+	return bc.utxoSet.FindByAddress(address)
 }
 
-
-func (bc *Blockchain) FindUTXO(address string) []TxOutput {
+// FindSpendableUTXO returns the address's unspent outputs that a transaction
+// in the next block may spend, leaving out immature coinbase outputs.
+func (bc *Blockchain) FindSpendableUTXO(address string) []UTXO {
 	bc.mutex.RLock()
 	defer bc.mutex.RUnlock()
 	
-	if outputs, exists := bc.utxoSet[address]; exists {
-		result := make([]TxOutput, len(outputs))
-		copy(result, outputs)
-		return result
+	spendHeight := bc.tip().height + 1
+	
+	var result []UTXO
+	for _, entry := range bc.utxoSet.FindByAddress(address) {
+		if entry.IsMature(spendHeight, bc.params.CoinbaseMaturity) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// SpentOutputs reports whether an output is already spent by a transaction
+// waiting to be mined. The mempool implements it.
+type SpentOutputs interface {
+	IsSpent(op OutPoint) bool
+}
+
+// FindAvailableUTXO returns the outputs FindSpendableUTXO does, leaving out
+// those pending already spends so that a new transaction does not conflict
+// with one waiting to be mined. pending may be nil.
+func (bc *Blockchain) FindAvailableUTXO(address string, pending SpentOutputs) []UTXO {
+	utxos := bc.FindSpendableUTXO(address)
+	if pending == nil {
+		return utxos
 	}
 	
-	return []TxOutput{}
+	var result []UTXO
+	for _, entry := range utxos {
+		if !pending.IsSpent(entry.OutPoint) {
+			result = append(result, entry)
+		}
+	}
+	return result
 }
 
-func (bc *Blockchain) CreateTransaction(from, to string, amount int64) (*Transaction, error) {
+// AddressBalance breaks an address's unspent value down by spendability.
+// Mature and Immature only count coinbase outputs; Spendable counts every
+// output a transaction in the next block may spend.
+type AddressBalance struct {
+	Total     int64 `json:"total"`
+	Spendable int64 `json:"spendable"`
+	Mature    int64 `json:"mature"`
+	Immature  int64 `json:"immature"`
+}
+
+func (bc *Blockchain) GetBalanceDetails(address string) AddressBalance {
 	bc.mutex.RLock()
 	defer bc.mutex.RUnlock()
 	
-	utxos := bc.FindUTXO(from)
-	var totalInput int64
-	var inputs []TxInput
+	spendHeight := bc.tip().height + 1
 	
-	for _, utxo := range utxos {
-		if totalInput >= amount {
-			break
+	var balance AddressBalance
+	for _, entry := range bc.utxoSet.FindByAddress(address) {
+		balance.Total += entry.Value
+		
+		mature := entry.IsMature(spendHeight, bc.params.CoinbaseMaturity)
+		if mature {
+			balance.Spendable += entry.Value
 		}
 		
-		input := TxInput{
-			TxID:        "", 
-			OutputIndex: 0, 
-			PublicKey:   from,
+		if entry.IsCoinbase {
+			if mature {
+				balance.Mature += entry.Value
+			} else {
+				balance.Immature += entry.Value
+			}
 		}
-		inputs = append(inputs, input)
-		totalInput += utxo.Value
 	}
+	return balance
+}
+
+func (bc *Blockchain) GetUTXO(txID string, outputIndex int) (*UTXO, error) {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
 	
-	if totalInput < amount {
-		return nil, errors.New("insufficient funds")
+	entry, exists := bc.utxoSet.Get(OutPoint{TxID: txID, Index: outputIndex})
+	if !exists {
+		return nil, errors.New("output not found or already spent")
 	}
 	
+	result := *entry
+	return &result, nil
+}
 
-	outputs := []TxOutput{
-		{Value: amount, Address: to},
-	}
-	
-	
-	if totalInput > amount {
-		change := totalInput - amount
-		outputs = append(outputs, TxOutput{Value: change, Address: from})
+// CreateTransaction builds an unsigned transaction paying amount to to, with
+// change back to from. The fee paid is the larger of fee and feeRate times the
+// estimated signed size; zero for either leaves it unused. Outputs pending
+// already spends, if it is not nil, are not selected.
+func (bc *Blockchain) CreateTransaction(from, to string, amount, fee, feeRate int64, pending SpentOutputs) (*Transaction, error) {
+	utxos := bc.FindAvailableUTXO(from, pending)
+	
+	transaction, _, err := NewTxBuilder(utxos, from).AddOutput(to, amount).SetFee(fee).SetFeeRate(feeRate).Build()
+	if err != nil {
+		return nil, err
 	}
 	
-	transaction := NewTransaction(inputs, outputs)
 	return transaction, nil
 }
 
 
-func (bc *Blockchain) validateTransactions(block *Block) error {
+// calcFees sums the fees of transactions, resolving inputs against the UTXO
+// set and outputs created earlier in the list. Transactions whose inputs
+// cannot be resolved are skipped; block validation rejects them anyway.
+func (bc *Blockchain) calcFees(transactions []Transaction) int64 {
+	view := newBlockView(bc.utxoSet)
+	var fees int64
+	
+	for _, tx := range transactions {
+		if fee, err := tx.GetFee(view); err == nil && fee > 0 {
+			fees += fee
+		}
+		
+		view.addOutputs(&tx, 0)
+	}
+	
+	return fees
+}
+
+// validateTransactions checks the block's transactions against the UTXO set.
+// Input scripts are only run when checkSignatures is set. The block must
+// extend the current tip. A failure of one transaction is returned as a
+// TxError naming it.
+func (bc *Blockchain) validateTransactions(block *Block, checkSignatures bool) error {
+	view := newBlockView(bc.utxoSet)
+	spent := make(map[OutPoint]string)
+	var totalFees int64
+	
+	blockTime := bc.tip().medianTimePast(bc.params.MedianTimeBlocks)
+	
 	for i, tx := range block.Transactions {
-		if i == 0 {
-			continue
+		for j := range tx.Outputs {
+			op := OutPoint{TxID: tx.ID, Index: j}
+			if _, exists := view.Get(op); exists {
+				return txError(i, &tx, ruleError(ErrDuplicateTx, "transaction %s overwrites unspent output %s", tx.ID, op))
+			}
+		}
+		
+		if err := bc.checkLockTimes(&tx, view, block.Header.Height, blockTime); err != nil {
+			return txError(i, &tx, err)
 		}
 		
-		for _, input := range tx.Inputs {
-			if !bc.isValidInput(input) {
-				return fmt.Errorf("invalid input in transaction %s", tx.ID)
+		if i != 0 {
+			for j, input := range tx.Inputs {
+				op := OutPoint{TxID: input.TxID, Index: input.OutputIndex}
+				
+				if spender, exists := spent[op]; exists {
+					return txError(i, &tx, ruleError(ErrDoubleSpend, "transaction %s input %d spends %s already spent by %s", tx.ID, j, op, spender))
+				}
+				
+				entry, exists := view.Get(op)
+				if !exists {
+					return txError(i, &tx, ruleError(ErrMissingInput, "transaction %s input %d references missing or spent output %s", tx.ID, j, op))
+				}
+				
+				if !entry.IsMature(block.Header.Height, bc.params.CoinbaseMaturity) {
+					return txError(i, &tx, ruleError(ErrImmatureSpend, "transaction %s input %d spends coinbase output %s from height %d, which needs %d confirmations", tx.ID, j, op, entry.Height, bc.params.CoinbaseMaturity))
+				}
+				
+				if checkSignatures {
+					if err := VerifyScript(&tx, j, entry); err != nil {
+						return txError(i, &tx, ruleError(ErrScriptFailed, "transaction %s input %d: %v", tx.ID, j, err))
+					}
+				}
+				
+				spent[op] = tx.ID
+			}
+			
+			fee, err := tx.GetFee(view)
+			if err != nil {
+				return txError(i, &tx, err)
+			}
+			if fee < 0 {
+				return txError(i, &tx, ruleError(ErrSpendTooHigh, "transaction %s has negative fee: outputs exceed inputs by %d", tx.ID, -fee))
+			}
+			if totalFees += fee; totalFees > MaxMoney {
+				return txError(i, &tx, ruleError(ErrBadInputValue, "block fees total more than %d", MaxMoney))
 			}
 		}
+		
+		view.addOutputs(&tx, block.Header.Height)
+	}
+	
+	subsidy := CalcBlockSubsidy(block.Header.Height, bc.params)
+	if coinbaseValue := block.Transactions[0].GetTotalOutput(); coinbaseValue > subsidy+totalFees {
+		return ruleError(ErrBadCoinbaseValue, "coinbase pays %d but subsidy plus fees is only %d", coinbaseValue, subsidy+totalFees)
 	}
 	
 	return nil
 }
-func (bc *Blockchain) isValidInput(input TxInput) bool {
-	return true
-}
 
-func (bc *Blockchain) updateUTXOSet(block *Block) {
+func (bc *Blockchain) updateUTXOSet(block *Block) []UTXO {
+	var spent []UTXO
+	
 	for _, tx := range block.Transactions {
 		if !tx.IsCoinbase() {
 			for _, input := range tx.Inputs {
-				if outputs, exists := bc.utxoSet[input.PublicKey]; exists {
-					if len(outputs) > 0 {
-						bc.utxoSet[input.PublicKey] = outputs[1:]
-						if len(bc.utxoSet[input.PublicKey]) == 0 {
-							delete(bc.utxoSet, input.PublicKey)
-						}
-					}
+				if entry, exists := bc.utxoSet.Spend(OutPoint{TxID: input.TxID, Index: input.OutputIndex}); exists {
+					spent = append(spent, *entry)
 				}
 			}
 		}
 		
-		for _, output := range tx.Outputs {
-			bc.utxoSet[output.Address] = append(bc.utxoSet[output.Address], output)
+		for i, output := range tx.Outputs {
+			bc.utxoSet.Add(&UTXO{
+				OutPoint:      OutPoint{TxID: tx.ID, Index: i},
+				Value:         output.Value,
+				Address:       output.Address,
+				LockingScript: output.LockingScript,
+				Height:        block.Header.Height,
+				IsCoinbase:    tx.IsCoinbase(),
+			})
 		}
 	}
+	
+	return spent
 }
 
-func (bc *Blockchain) adjustDifficulty() {
-	if len(bc.blocks) < 2 {
-		return
-	}
-	
-	lastBlock := bc.blocks[len(bc.blocks)-1]
-	prevBlock := bc.blocks[len(bc.blocks)-2]
+func (bc *Blockchain) GetAllBlocks() []*Block {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
 	
-	timeDiff := lastBlock.Header.Timestamp - prevBlock.Header.Timestamp
+	result := make([]*Block, len(bc.bestChain))
+	for i, node := range bc.bestChain {
+		result[i] = node.block
+	}
+	return result
+}
+
+func (bc *Blockchain) GetTransactionByID(txID string) (*Transaction, error) {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
 	
-	if timeDiff < 30 { 
-		bc.difficulty++
-	} else if timeDiff > 60 && bc.difficulty > 1 {
-		bc.difficulty--
+	tx, _, _ := bc.findTransaction(txID)
+	if tx == nil {
+		return nil, errors.New("transaction not found")
 	}
+	
+	return tx, nil
 }
 
+// TransactionDetails is a confirmed transaction together with where it was
+// confirmed and the value flowing through it.
+type TransactionDetails struct {
+	Transaction
+	WitnessHash string `json:"witness_hash"`
+	BlockHash   string `json:"block_hash"`
+	BlockHeight int64  `json:"block_height"`
+	TotalInput  int64  `json:"total_input"`
+	TotalOutput int64  `json:"total_output"`
+	Fee         int64  `json:"fee"`
+}
 
-func (bc *Blockchain) GetAllBlocks() []*Block {
+// GetTransactionDetails returns a confirmed transaction with its inputs
+// resolved against the outputs they spent, which are usually no longer in
+// the UTXO set but are kept in its block's undo data.
+func (bc *Blockchain) GetTransactionDetails(txID string) (*TransactionDetails, error) {
 	bc.mutex.RLock()
 	defer bc.mutex.RUnlock()
 	
-	result := make([]*Block, len(bc.blocks))
-	copy(result, bc.blocks)
-	return result
+	tx, node, index := bc.findTransaction(txID)
+	if tx == nil {
+		return nil, errors.New("transaction not found")
+	}
+	
+	view := bc.spentOutputs(node, index)
+	
+	totalInput, err := tx.GetTotalInput(view)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve inputs: %v", err)
+	}
+	
+	fee, err := tx.GetFee(view)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve inputs: %v", err)
+	}
+	
+	return &TransactionDetails{
+		Transaction: *tx,
+		WitnessHash: tx.WitnessHash(),
+		BlockHash:   node.hash,
+		BlockHeight: node.height,
+		TotalInput:  totalInput,
+		TotalOutput: tx.GetTotalOutput(),
+		Fee:         fee,
+	}, nil
 }
 
-func (bc *Blockchain) GetTransactionByID(txID string) (*Transaction, error) {
+// TransactionProof shows that a transaction is included in a block of the
+// active chain, checkable against that block's header alone.
+type TransactionProof struct {
+	TxID        string        `json:"txid"`
+	BlockHash   string        `json:"block_hash"`
+	BlockHeight int64         `json:"block_height"`
+	MerkleRoot  string        `json:"merkle_root"`
+	Proof       *merkle.Proof `json:"proof"`
+}
+
+// GetTransactionProof returns a merkle inclusion proof for a confirmed
+// transaction.
+func (bc *Blockchain) GetTransactionProof(txID string) (*TransactionProof, error) {
 	bc.mutex.RLock()
 	defer bc.mutex.RUnlock()
 	
-	for _, block := range bc.blocks {
-		for _, tx := range block.Transactions {
+	tx, node, index := bc.findTransaction(txID)
+	if tx == nil {
+		return nil, errors.New("transaction not found")
+	}
+	
+	txIDs := make([]string, len(node.block.Transactions))
+	for i, blockTx := range node.block.Transactions {
+		txIDs[i] = blockTx.ID
+	}
+	
+	proof, err := merkle.NewProof(txIDs, index)
+	if err != nil {
+		return nil, err
+	}
+	
+	return &TransactionProof{
+		TxID:        txID,
+		BlockHash:   node.hash,
+		BlockHeight: node.height,
+		MerkleRoot:  node.block.Header.MerkleRoot,
+		Proof:       proof,
+	}, nil
+}
+
+// VerifyTransactionProof reports whether proof shows the transaction is
+// included in the block with the given header. It needs no chain state, so
+// a light client can use it with headers it has already validated.
+func VerifyTransactionProof(header *BlockHeader, txID string, proof *merkle.Proof) bool {
+	return merkle.Verify(txID, proof, header.MerkleRoot)
+}
+
+// findTransaction returns a transaction on the active chain with the block
+// node confirming it and its index in the block.
+func (bc *Blockchain) findTransaction(txID string) (*Transaction, *blockNode, int) {
+	for _, node := range bc.bestChain {
+		for i, tx := range node.block.Transactions {
 			if tx.ID == txID {
-				return &tx, nil
+				return &tx, node, i
 			}
 		}
 	}
 	
-	return nil, errors.New("transaction not found")
+	return nil, nil, 0
+}
+
+// spentOutputs returns the outputs spent by transaction index of the block
+// at node. The block's undo data holds them in input order, transaction by
+// transaction, so they are found without searching the chain. Must be
+// called with the chain lock held.
+func (bc *Blockchain) spentOutputs(node *blockNode, index int) spentView {
+	offset := 0
+	for _, tx := range node.block.Transactions[:index] {
+		if !tx.IsCoinbase() {
+			offset += len(tx.Inputs)
+		}
+	}
+	
+	view := make(spentView)
+	tx := node.block.Transactions[index]
+	if tx.IsCoinbase() {
+		return view
+	}
+	
+	spent := bc.undo[node.hash]
+	for i := range tx.Inputs {
+		if offset+i >= len(spent) {
+			break
+		}
+		entry := spent[offset+i]
+		view[entry.OutPoint] = &entry
+	}
+	return view
+}
+
+// spentView resolves the outpoints a confirmed transaction spent.
+type spentView map[OutPoint]*UTXO
+
+func (v spentView) Get(op OutPoint) (*UTXO, bool) {
+	entry, exists := v[op]
+	return entry, exists
 }
 
 func (bc *Blockchain) String() string {
-	return fmt.Sprintf("Blockchain{Height: %d, Difficulty: %d, Blocks: %d}",
-		bc.GetHeight(), bc.difficulty, len(bc.blocks))
+	return fmt.Sprintf("Blockchain{Height: %d, Difficulty: %08x, Blocks: %d}",
+		bc.GetHeight(), bc.GetDifficulty(), len(bc.index))
 }
\ No newline at end of file
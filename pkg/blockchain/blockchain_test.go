@@ -0,0 +1,258 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateTransactions(t *testing.T) {
+	alice := newTestKey(t)
+	bob := newTestKey(t)
+
+	// spend returns a transaction signed by key spending the given outputs
+	// of prev to bob.
+	spend := func(key *testKey, prev *Transaction, value int64, indexes ...int) Transaction {
+		inputs := make([]TxInput, len(indexes))
+		for i, index := range indexes {
+			inputs[i] = TxInput{TxID: prev.ID, OutputIndex: index}
+		}
+		tx := NewTransaction(inputs, []TxOutput{{Value: value, Address: bob.address}})
+		for i, index := range indexes {
+			key.signInput(t, tx, i, output(prev, index))
+		}
+		tx.SetID()
+		return *tx
+	}
+
+	tests := []struct {
+		name     string
+		txs      func(funding *Transaction) []Transaction
+		wantCode ErrorCode
+		wantErr  bool
+	}{
+		{
+			name: "valid spend",
+			txs: func(funding *Transaction) []Transaction {
+				return []Transaction{spend(alice, funding, 50, 0)}
+			},
+		},
+		{
+			name: "spend of an output created earlier in the block",
+			txs: func(funding *Transaction) []Transaction {
+				first := spend(alice, funding, 50, 0)
+				return []Transaction{first, spend(bob, &first, 40, 0)}
+			},
+		},
+		{
+			name: "missing output",
+			txs: func(funding *Transaction) []Transaction {
+				tx := NewTransaction(
+					[]TxInput{{TxID: funding.ID, OutputIndex: 5}},
+					[]TxOutput{{Value: 50, Address: bob.address}},
+				)
+				return []Transaction{*tx}
+			},
+			wantCode: ErrMissingInput,
+			wantErr:  true,
+		},
+		{
+			name: "output spent twice in the block",
+			txs: func(funding *Transaction) []Transaction {
+				return []Transaction{spend(alice, funding, 50, 0), spend(alice, funding, 40, 0)}
+			},
+			wantCode: ErrDoubleSpend,
+			wantErr:  true,
+		},
+		{
+			name: "output spent twice in a transaction",
+			txs: func(funding *Transaction) []Transaction {
+				return []Transaction{spend(alice, funding, 50, 0, 0)}
+			},
+			wantCode: ErrDoubleSpend,
+			wantErr:  true,
+		},
+		{
+			name: "transaction repeated",
+			txs: func(funding *Transaction) []Transaction {
+				tx := spend(alice, funding, 50, 0)
+				return []Transaction{tx, tx}
+			},
+			wantCode: ErrDuplicateTx,
+			wantErr:  true,
+		},
+		{
+			name: "signed by another key",
+			txs: func(funding *Transaction) []Transaction {
+				return []Transaction{spend(bob, funding, 50, 0)}
+			},
+			wantCode: ErrScriptFailed,
+			wantErr:  true,
+		},
+		{
+			name: "outputs changed after signing",
+			txs: func(funding *Transaction) []Transaction {
+				tx := spend(alice, funding, 50, 0)
+				tx.Outputs[0].Value = 60
+				tx.SetID()
+				return []Transaction{tx}
+			},
+			wantCode: ErrScriptFailed,
+			wantErr:  true,
+		},
+		{
+			name: "outputs over inputs",
+			txs: func(funding *Transaction) []Transaction {
+				return []Transaction{spend(alice, funding, 71, 1)}
+			},
+			wantCode: ErrSpendTooHigh,
+			wantErr:  true,
+		},
+		{
+			name: "outputs over several inputs",
+			txs: func(funding *Transaction) []Transaction {
+				return []Transaction{spend(alice, funding, 121, 0, 1)}
+			},
+			wantCode: ErrSpendTooHigh,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc, _ := newTestChain(t)
+			funding := fund(bc, alice.address, 50, 70)
+
+			coinbase := NewCoinbaseTransaction(alice.address, 50, 2)
+			block := &Block{
+				Header:       BlockHeader{Height: 2},
+				Transactions: append([]Transaction{*coinbase}, tt.txs(funding)...),
+			}
+
+			err := bc.validateTransactions(block, true)
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("validateTransactions = %v, want nil", err)
+				}
+				return
+			}
+
+			var ruleErr RuleError
+			if !errors.As(err, &ruleErr) || ruleErr.Code != tt.wantCode {
+				t.Errorf("validateTransactions = %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestSubmitBlock(t *testing.T) {
+	miner := newTestKey(t)
+
+	tests := []struct {
+		name string
+		// block returns the block to submit on top of the chain's tip
+		block    func(tip *Block) *Block
+		wantCode ErrorCode
+		wantErr  bool
+	}{
+		{
+			name: "valid block",
+			block: func(tip *Block) *Block {
+				return childBlock(tip, miner.address, 50)
+			},
+		},
+		{
+			name: "hash does not match header",
+			block: func(tip *Block) *Block {
+				block := childBlock(tip, miner.address, 50)
+				block.Header.Nonce++
+				return block
+			},
+			wantCode: ErrBadBlockHash,
+			wantErr:  true,
+		},
+		{
+			name: "hash above target",
+			block: func(tip *Block) *Block {
+				block := childBlock(tip, miner.address, 50)
+				target := CompactToBig(block.Header.Difficulty)
+				for HashToBig(block.Header.Hash).Cmp(target) <= 0 {
+					block.Header.Nonce++
+					block.Header.Hash = block.calculateHash()
+				}
+				return block
+			},
+			wantCode: ErrHighHash,
+			wantErr:  true,
+		},
+		{
+			name: "wrong difficulty",
+			block: func(tip *Block) *Block {
+				block := NewBlock([]Transaction{*NewCoinbaseTransaction(miner.address, 50, tip.Header.Height+1)}, tip.Header.Hash, tip.Header.Height+1)
+				block.Header.Timestamp = tip.Header.Timestamp + 1
+				block.Mine(DefaultDifficultyBits)
+				return block
+			},
+			wantCode: ErrBadDifficulty,
+			wantErr:  true,
+		},
+		{
+			name: "coinbase for another height",
+			block: func(tip *Block) *Block {
+				height := tip.Header.Height + 1
+				block := NewBlock([]Transaction{*NewCoinbaseTransaction(miner.address, 50, height+1)}, tip.Header.Hash, height)
+				block.Header.Timestamp = tip.Header.Timestamp + 1
+				block.Mine(tip.Header.Difficulty)
+				return block
+			},
+			wantCode: ErrBadCoinbaseHeight,
+			wantErr:  true,
+		},
+		{
+			name: "unknown parent",
+			block: func(tip *Block) *Block {
+				parent := childBlock(tip, miner.address, 50)
+				return childBlock(parent, miner.address, 51)
+			},
+			wantCode: ErrOrphanBlock,
+			wantErr:  true,
+		},
+		{
+			name: "already known",
+			block: func(tip *Block) *Block {
+				return tip
+			},
+			wantCode: ErrDuplicateBlock,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc, _ := newTestChain(t)
+			tip := childBlock(bc.GetLatestBlock(), miner.address, 49)
+			if err := bc.SubmitBlock(tip); err != nil {
+				t.Fatalf("SubmitBlock(tip): %v", err)
+			}
+
+			block := tt.block(tip)
+			err := bc.SubmitBlock(block)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("SubmitBlock = %v, want nil", err)
+				}
+				if got := bc.GetLatestBlock(); got != block {
+					t.Errorf("tip = %s, want the submitted block %s", got.Header.Hash, block.Header.Hash)
+				}
+				return
+			}
+
+			var ruleErr RuleError
+			if !errors.As(err, &ruleErr) || ruleErr.Code != tt.wantCode {
+				t.Errorf("SubmitBlock = %v, want %s", err, tt.wantCode)
+			}
+			if got := bc.GetLatestBlock(); got != tip {
+				t.Errorf("tip moved to %s after a rejected block", got.Header.Hash)
+			}
+		})
+	}
+}
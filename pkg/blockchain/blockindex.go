@@ -0,0 +1,234 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+type blockStatus int
+
+const (
+	statusValidHeader blockStatus = iota
+	statusConnected
+	statusInvalid
+)
+
+// blockNode is an entry in the block index. Every block that passed header
+// and structure checks gets one, whether or not it is on the active chain.
+type blockNode struct {
+	hash      string
+	parent    *blockNode
+	height    int64
+	chainWork *big.Int
+	status    blockStatus
+	block     *Block
+}
+
+func newBlockNode(block *Block, parent *blockNode) *blockNode {
+	node := &blockNode{
+		hash:      block.Header.Hash,
+		parent:    parent,
+		height:    block.Header.Height,
+		chainWork: CalcWork(block.Header.Difficulty),
+		block:     block,
+	}
+
+	if parent != nil {
+		node.chainWork.Add(node.chainWork, parent.chainWork)
+	}
+
+	return node
+}
+
+// medianTimePast returns the median timestamp of the node and up to count-1
+// of its ancestors.
+func (node *blockNode) medianTimePast(count int) int64 {
+	if count < 1 {
+		count = 1
+	}
+
+	timestamps := make([]int64, 0, count)
+	for n := node; n != nil && len(timestamps) < count; n = n.parent {
+		timestamps = append(timestamps, n.block.Header.Timestamp)
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	})
+
+	return timestamps[len(timestamps)/2]
+}
+
+func (bc *Blockchain) tip() *blockNode {
+	return bc.bestChain[len(bc.bestChain)-1]
+}
+
+func (bc *Blockchain) inBestChain(node *blockNode) bool {
+	return node.height < int64(len(bc.bestChain)) && bc.bestChain[node.height] == node
+}
+
+func (bc *Blockchain) findFork(node *blockNode) *blockNode {
+	for node != nil && !bc.inBestChain(node) {
+		node = node.parent
+	}
+	return node
+}
+
+// processBlock adds a block whose parent is already indexed. The block is
+// connected if it extends the best chain, triggers a reorganization if its
+// branch now has the most cumulative work, and is otherwise kept as a side
+// branch. Must be called with the chain lock held.
+//
+// Only blocks that pass Validate are indexed, and only indexed blocks are
+// ever marked invalid. A block whose transactions were altered in transit
+// without changing its hash, such as a mutated transaction list or
+// tampered signatures, fails Validate, so its hash is not remembered and
+// the genuine block can still be accepted.
+func (bc *Blockchain) processBlock(block *Block) error {
+	if _, exists := bc.index[block.Header.Hash]; exists {
+		return ruleError(ErrDuplicateBlock, "block %s already known", block.Header.Hash)
+	}
+
+	parent, exists := bc.index[block.Header.PreviousHash]
+	if !exists {
+		return ruleError(ErrOrphanBlock, "previous block %s not found", block.Header.PreviousHash)
+	}
+
+	if parent.status == statusInvalid {
+		return ruleError(ErrInvalidAncestor, "block %s builds on invalid block %s", block.Header.Hash, parent.hash)
+	}
+
+	if err := bc.checkCheckpoints(block, parent); err != nil {
+		return err
+	}
+
+	if required := bc.calcNextRequiredDifficulty(parent); block.Header.Difficulty != required {
+		return ruleError(ErrBadDifficulty, "block difficulty %08x does not match required difficulty %08x", block.Header.Difficulty, required)
+	}
+
+	if err := bc.checkBlockTime(block, parent); err != nil {
+		return err
+	}
+
+	if err := block.Validate(parent.block); err != nil {
+		return fmt.Errorf("block validation failed: %w", err)
+	}
+
+	node := newBlockNode(block, parent)
+
+	if parent == bc.tip() {
+		if err := bc.connectBlock(node); err != nil {
+			return err
+		}
+		bc.index[node.hash] = node
+		return nil
+	}
+
+	bc.index[node.hash] = node
+
+	if node.chainWork.Cmp(bc.tip().chainWork) <= 0 {
+		return nil
+	}
+
+	return bc.reorganize(node)
+}
+
+// checkBlockTime requires a block's timestamp to be later than the median
+// time past of its parent and no further ahead of the node's clock than
+// MaxFutureBlockTime.
+func (bc *Blockchain) checkBlockTime(block *Block, parent *blockNode) error {
+	medianTime := parent.medianTimePast(bc.params.MedianTimeBlocks)
+	if block.Header.Timestamp <= medianTime {
+		return ruleError(ErrTimeTooOld, "block timestamp %d is not after median time past %d", block.Header.Timestamp, medianTime)
+	}
+
+	maxTime := bc.clock.Now().Add(bc.params.MaxFutureBlockTime).Unix()
+	if block.Header.Timestamp > maxTime {
+		return ruleError(ErrTimeTooNew, "block timestamp %d is too far in the future, limit is %d", block.Header.Timestamp, maxTime)
+	}
+
+	return nil
+}
+
+func (bc *Blockchain) connectBlock(node *blockNode) error {
+	if err := bc.validateTransactions(node.block, !bc.assumedValid[node.hash]); err != nil {
+		return fmt.Errorf("transaction validation failed: %w", err)
+	}
+
+	bc.undo[node.hash] = bc.updateUTXOSet(node.block)
+	bc.bestChain = append(bc.bestChain, node)
+	node.status = statusConnected
+	bc.notifyTipChanged()
+	bc.queueNotification(NTBlockConnected, node.block)
+
+	return nil
+}
+
+// disconnectBlock undoes the tip's UTXO changes, walking transactions and
+// inputs in reverse so outputs created and spent within the block unwind
+// in the right order.
+func (bc *Blockchain) disconnectBlock(node *blockNode) {
+	spent := bc.undo[node.hash]
+	transactions := node.block.Transactions
+
+	for i := len(transactions) - 1; i >= 0; i-- {
+		tx := transactions[i]
+
+		for j := range tx.Outputs {
+			bc.utxoSet.Spend(OutPoint{TxID: tx.ID, Index: j})
+		}
+
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		for range tx.Inputs {
+			entry := spent[len(spent)-1]
+			spent = spent[:len(spent)-1]
+			bc.utxoSet.Add(&entry)
+		}
+	}
+
+	delete(bc.undo, node.hash)
+	bc.bestChain = bc.bestChain[:len(bc.bestChain)-1]
+	node.status = statusValidHeader
+	bc.notifyTipChanged()
+	bc.queueNotification(NTBlockDisconnected, node.block)
+}
+
+func (bc *Blockchain) reorganize(newTip *blockNode) error {
+	fork := bc.findFork(newTip)
+
+	var detached []*blockNode
+	for bc.tip() != fork {
+		detached = append(detached, bc.tip())
+		bc.disconnectBlock(bc.tip())
+	}
+
+	var attach []*blockNode
+	for node := newTip; node != fork; node = node.parent {
+		attach = append(attach, node)
+	}
+
+	for i := len(attach) - 1; i >= 0; i-- {
+		if err := bc.connectBlock(attach[i]); err != nil {
+			for _, node := range attach[:i+1] {
+				node.status = statusInvalid
+			}
+
+			for bc.tip() != fork {
+				bc.disconnectBlock(bc.tip())
+			}
+			for j := len(detached) - 1; j >= 0; j-- {
+				if restoreErr := bc.connectBlock(detached[j]); restoreErr != nil {
+					return fmt.Errorf("failed to restore block %s after aborted reorganization: %v", detached[j].hash, restoreErr)
+				}
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,282 @@
+package blockchain
+
+import (
+	"errors"
+	"maps"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// reorgChain is a chain whose active branch is genesis, block 1 paying
+// alice and block 2 in which alice pays bob, with a spend of its own
+// coinbase in the same block.
+type reorgChain struct {
+	bc         *Blockchain
+	alice, bob *testKey
+	block1     *Block
+	block2     *Block
+	aliceCoin  *UTXO // Spent in block 2
+	bobCoin    *UTXO // Created in block 2
+}
+
+func newReorgChain(t *testing.T) *reorgChain {
+	t.Helper()
+
+	bc, _ := newTestChain(t)
+	c := &reorgChain{bc: bc, alice: newTestKey(t), bob: newTestKey(t)}
+
+	c.block1 = childBlock(c.bc.tip().block, c.alice.address, 50)
+	if err := c.bc.processBlock(c.block1); err != nil {
+		t.Fatalf("processBlock(1): %v", err)
+	}
+	c.aliceCoin = output(&c.block1.Transactions[0], 0)
+
+	pay := NewTransaction(
+		[]TxInput{{TxID: c.aliceCoin.OutPoint.TxID, OutputIndex: c.aliceCoin.OutPoint.Index}},
+		[]TxOutput{{Value: 30, Address: c.bob.address}, {Value: 20, Address: c.alice.address}},
+	)
+	c.alice.signInput(t, pay, 0, c.aliceCoin)
+	pay.SetID()
+	c.bobCoin = output(pay, 0)
+
+	c.block2 = childBlock(c.block1, c.alice.address, 51, *pay)
+	if err := c.bc.processBlock(c.block2); err != nil {
+		t.Fatalf("processBlock(2): %v", err)
+	}
+	return c
+}
+
+// check fails t unless the chain's tip is tip and the given balances hold.
+func (c *reorgChain) check(t *testing.T, tip *Block, aliceBalance, bobBalance int64) {
+	t.Helper()
+
+	if got := c.bc.GetLatestBlock(); got != tip {
+		t.Errorf("tip = %s at height %d, want %s at height %d", got.Header.Hash, got.Header.Height, tip.Header.Hash, tip.Header.Height)
+	}
+	if got := c.bc.GetHeight(); got != tip.Header.Height {
+		t.Errorf("GetHeight = %d, want %d", got, tip.Header.Height)
+	}
+	if got := c.bc.GetBalance(c.alice.address); got != aliceBalance {
+		t.Errorf("alice's balance = %d, want %d", got, aliceBalance)
+	}
+	if got := c.bc.GetBalance(c.bob.address); got != bobBalance {
+		t.Errorf("bob's balance = %d, want %d", got, bobBalance)
+	}
+}
+
+func TestReorganizeToHeavierBranch(t *testing.T) {
+	c := newReorgChain(t)
+	c.check(t, c.block2, 20+51, 30)
+
+	// A branch off block 1 of equal work stays a side branch
+	side2 := childBlock(c.block1, c.bob.address, 60)
+	if err := c.bc.processBlock(side2); err != nil {
+		t.Fatalf("processBlock(side 2): %v", err)
+	}
+	c.check(t, c.block2, 20+51, 30)
+
+	// One more block makes it heavier, so block 2 is disconnected
+	side3 := childBlock(side2, c.bob.address, 61)
+	if err := c.bc.processBlock(side3); err != nil {
+		t.Fatalf("processBlock(side 3): %v", err)
+	}
+	c.check(t, side3, 50, 60+61)
+
+	if _, err := c.bc.GetUTXO(c.aliceCoin.OutPoint.TxID, c.aliceCoin.OutPoint.Index); err != nil {
+		t.Errorf("output spent in the disconnected block was not restored: %v", err)
+	}
+	if _, err := c.bc.GetUTXO(c.bobCoin.OutPoint.TxID, c.bobCoin.OutPoint.Index); err == nil {
+		t.Error("output created in the disconnected block is still unspent")
+	}
+	if got, _ := c.bc.GetBlock(2); got != side2 {
+		t.Error("block at height 2 is not from the new branch")
+	}
+	if _, err := c.bc.GetBlockByHash(c.block2.Header.Hash); err != nil {
+		t.Errorf("disconnected block dropped from the index: %v", err)
+	}
+}
+
+func TestReorganizeAbortsOnInvalidBlock(t *testing.T) {
+	c := newReorgChain(t)
+
+	side2 := childBlock(c.block1, c.bob.address, 60)
+	if err := c.bc.processBlock(side2); err != nil {
+		t.Fatalf("processBlock(side 2): %v", err)
+	}
+
+	// Block 3 of the branch spends an output that was never created, which
+	// only shows once the reorganization tries to connect it
+	missing := NewTransaction(
+		[]TxInput{{TxID: c.aliceCoin.OutPoint.TxID, OutputIndex: 7}},
+		[]TxOutput{{Value: 10, Address: c.bob.address}},
+	)
+	side3 := childBlock(side2, c.bob.address, 61, *missing)
+
+	var ruleErr RuleError
+	if err := c.bc.processBlock(side3); !errors.As(err, &ruleErr) || ruleErr.Code != ErrMissingInput {
+		t.Fatalf("processBlock(side 3) = %v, want %s", err, ErrMissingInput)
+	}
+	c.check(t, c.block2, 20+51, 30)
+
+	if _, err := c.bc.GetUTXO(c.bobCoin.OutPoint.TxID, c.bobCoin.OutPoint.Index); err != nil {
+		t.Errorf("output created in the restored block is missing: %v", err)
+	}
+	if _, err := c.bc.GetUTXO(side2.Transactions[0].ID, 0); err == nil {
+		t.Error("output of the abandoned branch is still unspent")
+	}
+
+	// Nothing may build on the invalid block
+	side4 := childBlock(side3, c.bob.address, 62)
+	if err := c.bc.processBlock(side4); !errors.As(err, &ruleErr) || ruleErr.Code != ErrInvalidAncestor {
+		t.Errorf("processBlock(side 4) = %v, want %s", err, ErrInvalidAncestor)
+	}
+	c.check(t, c.block2, 20+51, 30)
+}
+
+func TestDisconnectBlockRestoresUTXOSet(t *testing.T) {
+	c := newReorgChain(t)
+	before := maps.Clone(c.bc.utxoSet.entries)
+
+	// Spend an output created earlier in the same block, so undoing the
+	// block has to unwind the transactions in reverse
+	pay := NewTransaction(
+		[]TxInput{{TxID: c.bobCoin.OutPoint.TxID, OutputIndex: c.bobCoin.OutPoint.Index}},
+		[]TxOutput{{Value: 30, Address: c.alice.address}},
+	)
+	c.bob.signInput(t, pay, 0, c.bobCoin)
+	pay.SetID()
+	payBack := NewTransaction(
+		[]TxInput{{TxID: pay.ID, OutputIndex: 0}},
+		[]TxOutput{{Value: 30, Address: c.bob.address}},
+	)
+	c.alice.signInput(t, payBack, 0, output(pay, 0))
+	payBack.SetID()
+
+	block3 := childBlock(c.block2, c.alice.address, 52, *pay, *payBack)
+	if err := c.bc.processBlock(block3); err != nil {
+		t.Fatalf("processBlock(3): %v", err)
+	}
+	c.check(t, block3, 20+51+52, 30)
+
+	c.bc.disconnectBlock(c.bc.tip())
+	c.check(t, c.block2, 20+51, 30)
+
+	after := c.bc.utxoSet.entries
+	if len(after) != len(before) {
+		t.Errorf("UTXO set has %d entries, want %d", len(after), len(before))
+	}
+	for op, want := range before {
+		if got, exists := after[op]; !exists || !reflect.DeepEqual(got, want) {
+			t.Errorf("entry %s = %+v, want %+v", op, got, want)
+		}
+	}
+}
+
+func TestMedianTimePast(t *testing.T) {
+	tests := []struct {
+		name       string
+		timestamps []int64 // Oldest first
+		count      int
+		want       int64
+	}{
+		{"single block", []int64{100}, 11, 100},
+		{"fewer blocks than count", []int64{100, 300, 200}, 11, 200},
+		{"even number of blocks takes the upper middle", []int64{100, 200, 300, 400}, 11, 300},
+		{"only the last count blocks", []int64{900, 100, 200, 300}, 3, 200},
+		{"out of order timestamps", []int64{100, 500, 200, 400, 300}, 5, 300},
+		{"count below one uses the block itself", []int64{100, 200}, 0, 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var node *blockNode
+			for i, timestamp := range tt.timestamps {
+				node = &blockNode{
+					parent: node,
+					height: int64(i),
+					block:  &Block{Header: BlockHeader{Timestamp: timestamp}},
+				}
+			}
+
+			if got := node.medianTimePast(tt.count); got != tt.want {
+				t.Errorf("medianTimePast(%d) = %d, want %d", tt.count, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckBlockTime(t *testing.T) {
+	bc, clock := newTestChain(t)
+	miner := newTestKey(t)
+
+	// Spread the timestamps so the median lies well behind the tip
+	for i := 0; i < bc.params.MedianTimeBlocks; i++ {
+		clock.now = testStart.Add(time.Duration(i) * 10 * time.Minute)
+		mineBlocks(t, bc, miner.address, 1)
+	}
+	clock.now = testStart.Add(3 * time.Hour)
+
+	parent := bc.tip()
+	medianTime := parent.medianTimePast(bc.params.MedianTimeBlocks)
+	if medianTime >= parent.block.Header.Timestamp {
+		t.Fatalf("median time past %d is not behind the tip's timestamp %d", medianTime, parent.block.Header.Timestamp)
+	}
+	maxTime := clock.now.Add(bc.params.MaxFutureBlockTime).Unix()
+
+	tests := []struct {
+		name      string
+		timestamp int64
+		wantCode  ErrorCode
+		wantErr   bool
+	}{
+		{"before median time past", medianTime - 1, ErrTimeTooOld, true},
+		{"at median time past", medianTime, ErrTimeTooOld, true},
+		{"just after median time past", medianTime + 1, 0, false},
+		{"behind the parent's timestamp", parent.block.Header.Timestamp - 1, 0, false},
+		{"at the clock", clock.now.Unix(), 0, false},
+		{"at the future limit", maxTime, 0, false},
+		{"past the future limit", maxTime + 1, ErrTimeTooNew, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := &Block{Header: BlockHeader{Timestamp: tt.timestamp, Height: parent.height + 1}}
+
+			err := bc.checkBlockTime(block, parent)
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("checkBlockTime(%d) = %v, want nil", tt.timestamp, err)
+				}
+				return
+			}
+
+			var ruleErr RuleError
+			if !errors.As(err, &ruleErr) || ruleErr.Code != tt.wantCode {
+				t.Errorf("checkBlockTime(%d) = %v, want %s", tt.timestamp, err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestProcessBlockChecksTimeAgainstClock(t *testing.T) {
+	bc, clock := newTestChain(t)
+	miner := newTestKey(t)
+	mineBlocks(t, bc, miner.address, 1)
+
+	// A block stamped past the limit of a clock that lags is accepted once
+	// the clock catches up
+	block := childBlock(bc.GetLatestBlock(), miner.address, 50)
+	block.Header.Timestamp = testStart.Add(4 * time.Hour).Unix()
+	block.Mine(block.Header.Difficulty)
+
+	var ruleErr RuleError
+	if err := bc.SubmitBlock(block); !errors.As(err, &ruleErr) || ruleErr.Code != ErrTimeTooNew {
+		t.Fatalf("SubmitBlock with a lagging clock = %v, want %s", err, ErrTimeTooNew)
+	}
+
+	clock.now = testStart.Add(3 * time.Hour)
+	if err := bc.SubmitBlock(block); err != nil {
+		t.Errorf("SubmitBlock once the clock caught up = %v, want nil", err)
+	}
+}
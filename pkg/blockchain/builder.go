@@ -0,0 +1,155 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// TxBuilder assembles an unsigned transaction from a set of spendable coins.
+// Build returns the coins it selected in input order so the signer knows
+// which output each input spends.
+type TxBuilder struct {
+	coins         []UTXO
+	outputs       []TxOutput
+	changeAddress string
+	fee           int64
+	feeRate       int64
+	unlockingSize int
+}
+
+func NewTxBuilder(coins []UTXO, changeAddress string) *TxBuilder {
+	return &TxBuilder{
+		coins:         coins,
+		changeAddress: changeAddress,
+	}
+}
+
+func (b *TxBuilder) AddOutput(address string, value int64) *TxBuilder {
+	b.outputs = append(b.outputs, TxOutput{Value: value, Address: address})
+	return b
+}
+
+// AddScriptOutput pays value to an output locked by script instead of an address.
+func (b *TxBuilder) AddScriptOutput(script Script, value int64) *TxBuilder {
+	b.outputs = append(b.outputs, TxOutput{Value: value, LockingScript: script})
+	return b
+}
+
+// SetFee sets an absolute fee in satoshis.
+func (b *TxBuilder) SetFee(fee int64) *TxBuilder {
+	b.fee = fee
+	return b
+}
+
+// SetFeeRate sets a fee in satoshis per byte of the signed transaction. When
+// both are set the larger of the two fees is paid.
+func (b *TxBuilder) SetFeeRate(feeRate int64) *TxBuilder {
+	b.feeRate = feeRate
+	return b
+}
+
+// SetUnlockingScriptSize sets the size of the unlocking script each input
+// will carry, for estimating the signed size when the coins are not locked
+// to a single key.
+func (b *TxBuilder) SetUnlockingScriptSize(size int) *TxBuilder {
+	b.unlockingSize = size
+	return b
+}
+
+func (b *TxBuilder) Build() (*Transaction, []UTXO, error) {
+	if len(b.outputs) == 0 {
+		return nil, nil, errors.New("transaction must have at least one output")
+	}
+
+	var target int64
+	for _, output := range b.outputs {
+		if output.Value <= 0 {
+			return nil, nil, errors.New("output value must be positive")
+		}
+		target += output.Value
+	}
+
+	if b.fee < 0 || b.feeRate < 0 {
+		return nil, nil, errors.New("fee must not be negative")
+	}
+
+	var selected []UTXO
+	var totalInput int64
+	fee := b.requiredFee(0)
+	for _, coin := range b.coins {
+		if totalInput >= target+fee {
+			break
+		}
+		selected = append(selected, coin)
+		totalInput += coin.Value
+		fee = b.requiredFee(len(selected))
+	}
+
+	if totalInput < target+fee {
+		return nil, nil, fmt.Errorf("insufficient funds: have %d, need %d (%d plus %d fee)", totalInput, target+fee, target, fee)
+	}
+
+	inputs := make([]TxInput, len(selected))
+	for i, coin := range selected {
+		inputs[i] = TxInput{
+			TxID:        coin.OutPoint.TxID,
+			OutputIndex: coin.OutPoint.Index,
+		}
+	}
+
+	outputs := make([]TxOutput, len(b.outputs))
+	copy(outputs, b.outputs)
+
+	// Change below the dust threshold is left to the fee rather than
+	// creating an output not worth spending
+	if change := totalInput - target - fee; change >= DustThreshold {
+		if b.changeAddress == "" {
+			return nil, nil, errors.New("change address required")
+		}
+		outputs = append(outputs, TxOutput{Value: change, Address: b.changeAddress})
+	}
+
+	return NewTransaction(inputs, outputs), selected, nil
+}
+
+func (b *TxBuilder) requiredFee(numInputs int) int64 {
+	if b.feeRate == 0 {
+		return b.fee
+	}
+
+	if rateFee := b.feeRate * int64(b.estimateSignedSize(numInputs)); rateFee > b.fee {
+		return rateFee
+	}
+	return b.fee
+}
+
+// estimateSignedSize sizes a transaction with numInputs signed inputs, the
+// requested outputs and a change output, using full-length placeholders for
+// the hashes, unlocking scripts and change value that are not known yet.
+func (b *TxBuilder) estimateSignedSize(numInputs int) int {
+	unlockingScript := SignatureScript(make([]byte, 64), make([]byte, 33))
+	if b.unlockingSize > 0 {
+		unlockingScript = make(Script, b.unlockingSize)
+	}
+
+	inputs := make([]TxInput, numInputs)
+	for i := range inputs {
+		inputs[i] = TxInput{
+			TxID:            strings.Repeat("0", 64),
+			UnlockingScript: unlockingScript,
+		}
+	}
+
+	outputs := append(append([]TxOutput{}, b.outputs...), TxOutput{Value: math.MaxInt64, Address: b.changeAddress})
+
+	tx := Transaction{
+		ID:        strings.Repeat("0", 64),
+		Inputs:    inputs,
+		Outputs:   outputs,
+		Timestamp: time.Now().Unix(),
+	}
+	return tx.GetSize()
+}
@@ -0,0 +1,221 @@
+package blockchain
+
+import (
+	"blockchain-node/pkg/crypto"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTxBuilder(t *testing.T) {
+	coins := []UTXO{
+		{OutPoint: OutPoint{TxID: "aa", Index: 0}, Value: 30000, Address: "alice"},
+		{OutPoint: OutPoint{TxID: "bb", Index: 1}, Value: 20000, Address: "alice"},
+		{OutPoint: OutPoint{TxID: "cc", Index: 0}, Value: 50000, Address: "alice"},
+	}
+
+	type payment struct {
+		address string
+		value   int64
+	}
+
+	tests := []struct {
+		name          string
+		changeAddress string
+		payments      []payment
+		wantInputs    int
+		wantChange    int64
+		wantErr       bool
+	}{
+		{name: "one coin with change", changeAddress: "alice", payments: []payment{{"bob", 10000}}, wantInputs: 1, wantChange: 20000},
+		{name: "one coin exactly", changeAddress: "alice", payments: []payment{{"bob", 30000}}, wantInputs: 1},
+		{name: "coins in order", changeAddress: "alice", payments: []payment{{"bob", 40000}}, wantInputs: 2, wantChange: 10000},
+		{name: "several outputs", changeAddress: "alice", payments: []payment{{"bob", 40000}, {"carol", 35000}}, wantInputs: 3, wantChange: 25000},
+		{name: "change below the dust threshold left to the fee", changeAddress: "alice", payments: []payment{{"bob", 30000 - DustThreshold + 1}}, wantInputs: 1},
+		{name: "change at the dust threshold", changeAddress: "alice", payments: []payment{{"bob", 30000 - DustThreshold}}, wantInputs: 1, wantChange: DustThreshold},
+		{name: "every coin", changeAddress: "alice", payments: []payment{{"bob", 100000}}, wantInputs: 3},
+		{name: "no change needed without a change address", payments: []payment{{"bob", 50000}}, wantInputs: 2},
+		{name: "change without a change address", payments: []payment{{"bob", 10000}}, wantErr: true},
+		{name: "insufficient funds", changeAddress: "alice", payments: []payment{{"bob", 101000}}, wantErr: true},
+		{name: "no outputs", changeAddress: "alice", wantErr: true},
+		{name: "zero output", changeAddress: "alice", payments: []payment{{"bob", 0}}, wantErr: true},
+		{name: "negative output", changeAddress: "alice", payments: []payment{{"bob", 40000}, {"carol", -10000}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := NewTxBuilder(coins, tt.changeAddress)
+			for _, p := range tt.payments {
+				builder.AddOutput(p.address, p.value)
+			}
+
+			tx, selected, err := builder.Build()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Build error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if len(tx.Inputs) != tt.wantInputs || len(selected) != tt.wantInputs {
+				t.Fatalf("Build spent %d inputs and selected %d coins, want %d", len(tx.Inputs), len(selected), tt.wantInputs)
+			}
+			for i, input := range tx.Inputs {
+				if input.TxID != coins[i].OutPoint.TxID || input.OutputIndex != coins[i].OutPoint.Index {
+					t.Errorf("input %d spends %s:%d, want %s", i, input.TxID, input.OutputIndex, coins[i].OutPoint)
+				}
+				if selected[i].OutPoint != coins[i].OutPoint {
+					t.Errorf("selected coin %d = %s, want %s", i, selected[i].OutPoint, coins[i].OutPoint)
+				}
+			}
+
+			wantOutputs := len(tt.payments)
+			if tt.wantChange > 0 {
+				wantOutputs++
+			}
+			if len(tx.Outputs) != wantOutputs {
+				t.Fatalf("Build made %d outputs, want %d", len(tx.Outputs), wantOutputs)
+			}
+			for i, p := range tt.payments {
+				if tx.Outputs[i].Address != p.address || tx.Outputs[i].Value != p.value {
+					t.Errorf("output %d = %+v, want %d to %s", i, tx.Outputs[i], p.value, p.address)
+				}
+			}
+			if tt.wantChange > 0 {
+				change := tx.Outputs[len(tx.Outputs)-1]
+				if change.Address != tt.changeAddress || change.Value != tt.wantChange {
+					t.Errorf("change = %+v, want %d to %s", change, tt.wantChange, tt.changeAddress)
+				}
+			}
+		})
+	}
+}
+
+func TestSignatureHash(t *testing.T) {
+	alice := newTestKey(t)
+	prevTxID := strings.Repeat("a", 64)
+	newTx := func() *Transaction {
+		return NewTransaction(
+			[]TxInput{{TxID: prevTxID, OutputIndex: 0}, {TxID: strings.Repeat("b", 64), OutputIndex: 1}},
+			[]TxOutput{{Value: 40, Address: "bob"}},
+		)
+	}
+	tx := newTx()
+	prevOut := &UTXO{OutPoint: OutPoint{TxID: prevTxID, Index: 0}, Value: 30, Address: alice.address}
+	hash := tx.SignatureHash(0, prevOut)
+
+	// The hash is the double SHA-256 of the transaction without unlocking
+	// scripts, then the input index and the output spent
+	var preimage bytes.Buffer
+	if err := tx.writeBinary(&preimage, false); err != nil {
+		t.Fatalf("writeBinary: %v", err)
+	}
+	writeVarInt(&preimage, 0)
+	writeUint64(&preimage, uint64(prevOut.Value))
+	writeVarString(&preimage, prevOut.Address)
+	writeVarBytes(&preimage, prevOut.LockingScript)
+	if want := crypto.DoubleHashSHA256(preimage.Bytes()); !bytes.Equal(hash, want) {
+		t.Fatalf("SignatureHash = %x, want %x", hash, want)
+	}
+
+	otherValue := *prevOut
+	otherValue.Value++
+	otherAddress := *prevOut
+	otherAddress.Address = "carol"
+	otherScript := *prevOut
+	otherScript.LockingScript = PayToPubKeyHashScript(alice.pubKeyHash(t))
+
+	tests := []struct {
+		name    string
+		change  func(tx *Transaction)
+		input   int
+		prevOut *UTXO
+	}{
+		{"other input", func(tx *Transaction) {}, 1, prevOut},
+		{"other spent value", func(tx *Transaction) {}, 0, &otherValue},
+		{"other spent address", func(tx *Transaction) {}, 0, &otherAddress},
+		{"other spent locking script", func(tx *Transaction) {}, 0, &otherScript},
+		{"other outpoint", func(tx *Transaction) { tx.Inputs[1].OutputIndex++ }, 0, prevOut},
+		{"other sequence", func(tx *Transaction) { tx.Inputs[1].Sequence++ }, 0, prevOut},
+		{"other output", func(tx *Transaction) { tx.Outputs[0].Value++ }, 0, prevOut},
+		{"other lock time", func(tx *Transaction) { tx.LockTime++ }, 0, prevOut},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := newTx()
+			tt.change(changed)
+			if bytes.Equal(changed.SignatureHash(tt.input, tt.prevOut), hash) {
+				t.Error("SignatureHash unchanged")
+			}
+		})
+	}
+
+	// Signing fills in unlocking data, which the hash must not cover
+	alice.signInput(t, tx, 0, prevOut)
+	tx.SetID()
+	if !bytes.Equal(tx.SignatureHash(0, prevOut), hash) {
+		t.Error("SignatureHash changed after signing")
+	}
+
+	invalid := NewTransaction([]TxInput{{TxID: "aa", OutputIndex: 0}}, []TxOutput{{Value: 40, Address: "bob"}})
+	if got := invalid.SignatureHash(0, prevOut); got != nil {
+		t.Errorf("SignatureHash of a transaction that cannot be encoded = %x, want nil", got)
+	}
+}
+
+func TestTxBuilderFees(t *testing.T) {
+	coins := []UTXO{
+		{OutPoint: OutPoint{TxID: "aa", Index: 0}, Value: 30000, Address: "alice"},
+		{OutPoint: OutPoint{TxID: "bb", Index: 0}, Value: 30000, Address: "alice"},
+	}
+
+	tests := []struct {
+		name       string
+		fee        int64
+		feeRate    int64
+		amount     int64
+		wantInputs int
+		wantErr    bool
+	}{
+		{name: "fixed fee from change", fee: 1000, amount: 20000, wantInputs: 1},
+		{name: "fixed fee takes a second coin", fee: 1000, amount: 29500, wantInputs: 2},
+		{name: "fee rate", feeRate: 2, amount: 20000, wantInputs: 1},
+		{name: "fixed fee over rate fee", fee: 5000, feeRate: 1, amount: 20000, wantInputs: 1},
+		{name: "fee leaves no room", fee: 1, amount: 60000, wantErr: true},
+		{name: "negative fee", fee: -1, amount: 20000, wantErr: true},
+		{name: "negative fee rate", feeRate: -1, amount: 20000, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, selected, err := NewTxBuilder(coins, "alice").AddOutput("bob", tt.amount).SetFee(tt.fee).SetFeeRate(tt.feeRate).Build()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Build error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(selected) != tt.wantInputs {
+				t.Fatalf("Build selected %d coins, want %d", len(selected), tt.wantInputs)
+			}
+
+			fee, err := tx.GetFee(testView{coins[0].OutPoint: &coins[0], coins[1].OutPoint: &coins[1]})
+			if err != nil {
+				t.Fatalf("GetFee: %v", err)
+			}
+			if fee < tt.fee {
+				t.Errorf("fee = %d, want at least %d", fee, tt.fee)
+			}
+
+			// The rate covers the transaction once signed
+			for i := range tx.Inputs {
+				tx.Inputs[i].UnlockingScript = SignatureScript(make([]byte, 64), make([]byte, 33))
+			}
+			tx.SetID()
+			if minFee := tt.feeRate * int64(tx.GetSize()); fee < minFee {
+				t.Errorf("fee = %d, want at least %d for %d signed bytes", fee, minFee, tx.GetSize())
+			}
+		})
+	}
+}
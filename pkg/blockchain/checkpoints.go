@@ -0,0 +1,101 @@
+package blockchain
+
+import "fmt"
+
+// checkpointAt returns the checkpoint at height, if there is one.
+func (bc *Blockchain) checkpointAt(height int64) (Checkpoint, bool) {
+	for _, checkpoint := range bc.params.Checkpoints {
+		if checkpoint.Height == height {
+			return checkpoint, true
+		}
+	}
+	return Checkpoint{}, false
+}
+
+// latestCheckpoint returns the highest checkpoint at or below the active
+// chain's tip, or false if the chain has not reached one.
+func (bc *Blockchain) latestCheckpoint() (Checkpoint, bool) {
+	checkpoints := bc.params.Checkpoints
+	for i := len(checkpoints) - 1; i >= 0; i-- {
+		if checkpoints[i].Height <= bc.tip().height {
+			return checkpoints[i], true
+		}
+	}
+	return Checkpoint{}, false
+}
+
+// checkCheckpoints rejects a block that contradicts a checkpoint at its own
+// height, or that forks from the active chain below the latest checkpoint
+// the chain has passed. Such a branch could never become active, so it is
+// refused before any further work is spent on it.
+func (bc *Blockchain) checkCheckpoints(block *Block, parent *blockNode) error {
+	if checkpoint, exists := bc.checkpointAt(block.Header.Height); exists && checkpoint.Hash != block.Header.Hash {
+		return ruleError(ErrCheckpointMismatch, "block %s at height %d does not match checkpoint %s", block.Header.Hash, block.Header.Height, checkpoint.Hash)
+	}
+
+	checkpoint, exists := bc.latestCheckpoint()
+	if !exists {
+		return nil
+	}
+
+	if fork := bc.findFork(parent); fork.height < checkpoint.Height {
+		return ruleError(ErrForkBeforeCheckpoint, "block %s forks from the active chain at height %d, below checkpoint %d", block.Header.Hash, fork.height, checkpoint.Height)
+	}
+
+	return nil
+}
+
+// ImportBlocks connects blocks loaded from storage, in order, as a node does
+// when it restarts. Blocks that are already known are skipped. Signatures
+// in the chain's AssumeValid block and the blocks linking up to it are not
+// verified; every other rule is still enforced for every block.
+func (bc *Blockchain) ImportBlocks(blocks []*Block) error {
+	defer bc.deliverNotifications()
+
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	bc.assumedValid = assumedValidBlocks(blocks, bc.params.AssumeValid)
+	defer func() { bc.assumedValid = nil }()
+
+	for _, block := range blocks {
+		if _, exists := bc.index[block.Header.Hash]; exists {
+			continue
+		}
+
+		if err := bc.processBlock(block); err != nil {
+			return fmt.Errorf("failed to import block %d (%s): %w", block.Header.Height, block.Header.Hash, err)
+		}
+	}
+
+	return nil
+}
+
+// assumedValidBlocks returns the hashes of the assumeValid block and of the
+// blocks before it that it descends from. Only blocks linked to it by
+// previous hash qualify: those links are committed to by the block hashes,
+// which processBlock verifies, so nothing outside that ancestry can borrow
+// the trust.
+func assumedValidBlocks(blocks []*Block, assumeValid string) map[string]bool {
+	if assumeValid == "" {
+		return nil
+	}
+
+	end := -1
+	for i, block := range blocks {
+		if block.Header.Hash == assumeValid {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return nil
+	}
+
+	trusted := map[string]bool{assumeValid: true}
+	for i := end; i > 0 && blocks[i].Header.PreviousHash == blocks[i-1].Header.Hash; i-- {
+		trusted[blocks[i-1].Header.Hash] = true
+	}
+
+	return trusted
+}
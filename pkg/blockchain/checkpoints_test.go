@@ -0,0 +1,159 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckCheckpoints(t *testing.T) {
+	miner := newTestKey(t)
+
+	// Build the chain the checkpoint is taken from
+	source, _ := newTestChain(t)
+	blocks := mineBlocks(t, source, miner.address, 3)
+
+	params := *source.params
+	params.Checkpoints = []Checkpoint{{Height: 2, Hash: blocks[1].Header.Hash}}
+	bc := newChainWithParams(t, &params)
+	bc.SetClock(&fixedClock{now: testStart})
+
+	if err := bc.SubmitBlock(blocks[0]); err != nil {
+		t.Fatalf("SubmitBlock(1): %v", err)
+	}
+
+	var ruleErr RuleError
+	if err := bc.SubmitBlock(childBlock(blocks[0], miner.address, 49)); !errors.As(err, &ruleErr) || ruleErr.Code != ErrCheckpointMismatch {
+		t.Fatalf("SubmitBlock of another block at the checkpoint = %v, want %s", err, ErrCheckpointMismatch)
+	}
+
+	for _, block := range blocks[1:] {
+		if err := bc.SubmitBlock(block); err != nil {
+			t.Fatalf("SubmitBlock(%d): %v", block.Header.Height, err)
+		}
+	}
+
+	// Once past the checkpoint, no other block may take its place
+	if err := bc.SubmitBlock(childBlock(blocks[0], miner.address, 48)); !errors.As(err, &ruleErr) || ruleErr.Code != ErrCheckpointMismatch {
+		t.Fatalf("SubmitBlock of a fork at the checkpoint = %v, want %s", err, ErrCheckpointMismatch)
+	}
+	if err := bc.SubmitBlock(childBlock(blocks[2], miner.address, 46)); err != nil {
+		t.Errorf("SubmitBlock above the checkpoint = %v, want nil", err)
+	}
+
+	// A fork from the checkpoint itself is still allowed
+	side := childBlock(blocks[1], miner.address, 45)
+	if err := bc.SubmitBlock(side); err != nil {
+		t.Errorf("SubmitBlock forking at the checkpoint = %v, want nil", err)
+	}
+
+	if err := bc.ValidateChain(); err != nil {
+		t.Errorf("ValidateChain = %v, want nil", err)
+	}
+}
+
+func TestCheckCheckpointsRejectsForkBelowCheckpoint(t *testing.T) {
+	miner := newTestKey(t)
+
+	source, _ := newTestChain(t)
+	blocks := mineBlocks(t, source, miner.address, 2)
+
+	params := *source.params
+	params.Checkpoints = []Checkpoint{{Height: 2, Hash: blocks[1].Header.Hash}}
+	bc := newChainWithParams(t, &params)
+	bc.SetClock(&fixedClock{now: testStart})
+	for _, block := range blocks {
+		if err := bc.SubmitBlock(block); err != nil {
+			t.Fatalf("SubmitBlock(%d): %v", block.Header.Height, err)
+		}
+	}
+
+	var ruleErr RuleError
+	fork := childBlock(bc.GetAllBlocks()[0], miner.address, 49)
+	if err := bc.SubmitBlock(fork); !errors.As(err, &ruleErr) || ruleErr.Code != ErrForkBeforeCheckpoint {
+		t.Errorf("SubmitBlock forking below the checkpoint = %v, want %s", err, ErrForkBeforeCheckpoint)
+	}
+}
+
+func TestImportBlocksAssumeValid(t *testing.T) {
+	alice := newTestKey(t)
+	genesis := NewGenesisBlock(&RegTestParams)
+
+	// badSpend spends the coinbase of block with a signature that does not
+	// cover the transaction
+	badSpend := func(block *Block) Transaction {
+		coinbase := &block.Transactions[0]
+		tx := NewTransaction([]TxInput{{TxID: coinbase.ID, OutputIndex: 0}}, []TxOutput{{Value: 10, Address: alice.address}})
+		alice.signInput(t, tx, 0, output(coinbase, 0))
+		tx.Outputs[0].Value = 20
+		tx.SetID()
+		return *tx
+	}
+
+	// Blocks 2 and 4 each hold a spend whose signature is invalid
+	block1 := childBlock(genesis, alice.address, 50)
+	block2 := childBlock(block1, alice.address, 50, badSpend(block1))
+	block3 := childBlock(block2, alice.address, 50)
+	block4 := childBlock(block3, alice.address, 50, badSpend(block3))
+	blocks := []*Block{block1, block2, block3, block4}
+
+	tests := []struct {
+		name        string
+		assumeValid string
+		wantHeight  int64 // Height of the tip once the import stops
+	}{
+		{"no assume-valid block", "", 1},
+		{"assume-valid block after the bad signature", block3.Header.Hash, 3},
+		{"assume-valid block before the bad signature", block1.Header.Hash, 1},
+		{"unknown assume-valid block", zeroHash, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := RegTestParams
+			params.CoinbaseMaturity = 1
+			params.AssumeValid = tt.assumeValid
+			bc := newChainWithParams(t, &params)
+			bc.SetClock(&fixedClock{now: testStart})
+
+			var ruleErr RuleError
+			err := bc.ImportBlocks(blocks)
+			if !errors.As(err, &ruleErr) || ruleErr.Code != ErrScriptFailed {
+				t.Errorf("ImportBlocks = %v, want %s", err, ErrScriptFailed)
+			}
+			if got := bc.GetLatestBlock().Header.Height; got != tt.wantHeight {
+				t.Errorf("tip height = %d, want %d", got, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestGenesisCheckpoint(t *testing.T) {
+	for _, params := range []ChainParams{MainNetParams, TestNetParams, RegTestParams} {
+		t.Run(params.Name, func(t *testing.T) {
+			if _, err := NewBlockchainWithParams(&params); err != nil {
+				t.Fatalf("NewBlockchainWithParams: %v", err)
+			}
+
+			// Any other genesis block is refused
+			params.GenesisTimestamp++
+			if _, err := NewBlockchainWithParams(&params); err == nil {
+				t.Error("NewBlockchainWithParams accepted a genesis block other than the checkpoint")
+			}
+		})
+	}
+}
+
+func TestAssumeValidIsCheckpointed(t *testing.T) {
+	for _, params := range []ChainParams{MainNetParams, TestNetParams, RegTestParams} {
+		if params.AssumeValid == "" {
+			continue
+		}
+
+		// The assume-valid block is trusted only as part of the chain the
+		// checkpoints pin down
+		latest := params.Checkpoints[len(params.Checkpoints)-1]
+		if params.AssumeValid != latest.Hash {
+			t.Errorf("%s assumes valid %s, want its latest checkpoint %s", params.Name, params.AssumeValid, latest.Hash)
+		}
+	}
+}
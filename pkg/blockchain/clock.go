@@ -0,0 +1,29 @@
+package blockchain
+
+import "time"
+
+// Clock supplies the node-adjusted current time that block timestamps are
+// checked against. Tests substitute a fixed or stepped clock.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewOffsetClock returns a clock running at a fixed offset from system time,
+// for nodes that correct their local time by a known skew.
+func NewOffsetClock(offset time.Duration) Clock {
+	return offsetClock{offset: offset}
+}
+
+type offsetClock struct {
+	offset time.Duration
+}
+
+func (c offsetClock) Now() time.Time {
+	return time.Now().Add(c.offset)
+}
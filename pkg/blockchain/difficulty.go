@@ -0,0 +1,81 @@
+package blockchain
+
+import "math/big"
+
+func (node *blockNode) ancestor(height int64) *blockNode {
+	for node != nil && node.height > height {
+		node = node.parent
+	}
+	return node
+}
+
+// calcNextRequiredDifficulty returns the bits a block built on parent must
+// carry. The target only changes on window boundaries, where it is scaled by
+// the ratio of the actual to the expected time the last window took, with the
+// ratio clamped to MaxRetargetFactor.
+func (bc *Blockchain) calcNextRequiredDifficulty(parent *blockNode) uint32 {
+	window := bc.params.RetargetWindow
+	if window < 1 || (parent.height+1)%window != 0 {
+		return parent.block.Header.Difficulty
+	}
+
+	firstHeight := parent.height - window
+	if firstHeight < 0 {
+		firstHeight = 0
+	}
+	first := parent.ancestor(firstHeight)
+	if first == parent {
+		return parent.block.Header.Difficulty
+	}
+
+	targetSpacing := int64(bc.params.TargetSpacing.Seconds())
+	expectedTimespan := (parent.height - first.height) * targetSpacing
+	actualTimespan := parent.block.Header.Timestamp - first.block.Header.Timestamp
+
+	minTimespan := expectedTimespan / bc.params.MaxRetargetFactor
+	maxTimespan := expectedTimespan * bc.params.MaxRetargetFactor
+	if actualTimespan < minTimespan {
+		actualTimespan = minTimespan
+	} else if actualTimespan > maxTimespan {
+		actualTimespan = maxTimespan
+	}
+
+	newTarget := CompactToBig(parent.block.Header.Difficulty)
+	newTarget.Mul(newTarget, big.NewInt(actualTimespan))
+	newTarget.Div(newTarget, big.NewInt(expectedTimespan))
+
+	if newTarget.Cmp(powLimit) > 0 {
+		newTarget.Set(powLimit)
+	}
+
+	return BigToCompact(newTarget)
+}
+
+// calcEasiestDifficulty returns the easiest bits a block at height could
+// carry on a chain extending the tip: the tip's next required target, eased
+// by MaxRetargetFactor at each retarget boundary in between. A block claiming
+// less work cannot belong to the chain, whatever its unknown ancestors are.
+func (bc *Blockchain) calcEasiestDifficulty(height int64) uint32 {
+	tip := bc.tip()
+	bits := bc.calcNextRequiredDifficulty(tip)
+
+	window := bc.params.RetargetWindow
+	if window < 1 {
+		return bits
+	}
+
+	// Retargets at the boundaries after the tip's successor, up to height
+	retargets := height/window - (tip.height+1)/window
+
+	target := CompactToBig(bits)
+	factor := big.NewInt(bc.params.MaxRetargetFactor)
+	for ; retargets > 0 && factor.Int64() > 1 && target.Cmp(powLimit) < 0; retargets-- {
+		target.Mul(target, factor)
+	}
+
+	if target.Cmp(powLimit) > 0 {
+		target.Set(powLimit)
+	}
+
+	return BigToCompact(target)
+}
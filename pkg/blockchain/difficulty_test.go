@@ -0,0 +1,102 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+// nodeChain returns the tip of a chain of blocks at heights 0 to tipHeight,
+// all carrying bits and spaced spacing seconds apart.
+func nodeChain(tipHeight int64, bits uint32, spacing int64) *blockNode {
+	var node *blockNode
+	for height := int64(0); height <= tipHeight; height++ {
+		block := &Block{Header: BlockHeader{
+			Height:     height,
+			Timestamp:  testStart.Unix() + height*spacing,
+			Difficulty: bits,
+		}}
+		node = &blockNode{parent: node, height: height, block: block}
+	}
+	return node
+}
+
+// scaleBits returns bits with its target multiplied by num/den.
+func scaleBits(bits uint32, num, den int64) uint32 {
+	target := CompactToBig(bits)
+	target.Mul(target, big.NewInt(num))
+	target.Div(target, big.NewInt(den))
+	return BigToCompact(target)
+}
+
+func TestCalcNextRequiredDifficulty(t *testing.T) {
+	params := MainNetParams
+	spacing := int64(params.TargetSpacing.Seconds())
+	window := params.RetargetWindow
+	factor := params.MaxRetargetFactor
+
+	// A target well below the limit, so it can ease as well as tighten
+	bits := BigToCompact(new(big.Int).Rsh(powLimit, 8))
+	nearLimit := BigToCompact(new(big.Int).Rsh(powLimit, 1))
+
+	tests := []struct {
+		name      string
+		tipHeight int64
+		bits      uint32
+		spacing   int64
+		window    int64
+		want      uint32
+	}{
+		{"on schedule", 2*window - 1, bits, spacing, window, bits},
+		{"twice as fast", 2*window - 1, bits, spacing / 2, window, scaleBits(bits, 1, 2)},
+		{"twice as slow", 2*window - 1, bits, spacing * 2, window, scaleBits(bits, 2, 1)},
+		{"too fast", 2*window - 1, bits, 1, window, scaleBits(bits, 1, factor)},
+		{"too slow", 2*window - 1, bits, spacing * factor * 10, window, scaleBits(bits, factor, 1)},
+		{"before a boundary", 2*window - 2, bits, 1, window, bits},
+		{"after a boundary", 2 * window, bits, 1, window, bits},
+		{"first window", window - 1, bits, spacing / 2, window, scaleBits(bits, 1, 2)},
+		{"capped at the limit", 2*window - 1, nearLimit, spacing * factor, window, PowLimitBits},
+		{"retargeting off", 2*window - 1, bits, 1, 0, bits},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := params
+			p.RetargetWindow = tt.window
+			bc := &Blockchain{params: &p}
+
+			got := bc.calcNextRequiredDifficulty(nodeChain(tt.tipHeight, tt.bits, tt.spacing))
+			if got != tt.want {
+				t.Errorf("calcNextRequiredDifficulty = %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalcNextRequiredDifficultyClampsEachRetarget(t *testing.T) {
+	params := MainNetParams
+	bc := &Blockchain{params: &params}
+	bits := BigToCompact(new(big.Int).Rsh(powLimit, 8))
+
+	// Each retarget over blocks coming eight times too fast is clamped to
+	// the factor, so two in a row tighten the target by its square
+	spacing := int64(params.TargetSpacing/time.Second) / 8
+	want := scaleBits(scaleBits(bits, 1, params.MaxRetargetFactor), 1, params.MaxRetargetFactor)
+
+	tip := nodeChain(2*params.RetargetWindow-1, bits, spacing)
+	for retarget := 0; retarget < 2; retarget++ {
+		next := bc.calcNextRequiredDifficulty(tip)
+		for i := int64(0); i < params.RetargetWindow; i++ {
+			block := &Block{Header: BlockHeader{
+				Height:     tip.height + 1,
+				Timestamp:  tip.block.Header.Timestamp + spacing,
+				Difficulty: next,
+			}}
+			tip = &blockNode{parent: tip, height: tip.height + 1, block: block}
+		}
+	}
+
+	if got := tip.block.Header.Difficulty; got != want {
+		t.Errorf("difficulty after two retargets = %#x, want %#x", got, want)
+	}
+}
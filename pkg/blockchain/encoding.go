@@ -0,0 +1,377 @@
+package blockchain
+
+import (
+	"blockchain-node/pkg/crypto"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// BlockHeaderSize is the length of a serialized block header: version (4),
+// previous hash (32), merkle root (32), timestamp (8), difficulty (4),
+// nonce (8) and height (8). Integers are little-endian and hashes are the
+// raw bytes of their hex form.
+const BlockHeaderSize = 96
+
+// Serialize encodes the header in its fixed binary layout. This is the
+// preimage hashed for proof of work.
+func (h *BlockHeader) Serialize() ([]byte, error) {
+	prevHash, err := decodeHash(h.PreviousHash)
+	if err != nil {
+		return nil, fmt.Errorf("previous hash: %v", err)
+	}
+
+	merkleRoot, err := decodeHash(h.MerkleRoot)
+	if err != nil {
+		return nil, fmt.Errorf("merkle root: %v", err)
+	}
+
+	buf := make([]byte, 0, BlockHeaderSize)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(h.Version))
+	buf = append(buf, prevHash...)
+	buf = append(buf, merkleRoot...)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(h.Timestamp))
+	buf = binary.LittleEndian.AppendUint32(buf, h.Difficulty)
+	buf = binary.LittleEndian.AppendUint64(buf, h.Nonce)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(h.Height))
+
+	return buf, nil
+}
+
+// DeserializeBlockHeader decodes a header produced by BlockHeader.Serialize.
+// The hash is recomputed from the decoded fields.
+func DeserializeBlockHeader(data []byte) (*BlockHeader, error) {
+	if len(data) != BlockHeaderSize {
+		return nil, fmt.Errorf("block header must be %d bytes, got %d", BlockHeaderSize, len(data))
+	}
+
+	h := &BlockHeader{
+		Version:      int32(binary.LittleEndian.Uint32(data[0:4])),
+		PreviousHash: hex.EncodeToString(data[4:36]),
+		MerkleRoot:   hex.EncodeToString(data[36:68]),
+		Timestamp:    int64(binary.LittleEndian.Uint64(data[68:76])),
+		Difficulty:   binary.LittleEndian.Uint32(data[76:80]),
+		Nonce:        binary.LittleEndian.Uint64(data[80:88]),
+		Height:       int64(binary.LittleEndian.Uint64(data[88:96])),
+	}
+	h.Hash = hashHeader(data)
+
+	return h, nil
+}
+
+func hashHeader(headerBytes []byte) string {
+	return hex.EncodeToString(crypto.DoubleHashSHA256(headerBytes))
+}
+
+// decodeHash converts a lowercase 64-digit hex hash to its 32 raw bytes. An
+// empty string, the merkle root of a block without transactions, encodes as
+// all zeros. Any other spelling is rejected so that each header has exactly
+// one encoding.
+func decodeHash(s string) ([]byte, error) {
+	if s == "" {
+		return make([]byte, 32), nil
+	}
+
+	raw, err := hex.DecodeString(s)
+	if err != nil || len(raw) != 32 || hex.EncodeToString(raw) != s {
+		return nil, fmt.Errorf("%q is not a 32-byte lowercase hex hash", s)
+	}
+	return raw, nil
+}
+
+// SerializeBinary encodes the block in its binary wire format: the 96-byte
+// header followed by a varint transaction count and each transaction's
+// binary encoding.
+func (b *Block) SerializeBinary() ([]byte, error) {
+	headerBytes, err := b.Header.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(headerBytes)
+	writeVarInt(&buf, uint64(len(b.Transactions)))
+
+	for i := range b.Transactions {
+		if err := b.Transactions[i].writeBinary(&buf, true); err != nil {
+			return nil, fmt.Errorf("transaction %d: %v", i, err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DeserializeBlockBinary decodes a block produced by Block.SerializeBinary.
+// The block hash and transaction IDs are recomputed, never trusted.
+func DeserializeBlockBinary(data []byte) (*Block, error) {
+	if len(data) < BlockHeaderSize {
+		return nil, fmt.Errorf("block must be at least %d bytes, got %d", BlockHeaderSize, len(data))
+	}
+
+	header, err := DeserializeBlockHeader(data[:BlockHeaderSize])
+	if err != nil {
+		return nil, err
+	}
+
+	r := bytes.NewReader(data[BlockHeaderSize:])
+
+	count, err := readCount(r)
+	if err != nil {
+		return nil, fmt.Errorf("transaction count: %v", err)
+	}
+
+	block := &Block{
+		Header:       *header,
+		Transactions: make([]Transaction, count),
+	}
+
+	for i := range block.Transactions {
+		if err := block.Transactions[i].readBinary(r); err != nil {
+			return nil, fmt.Errorf("transaction %d: %v", i, err)
+		}
+	}
+
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after block", r.Len())
+	}
+
+	return block, nil
+}
+
+// SerializeBinary encodes the transaction in its binary wire format. The ID
+// is not included; it is derived from the other fields.
+func (tx *Transaction) SerializeBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tx.writeBinary(&buf, true); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DeserializeTransactionBinary decodes a transaction produced by
+// Transaction.SerializeBinary and computes its ID.
+func DeserializeTransactionBinary(data []byte) (*Transaction, error) {
+	r := bytes.NewReader(data)
+
+	var tx Transaction
+	if err := tx.readBinary(r); err != nil {
+		return nil, err
+	}
+
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after transaction", r.Len())
+	}
+
+	return &tx, nil
+}
+
+// writeBinary encodes the transaction. Without witness the unlocking scripts
+// are left out, which is the encoding its ID is computed over.
+func (tx *Transaction) writeBinary(buf *bytes.Buffer, witness bool) error {
+	writeUint64(buf, uint64(tx.Timestamp))
+	writeUint64(buf, uint64(tx.Height))
+
+	writeVarInt(buf, uint64(len(tx.Inputs)))
+	for i, input := range tx.Inputs {
+		prevTxID, err := decodeHash(input.TxID)
+		if err != nil || input.TxID == "" {
+			return fmt.Errorf("input %d: invalid previous transaction ID %q", i, input.TxID)
+		}
+		if input.OutputIndex < 0 {
+			return fmt.Errorf("input %d: negative output index", i)
+		}
+
+		buf.Write(prevTxID)
+		writeVarInt(buf, uint64(input.OutputIndex))
+		writeUint32(buf, input.Sequence)
+		if witness {
+			writeVarBytes(buf, input.UnlockingScript)
+		}
+	}
+
+	writeVarInt(buf, uint64(len(tx.Outputs)))
+	for _, output := range tx.Outputs {
+		writeUint64(buf, uint64(output.Value))
+		writeVarString(buf, output.Address)
+		writeVarBytes(buf, output.LockingScript)
+	}
+
+	writeUint64(buf, uint64(tx.LockTime))
+	writeVarString(buf, tx.WitnessCommitment)
+
+	return nil
+}
+
+func (tx *Transaction) readBinary(r *bytes.Reader) error {
+	timestamp, err := readUint64(r)
+	if err != nil {
+		return err
+	}
+	height, err := readUint64(r)
+	if err != nil {
+		return err
+	}
+	tx.Timestamp = int64(timestamp)
+	tx.Height = int64(height)
+
+	inputCount, err := readCount(r)
+	if err != nil {
+		return fmt.Errorf("input count: %v", err)
+	}
+
+	tx.Inputs = make([]TxInput, inputCount)
+	for i := range tx.Inputs {
+		prevTxID := make([]byte, 32)
+		if _, err := io.ReadFull(r, prevTxID); err != nil {
+			return fmt.Errorf("input %d: %v", i, err)
+		}
+
+		outputIndex, err := binary.ReadUvarint(r)
+		if err != nil {
+			return fmt.Errorf("input %d: %v", i, err)
+		}
+		if outputIndex > math.MaxInt32 {
+			return fmt.Errorf("input %d: output index out of range", i)
+		}
+
+		sequence, err := readUint32(r)
+		if err != nil {
+			return fmt.Errorf("input %d: %v", i, err)
+		}
+
+		unlockingScript, err := readVarBytes(r)
+		if err != nil {
+			return fmt.Errorf("input %d: %v", i, err)
+		}
+
+		tx.Inputs[i] = TxInput{
+			TxID:            hex.EncodeToString(prevTxID),
+			OutputIndex:     int(outputIndex),
+			Sequence:        sequence,
+			UnlockingScript: unlockingScript,
+		}
+	}
+
+	outputCount, err := readCount(r)
+	if err != nil {
+		return fmt.Errorf("output count: %v", err)
+	}
+
+	tx.Outputs = make([]TxOutput, outputCount)
+	for i := range tx.Outputs {
+		value, err := readUint64(r)
+		if err != nil {
+			return fmt.Errorf("output %d: %v", i, err)
+		}
+
+		address, err := readVarString(r)
+		if err != nil {
+			return fmt.Errorf("output %d: %v", i, err)
+		}
+
+		lockingScript, err := readVarBytes(r)
+		if err != nil {
+			return fmt.Errorf("output %d: %v", i, err)
+		}
+
+		tx.Outputs[i] = TxOutput{Value: int64(value), Address: address, LockingScript: lockingScript}
+	}
+
+	lockTime, err := readUint64(r)
+	if err != nil {
+		return fmt.Errorf("lock time: %v", err)
+	}
+	tx.LockTime = int64(lockTime)
+
+	if tx.WitnessCommitment, err = readVarString(r); err != nil {
+		return err
+	}
+
+	tx.SetID()
+
+	return nil
+}
+
+func writeUint64(buf *bytes.Buffer, v uint64) {
+	buf.Write(binary.LittleEndian.AppendUint64(nil, v))
+}
+
+func readUint64(r *bytes.Reader) (uint64, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b[:]), nil
+}
+
+func writeUint32(buf *bytes.Buffer, v uint32) {
+	buf.Write(binary.LittleEndian.AppendUint32(nil, v))
+}
+
+func readUint32(r *bytes.Reader) (uint32, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b[:]), nil
+}
+
+func writeVarInt(buf *bytes.Buffer, v uint64) {
+	buf.Write(binary.AppendUvarint(nil, v))
+}
+
+// readCount reads a varint count or length. Every counted item takes at least
+// one byte, so a count larger than the remaining data is rejected before it
+// can drive a huge allocation.
+func readCount(r *bytes.Reader) (int, error) {
+	v, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, err
+	}
+	if v > uint64(r.Len()) {
+		return 0, errors.New("count exceeds remaining data")
+	}
+	return int(v), nil
+}
+
+func writeVarString(buf *bytes.Buffer, s string) {
+	writeVarInt(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func readVarString(r *bytes.Reader) (string, error) {
+	n, err := readCount(r)
+	if err != nil {
+		return "", err
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func writeVarBytes(buf *bytes.Buffer, b []byte) {
+	writeVarInt(buf, uint64(len(b)))
+	buf.Write(b)
+}
+
+// readVarBytes reads a length-prefixed byte string. An empty one reads as
+// nil, matching a field that was never set.
+func readVarBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := readCount(r)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
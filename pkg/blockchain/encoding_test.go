@@ -0,0 +1,106 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+type headerVector struct {
+	Description string      `json:"description"`
+	Header      BlockHeader `json:"header"`
+	Serialized  string      `json:"serialized"`
+}
+
+func loadHeaderVectors(t *testing.T) []headerVector {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/block_header_vectors.json")
+	if err != nil {
+		t.Fatalf("reading vectors: %v", err)
+	}
+
+	var vectors []headerVector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatalf("decoding vectors: %v", err)
+	}
+	if len(vectors) == 0 {
+		t.Fatal("no vectors")
+	}
+	return vectors
+}
+
+func TestBlockHeaderVectors(t *testing.T) {
+	for _, v := range loadHeaderVectors(t) {
+		t.Run(v.Description, func(t *testing.T) {
+			serialized, err := v.Header.Serialize()
+			if err != nil {
+				t.Fatalf("Serialize: %v", err)
+			}
+			if got := hex.EncodeToString(serialized); got != v.Serialized {
+				t.Fatalf("Serialize = %s, want %s", got, v.Serialized)
+			}
+
+			block := &Block{Header: v.Header}
+			if got := block.calculateHash(); got != v.Header.Hash {
+				t.Errorf("hash = %s, want %s", got, v.Header.Hash)
+			}
+
+			decoded, err := DeserializeBlockHeader(serialized)
+			if err != nil {
+				t.Fatalf("DeserializeBlockHeader: %v", err)
+			}
+
+			// An empty merkle root encodes as zeros and decodes as such
+			want := v.Header
+			if want.MerkleRoot == "" {
+				want.MerkleRoot = strings.Repeat("0", 64)
+			}
+			if *decoded != want {
+				t.Errorf("DeserializeBlockHeader = %+v, want %+v", *decoded, want)
+			}
+
+			reserialized, err := decoded.Serialize()
+			if err != nil {
+				t.Fatalf("Serialize of the decoded header: %v", err)
+			}
+			if got := hex.EncodeToString(reserialized); got != v.Serialized {
+				t.Errorf("round trip = %s, want %s", got, v.Serialized)
+			}
+		})
+	}
+}
+
+func TestBlockHeaderSerializeRejectsNonCanonicalHashes(t *testing.T) {
+	valid := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		name         string
+		previousHash string
+		merkleRoot   string
+	}{
+		{"uppercase previous hash", strings.ToUpper(valid), valid},
+		{"short previous hash", valid[:62], valid},
+		{"long merkle root", valid, valid + "00"},
+		{"non-hex merkle root", valid, "zz" + valid[2:]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := BlockHeader{PreviousHash: tt.previousHash, MerkleRoot: tt.merkleRoot}
+			if _, err := header.Serialize(); err == nil {
+				t.Errorf("Serialize accepted previous hash %q and merkle root %q", tt.previousHash, tt.merkleRoot)
+			}
+		})
+	}
+}
+
+func TestDeserializeBlockHeaderRejectsWrongLength(t *testing.T) {
+	for _, size := range []int{0, BlockHeaderSize - 1, BlockHeaderSize + 1} {
+		if _, err := DeserializeBlockHeader(make([]byte, size)); err == nil {
+			t.Errorf("DeserializeBlockHeader accepted %d bytes", size)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package blockchain
+
+import "fmt"
+
+type ErrorCode int
+
+const (
+	ErrBadBlockHash ErrorCode = iota
+	ErrHighHash
+	ErrBadDifficulty
+	ErrBadPrevHash
+	ErrBadHeight
+	ErrTimeTooOld
+	ErrTimeTooNew
+	ErrBadMerkleRoot
+	ErrMutatedBlock
+	ErrBadWitnessCommitment
+	ErrNoTransactions
+	ErrBlockTooBig
+	ErrTooManyTransactions
+	ErrFirstTxNotCoinbase
+	ErrMultipleCoinbases
+	ErrBadCoinbaseHeight
+	ErrBadCoinbaseValue
+	ErrInvalidTransaction
+	ErrTxTooBig
+	ErrTooManyInputs
+	ErrTooManyOutputs
+	ErrBadOutputValue
+	ErrBadInputValue
+	ErrDuplicateTx
+	ErrMissingInput
+	ErrDoubleSpend
+	ErrScriptFailed
+	ErrSpendTooHigh
+	ErrImmatureSpend
+	ErrUnfinalizedTx
+	ErrSequenceLocked
+	ErrDuplicateBlock
+	ErrOrphanBlock
+	ErrInvalidAncestor
+	ErrCheckpointMismatch
+	ErrForkBeforeCheckpoint
+)
+
+var errorCodeStrings = map[ErrorCode]string{
+	ErrBadBlockHash:         "bad-block-hash",
+	ErrHighHash:             "high-hash",
+	ErrBadDifficulty:        "bad-difficulty",
+	ErrBadPrevHash:          "bad-prev-hash",
+	ErrBadHeight:            "bad-height",
+	ErrTimeTooOld:           "time-too-old",
+	ErrTimeTooNew:           "time-too-new",
+	ErrBadMerkleRoot:        "bad-merkle-root",
+	ErrMutatedBlock:         "mutated-block",
+	ErrBadWitnessCommitment: "bad-witness-commitment",
+	ErrNoTransactions:       "no-transactions",
+	ErrBlockTooBig:          "block-too-big",
+	ErrTooManyTransactions:  "too-many-transactions",
+	ErrFirstTxNotCoinbase:   "first-tx-not-coinbase",
+	ErrMultipleCoinbases:    "multiple-coinbases",
+	ErrBadCoinbaseHeight:    "bad-coinbase-height",
+	ErrBadCoinbaseValue:     "bad-coinbase-value",
+	ErrInvalidTransaction:   "invalid-transaction",
+	ErrTxTooBig:             "tx-too-big",
+	ErrTooManyInputs:        "too-many-inputs",
+	ErrTooManyOutputs:       "too-many-outputs",
+	ErrBadOutputValue:       "bad-output-value",
+	ErrBadInputValue:        "bad-input-value",
+	ErrDuplicateTx:          "duplicate-tx",
+	ErrMissingInput:         "missing-input",
+	ErrDoubleSpend:          "double-spend",
+	ErrScriptFailed:         "script-failed",
+	ErrSpendTooHigh:         "spend-too-high",
+	ErrImmatureSpend:        "immature-spend",
+	ErrUnfinalizedTx:        "unfinalized-tx",
+	ErrSequenceLocked:       "sequence-locked",
+	ErrDuplicateBlock:       "duplicate-block",
+	ErrOrphanBlock:          "orphan-block",
+	ErrInvalidAncestor:      "invalid-ancestor",
+	ErrCheckpointMismatch:   "checkpoint-mismatch",
+	ErrForkBeforeCheckpoint: "fork-before-checkpoint",
+}
+
+func (e ErrorCode) String() string {
+	if s, exists := errorCodeStrings[e]; exists {
+		return s
+	}
+	return fmt.Sprintf("unknown-error-code-%d", int(e))
+}
+
+// RuleError identifies a block or transaction that breaks a consensus rule,
+// as opposed to an internal failure. Callers use errors.As to tell them apart.
+type RuleError struct {
+	Code        ErrorCode
+	Description string
+}
+
+func (e RuleError) Error() string {
+	return e.Description
+}
+
+func ruleError(code ErrorCode, format string, args ...interface{}) RuleError {
+	return RuleError{Code: code, Description: fmt.Sprintf(format, args...)}
+}
+
+// TxError reports which of a block's transactions broke a rule. It wraps the
+// RuleError, so errors.As still finds that.
+type TxError struct {
+	Index int // Position in the block; the coinbase is 0
+	TxID  string
+	Err   error
+}
+
+func (e TxError) Error() string {
+	return e.Err.Error()
+}
+
+func (e TxError) Unwrap() error {
+	return e.Err
+}
+
+func txError(index int, tx *Transaction, err error) TxError {
+	return TxError{Index: index, TxID: tx.ID, Err: err}
+}
+
+// PolicyError identifies a transaction that is valid by consensus but that
+// the node declines to mine because it breaks the standardness policy.
+type PolicyError struct {
+	Reason      string
+	Description string
+}
+
+func (e PolicyError) Error() string {
+	return e.Description
+}
+
+func policyError(reason string, format string, args ...interface{}) PolicyError {
+	return PolicyError{Reason: reason, Description: fmt.Sprintf(format, args...)}
+}
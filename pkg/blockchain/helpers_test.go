@@ -0,0 +1,183 @@
+package blockchain
+
+import (
+	"blockchain-node/pkg/crypto"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixedClock is a clock the test moves by hand.
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+// testStart is a time after the regtest genesis block.
+var testStart = time.Unix(RegTestParams.GenesisTimestamp, 0).Add(24 * time.Hour)
+
+// newTestChain starts a regtest chain whose clock reads testStart and whose
+// coinbase outputs mature after one block, so tests can spend them straight
+// away.
+func newTestChain(t *testing.T) (*Blockchain, *fixedClock) {
+	t.Helper()
+
+	params := RegTestParams
+	params.CoinbaseMaturity = 1
+	bc := newChainWithParams(t, &params)
+
+	clock := &fixedClock{now: testStart}
+	bc.SetClock(clock)
+	return bc, clock
+}
+
+// newChainWithParams starts a chain with params, failing the test if they
+// are invalid.
+func newChainWithParams(t *testing.T, params *ChainParams) *Blockchain {
+	t.Helper()
+
+	bc, err := NewBlockchainWithParams(params)
+	if err != nil {
+		t.Fatalf("NewBlockchainWithParams: %v", err)
+	}
+	return bc
+}
+
+func mineBlocks(t *testing.T, bc *Blockchain, address string, n int) []*Block {
+	t.Helper()
+
+	blocks := make([]*Block, n)
+	for i := range blocks {
+		block, err := bc.MineBlock(address, nil)
+		if err != nil {
+			t.Fatalf("MineBlock: %v", err)
+		}
+		blocks[i] = block
+	}
+	return blocks
+}
+
+// testKey is a key pair with its regtest address.
+type testKey struct {
+	keyPair   *crypto.KeyPair
+	publicKey []byte
+	address   string
+}
+
+func newTestKey(t *testing.T) *testKey {
+	t.Helper()
+
+	keyPair, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+
+	publicKey, err := hex.DecodeString(keyPair.GetPublicKeyHex())
+	if err != nil {
+		t.Fatalf("decoding public key: %v", err)
+	}
+
+	return &testKey{
+		keyPair:   keyPair,
+		publicKey: publicKey,
+		address:   crypto.GenerateAddressFromKeyPair(keyPair, RegTestParams.AddressVersion),
+	}
+}
+
+func (k *testKey) pubKeyHash(t *testing.T) []byte {
+	t.Helper()
+
+	hash, err := crypto.ExtractPublicKeyHash(k.address)
+	if err != nil {
+		t.Fatalf("ExtractPublicKeyHash: %v", err)
+	}
+	return hash
+}
+
+// sign returns k's signature of input i of tx spending prevOut.
+func (k *testKey) sign(t *testing.T, tx *Transaction, i int, prevOut *UTXO) []byte {
+	t.Helper()
+
+	signatureHex, err := crypto.SignHex(tx.SignatureHash(i, prevOut), k.keyPair.PrivateKey)
+	if err != nil {
+		t.Fatalf("SignHex: %v", err)
+	}
+	signature, err := hex.DecodeString(signatureHex)
+	if err != nil {
+		t.Fatalf("decoding signature: %v", err)
+	}
+	return signature
+}
+
+// signInput unlocks input i of tx, spending a pay-to-pubkey-hash prevOut,
+// with k's signature.
+func (k *testKey) signInput(t *testing.T, tx *Transaction, i int, prevOut *UTXO) {
+	t.Helper()
+
+	tx.Inputs[i].UnlockingScript = SignatureScript(k.sign(t, tx, i, prevOut), k.publicKey)
+}
+
+// output returns output i of tx as an unspent output.
+func output(tx *Transaction, i int) *UTXO {
+	return &UTXO{
+		OutPoint: OutPoint{TxID: tx.ID, Index: i},
+		Value:    tx.Outputs[i].Value,
+		Address:  tx.Outputs[i].Address,
+	}
+}
+
+// fund adds a confirmed transaction paying values to address, without
+// mining a block for it.
+func fund(bc *Blockchain, address string, values ...int64) *Transaction {
+	outputs := make([]TxOutput, len(values))
+	for i, value := range values {
+		outputs[i] = TxOutput{Value: value, Address: address}
+	}
+
+	tx := NewTransaction(nil, outputs)
+	bc.updateUTXOSet(&Block{Header: BlockHeader{Height: 1}, Transactions: []Transaction{*tx}})
+	return tx
+}
+
+// childBlock returns a block mined on parent a second after it, at parent's
+// difficulty, which holds until the next retarget, with a coinbase paying
+// value to address.
+func childBlock(parent *Block, address string, value int64, transactions ...Transaction) *Block {
+	height := parent.Header.Height + 1
+	coinbase := NewCoinbaseTransaction(address, value, height)
+	block := NewBlock(append([]Transaction{*coinbase}, transactions...), parent.Header.Hash, height)
+	block.Header.Timestamp = parent.Header.Timestamp + 1
+	block.Mine(parent.Header.Difficulty)
+	return block
+}
+
+// testView is a UTXOView over a fixed set of outputs.
+type testView map[OutPoint]*UTXO
+
+func (v testView) Get(op OutPoint) (*UTXO, bool) {
+	entry, exists := v[op]
+	return entry, exists
+}
+
+// testOutput is an output worth one coin locked by script, or paying
+// address if script is nil.
+func testOutput(address string, script Script) *UTXO {
+	return &UTXO{
+		OutPoint:      OutPoint{TxID: strings.Repeat("ab", 32), Index: 0},
+		Value:         100000000,
+		Address:       address,
+		LockingScript: script,
+	}
+}
+
+// spendingTx is an unsigned transaction spending prevOut as its only input.
+func spendingTx(prevOut *UTXO) *Transaction {
+	return NewTransaction(
+		[]TxInput{{TxID: prevOut.OutPoint.TxID, OutputIndex: prevOut.OutPoint.Index}},
+		[]TxOutput{{Value: prevOut.Value - 1000, Address: prevOut.Address}},
+	)
+}
@@ -0,0 +1,469 @@
+package blockchain
+
+import (
+	"blockchain-node/pkg/crypto"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Limits on script execution, bounding the work a single input can demand.
+const (
+	MaxScriptSize        = 10000 // Bytes in one script
+	MaxScriptElementSize = 520   // Bytes in one stack value
+	MaxStackSize         = 1000  // Values on the stack
+	MaxScriptOps         = 201   // Non-push opcodes in one script, counting each multisig key
+	MaxMultiSigKeys      = 15    // Keys in one multisig check; more would not fit a redeem script in one stack value
+)
+
+// VerifyScript checks that input inputIndex of tx may spend prevOut: its
+// unlocking script, which may only push data, is run and then the output's
+// locking script on the resulting stack, which must end with a true value
+// on top. If the output is pay-to-script-hash, the redeem script pushed last
+// by the unlocking script is then run on the rest of what it pushed, and
+// must succeed too.
+//
+// Scripts see only the transaction and the output spent, never the chain, so
+// the result does not depend on the block the transaction is mined in. Lock
+// time opcodes check the transaction's own lock fields, which block
+// validation enforces.
+func VerifyScript(tx *Transaction, inputIndex int, prevOut *UTXO) error {
+	if inputIndex < 0 || inputIndex >= len(tx.Inputs) {
+		return fmt.Errorf("input index %d out of range", inputIndex)
+	}
+
+	locking, err := lockingScript(prevOut.Address, prevOut.LockingScript)
+	if err != nil {
+		return fmt.Errorf("output %s is unspendable: %v", prevOut.OutPoint, err)
+	}
+
+	unlocking := tx.Inputs[inputIndex].UnlockingScript
+	instructions, err := parseScript(unlocking)
+	if err != nil {
+		return fmt.Errorf("unlocking script: %v", err)
+	}
+	if !isPushOnly(instructions) {
+		return errors.New("unlocking script may only push data")
+	}
+
+	engine := &scriptEngine{
+		tx:         tx,
+		inputIndex: inputIndex,
+		prevOut:    prevOut,
+	}
+
+	if err := engine.execute(unlocking); err != nil {
+		return fmt.Errorf("unlocking script: %v", err)
+	}
+	pushed := append([][]byte(nil), engine.stack...)
+
+	if err := engine.execute(locking); err != nil {
+		return fmt.Errorf("locking script: %v", err)
+	}
+	if !engine.succeeded() {
+		return errors.New("script evaluated to false")
+	}
+
+	if !isPayToScriptHash(locking) {
+		return nil
+	}
+
+	// The locking script has checked the redeem script's hash
+	redeemScript := pushed[len(pushed)-1]
+	engine.stack = pushed[:len(pushed)-1]
+	if err := engine.execute(redeemScript); err != nil {
+		return fmt.Errorf("redeem script: %v", err)
+	}
+	if !engine.succeeded() {
+		return errors.New("redeem script evaluated to false")
+	}
+	return nil
+}
+
+// scriptEngine runs scripts for a single input. The stack carries over
+// from the unlocking script to the locking script.
+type scriptEngine struct {
+	tx         *Transaction
+	inputIndex int
+	prevOut    *UTXO
+
+	stack [][]byte
+
+	// conditions holds, for each enclosing OpIf, whether its branch being
+	// run is the one taken.
+	conditions []bool
+
+	// ops counts the operations run by the current script.
+	ops int
+}
+
+func (e *scriptEngine) execute(script Script) error {
+	if len(script) > MaxScriptSize {
+		return fmt.Errorf("script is %d bytes, limit is %d", len(script), MaxScriptSize)
+	}
+
+	instructions, err := parseScript(script)
+	if err != nil {
+		return err
+	}
+
+	e.conditions = nil
+	e.ops = 0
+	for _, ins := range instructions {
+		if ins.op > Op16 {
+			if err := e.countOps(1); err != nil {
+				return err
+			}
+		}
+
+		if len(ins.data) > MaxScriptElementSize {
+			return fmt.Errorf("push of %d bytes, limit is %d", len(ins.data), MaxScriptElementSize)
+		}
+
+		if !e.executing() && !isConditional(ins.op) {
+			continue
+		}
+
+		if err := e.step(ins); err != nil {
+			return fmt.Errorf("%s: %v", opcodeName(ins.op), err)
+		}
+
+		if len(e.stack) > MaxStackSize {
+			return fmt.Errorf("stack holds more than %d values", MaxStackSize)
+		}
+	}
+
+	if len(e.conditions) != 0 {
+		return errors.New("unbalanced conditional")
+	}
+	return nil
+}
+
+// succeeded reports whether a script left a true value on top of the stack.
+func (e *scriptEngine) succeeded() bool {
+	return len(e.stack) > 0 && asBool(e.stack[len(e.stack)-1])
+}
+
+// executing reports whether every enclosing branch is taken.
+func (e *scriptEngine) executing() bool {
+	for _, taken := range e.conditions {
+		if !taken {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *scriptEngine) countOps(n int) error {
+	if e.ops += n; e.ops > MaxScriptOps {
+		return fmt.Errorf("more than %d operations", MaxScriptOps)
+	}
+	return nil
+}
+
+func isConditional(op byte) bool {
+	return op == OpIf || op == OpNotIf || op == OpElse || op == OpEndIf
+}
+
+func (e *scriptEngine) step(ins instruction) error {
+	switch op := ins.op; {
+	case op <= OpPushData2:
+		e.push(ins.data)
+
+	case op >= Op1 && op <= Op16:
+		e.push(encodeScriptNum(int64(op - Op1 + 1)))
+
+	case op == OpIf || op == OpNotIf:
+		// A branch inside one not taken is never taken, whatever its value
+		taken := false
+		if e.executing() {
+			value, err := e.pop()
+			if err != nil {
+				return err
+			}
+			taken = asBool(value) == (op == OpIf)
+		}
+		e.conditions = append(e.conditions, taken)
+
+	case op == OpElse:
+		if len(e.conditions) == 0 {
+			return errors.New("no matching OP_IF")
+		}
+		e.conditions[len(e.conditions)-1] = !e.conditions[len(e.conditions)-1]
+
+	case op == OpEndIf:
+		if len(e.conditions) == 0 {
+			return errors.New("no matching OP_IF")
+		}
+		e.conditions = e.conditions[:len(e.conditions)-1]
+
+	case op == OpVerify:
+		value, err := e.pop()
+		if err != nil {
+			return err
+		}
+		if !asBool(value) {
+			return errors.New("verification failed")
+		}
+
+	case op == OpReturn:
+		return errors.New("output is provably unspendable")
+
+	case op == OpDrop:
+		_, err := e.pop()
+		return err
+
+	case op == OpDup:
+		value, err := e.peek()
+		if err != nil {
+			return err
+		}
+		e.push(value)
+
+	case op == OpEqual || op == OpEqualVerify:
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		a, err := e.pop()
+		if err != nil {
+			return err
+		}
+		equal := bytes.Equal(a, b)
+		if op == OpEqualVerify {
+			if !equal {
+				return errors.New("values are not equal")
+			}
+			return nil
+		}
+		e.pushBool(equal)
+
+	case op == OpSHA256:
+		value, err := e.pop()
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(value)
+		e.push(hash[:])
+
+	case op == OpHash160:
+		value, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.push(crypto.Hash160(value))
+
+	case op == OpCheckSig || op == OpCheckSigVerify:
+		publicKey, err := e.pop()
+		if err != nil {
+			return err
+		}
+		signature, err := e.pop()
+		if err != nil {
+			return err
+		}
+		valid := e.checkSignature(signature, publicKey)
+		if op == OpCheckSigVerify {
+			if !valid {
+				return errors.New("invalid signature")
+			}
+			return nil
+		}
+		e.pushBool(valid)
+
+	case op == OpCheckMultiSig || op == OpCheckMultiSigVerify:
+		valid, err := e.checkMultiSig()
+		if err != nil {
+			return err
+		}
+		if op == OpCheckMultiSigVerify {
+			if !valid {
+				return errors.New("not enough valid signatures")
+			}
+			return nil
+		}
+		e.pushBool(valid)
+
+	case op == OpCheckLockTimeVerify:
+		// The lock time is left on the stack for a following OpDrop
+		value, err := e.peek()
+		if err != nil {
+			return err
+		}
+		lockTime, err := decodeScriptNum(value, 5)
+		if err != nil {
+			return err
+		}
+		return e.checkLockTime(lockTime)
+
+	case op == OpCheckSequenceVerify:
+		// Like OpCheckLockTimeVerify, for a relative lock
+		value, err := e.peek()
+		if err != nil {
+			return err
+		}
+		sequence, err := decodeScriptNum(value, 5)
+		if err != nil {
+			return err
+		}
+		return e.checkSequence(sequence)
+
+	default:
+		return errors.New("unknown opcode")
+	}
+
+	return nil
+}
+
+// checkSignature reports whether signature is a valid signature by
+// publicKey of the input's signature hash. Malformed keys and signatures
+// are simply invalid, so a script may test for them.
+func (e *scriptEngine) checkSignature(signature, publicKey []byte) bool {
+	pubKey, err := crypto.PublicKeyFromHex(hex.EncodeToString(publicKey))
+	if err != nil {
+		return false
+	}
+	sigHash := e.tx.SignatureHash(e.inputIndex, e.prevOut)
+	if sigHash == nil {
+		return false
+	}
+	return crypto.VerifyHex(sigHash, hex.EncodeToString(signature), pubKey)
+}
+
+// checkMultiSig pops a key count, that many keys, a signature count and
+// that many signatures, and reports whether every signature is valid for a
+// distinct key. Signatures must be in the order of their keys, so each key
+// is tried at most once.
+func (e *scriptEngine) checkMultiSig() (bool, error) {
+	keyCount, err := e.popInt(MaxMultiSigKeys)
+	if err != nil {
+		return false, err
+	}
+	if err := e.countOps(keyCount); err != nil {
+		return false, err
+	}
+
+	publicKeys := make([][]byte, keyCount)
+	for i := keyCount - 1; i >= 0; i-- {
+		if publicKeys[i], err = e.pop(); err != nil {
+			return false, err
+		}
+	}
+
+	signatureCount, err := e.popInt(keyCount)
+	if err != nil {
+		return false, err
+	}
+
+	signatures := make([][]byte, signatureCount)
+	for i := signatureCount - 1; i >= 0; i-- {
+		if signatures[i], err = e.pop(); err != nil {
+			return false, err
+		}
+	}
+
+	key := 0
+	for _, signature := range signatures {
+		for key < len(publicKeys) && !e.checkSignature(signature, publicKeys[key]) {
+			key++
+		}
+		if key == len(publicKeys) {
+			return false, nil
+		}
+		key++
+	}
+	return true, nil
+}
+
+// popInt pops a count between 0 and max.
+func (e *scriptEngine) popInt(max int) (int, error) {
+	value, err := e.pop()
+	if err != nil {
+		return 0, err
+	}
+	n, err := decodeScriptNum(value, 4)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > int64(max) {
+		return 0, fmt.Errorf("count %d out of range 0 to %d", n, max)
+	}
+	return int(n), nil
+}
+
+// checkLockTime fails unless the transaction's lock time is at least
+// lockTime, both being heights or both times. Blocks only include the
+// transaction once its lock time has passed, so the output cannot be spent
+// before lockTime either.
+func (e *scriptEngine) checkLockTime(lockTime int64) error {
+	if lockTime < 0 {
+		return errors.New("negative lock time")
+	}
+
+	txLockTime := e.tx.LockTime
+	if (lockTime < LockTimeThreshold) != (txLockTime < LockTimeThreshold) {
+		return fmt.Errorf("lock time %d and transaction lock time %d are not both heights or both times", lockTime, txLockTime)
+	}
+	if txLockTime < lockTime {
+		return fmt.Errorf("locked until %d, transaction lock time is %d", lockTime, txLockTime)
+	}
+	return nil
+}
+
+// checkSequence is checkLockTime for a relative lock, compared with the
+// input's sequence.
+func (e *scriptEngine) checkSequence(sequence int64) error {
+	if !validSequence(sequence) {
+		return fmt.Errorf("invalid relative lock %#x", sequence)
+	}
+
+	inputSequence := int64(e.tx.Inputs[e.inputIndex].Sequence)
+	if sequence&SequenceLockTimeIsSeconds != inputSequence&SequenceLockTimeIsSeconds {
+		return fmt.Errorf("relative lock %#x and input sequence %#x are not both heights or both times", sequence, inputSequence)
+	}
+	if inputSequence&SequenceLockTimeMask < sequence&SequenceLockTimeMask {
+		return fmt.Errorf("locked for %d, input sequence is %d", sequence&SequenceLockTimeMask, inputSequence&SequenceLockTimeMask)
+	}
+	return nil
+}
+
+func (e *scriptEngine) push(value []byte) {
+	e.stack = append(e.stack, value)
+}
+
+func (e *scriptEngine) pushBool(value bool) {
+	if value {
+		e.push([]byte{1})
+	} else {
+		e.push(nil)
+	}
+}
+
+func (e *scriptEngine) pop() ([]byte, error) {
+	value, err := e.peek()
+	if err != nil {
+		return nil, err
+	}
+	e.stack = e.stack[:len(e.stack)-1]
+	return value, nil
+}
+
+func (e *scriptEngine) peek() ([]byte, error) {
+	if len(e.stack) == 0 {
+		return nil, errors.New("stack is empty")
+	}
+	return e.stack[len(e.stack)-1], nil
+}
+
+// asBool interprets a stack value as a boolean: false if every byte is
+// zero, allowing a sign bit on the last (negative zero).
+func asBool(value []byte) bool {
+	for i, b := range value {
+		if b != 0 {
+			return i != len(value)-1 || b != 0x80
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestVerifyScriptPayToPubKeyHash(t *testing.T) {
+	key := newTestKey(t)
+	otherKey := newTestKey(t)
+
+	tests := []struct {
+		name string
+		// unlock returns the unlocking script for tx spending prevOut
+		unlock  func(tx *Transaction, prevOut *UTXO) Script
+		script  bool // lock with an explicit script rather than the address
+		wantErr bool
+	}{
+		{
+			name: "address output",
+			unlock: func(tx *Transaction, prevOut *UTXO) Script {
+				return SignatureScript(key.sign(t, tx, 0, prevOut), key.publicKey)
+			},
+		},
+		{
+			name:   "script output",
+			script: true,
+			unlock: func(tx *Transaction, prevOut *UTXO) Script {
+				return SignatureScript(key.sign(t, tx, 0, prevOut), key.publicKey)
+			},
+		},
+		{
+			name: "signature by another key",
+			unlock: func(tx *Transaction, prevOut *UTXO) Script {
+				return SignatureScript(otherKey.sign(t, tx, 0, prevOut), key.publicKey)
+			},
+			wantErr: true,
+		},
+		{
+			name: "another key for the hash",
+			unlock: func(tx *Transaction, prevOut *UTXO) Script {
+				return SignatureScript(otherKey.sign(t, tx, 0, prevOut), otherKey.publicKey)
+			},
+			wantErr: true,
+		},
+		{
+			name: "signature of another output",
+			unlock: func(tx *Transaction, prevOut *UTXO) Script {
+				other := *prevOut
+				other.Value++
+				return SignatureScript(key.sign(t, tx, 0, &other), key.publicKey)
+			},
+			wantErr: true,
+		},
+		{
+			name: "malformed signature",
+			unlock: func(tx *Transaction, prevOut *UTXO) Script {
+				return SignatureScript([]byte{1, 2, 3}, key.publicKey)
+			},
+			wantErr: true,
+		},
+		{
+			name: "public key only",
+			unlock: func(tx *Transaction, prevOut *UTXO) Script {
+				return NewScriptBuilder().AddData(key.publicKey).Script()
+			},
+			wantErr: true,
+		},
+		{
+			name: "empty",
+			unlock: func(tx *Transaction, prevOut *UTXO) Script {
+				return nil
+			},
+			wantErr: true,
+		},
+		{
+			name: "not push only",
+			unlock: func(tx *Transaction, prevOut *UTXO) Script {
+				return NewScriptBuilder().AddData(key.sign(t, tx, 0, prevOut)).AddData(key.publicKey).AddOp(OpDup).AddOp(OpDrop).Script()
+			},
+			wantErr: true,
+		},
+		{
+			name: "truncated push",
+			unlock: func(tx *Transaction, prevOut *UTXO) Script {
+				return Script{OpPushData1, 10, 1, 2}
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prevOut := testOutput(key.address, nil)
+			if tt.script {
+				prevOut = testOutput("", PayToPubKeyHashScript(key.pubKeyHash(t)))
+			}
+
+			tx := spendingTx(prevOut)
+			tx.Inputs[0].UnlockingScript = tt.unlock(tx, prevOut)
+
+			err := VerifyScript(tx, 0, prevOut)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyScript error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyScriptRejectsChangedTransaction(t *testing.T) {
+	key := newTestKey(t)
+	prevOut := testOutput(key.address, nil)
+
+	tx := spendingTx(prevOut)
+	tx.Inputs[0].UnlockingScript = SignatureScript(key.sign(t, tx, 0, prevOut), key.publicKey)
+	if err := VerifyScript(tx, 0, prevOut); err != nil {
+		t.Fatalf("VerifyScript: %v", err)
+	}
+
+	tx.Outputs[0].Value--
+	if err := VerifyScript(tx, 0, prevOut); err == nil {
+		t.Error("VerifyScript accepted a signature after an output changed")
+	}
+
+	if err := VerifyScript(tx, 1, prevOut); err == nil {
+		t.Error("VerifyScript accepted an input index out of range")
+	}
+}
+
+// repeat returns a script of n copies of op.
+func repeat(op byte, n int) Script {
+	return Script(bytes.Repeat([]byte{op}, n))
+}
+
+func TestVerifyScriptExecution(t *testing.T) {
+	secret := []byte("secret")
+	hash := sha256.Sum256(secret)
+	conditional := NewScriptBuilder().AddOp(OpIf).AddInt(1).AddOp(OpElse).AddData(nil).AddOp(OpEndIf).Script()
+	verify := NewScriptBuilder().AddOp(OpVerify).AddInt(1).Script()
+
+	tests := []struct {
+		name      string
+		unlocking Script
+		locking   Script
+		wantErr   bool
+	}{
+		{"if taken", NewScriptBuilder().AddInt(1).Script(), conditional, false},
+		{"else taken", NewScriptBuilder().AddData(nil).Script(), conditional, true},
+		{"notif", NewScriptBuilder().AddData(nil).Script(), NewScriptBuilder().AddOp(OpNotIf).AddInt(1).AddOp(OpEndIf).Script(), false},
+		{"nested branch not taken", NewScriptBuilder().AddData(nil).Script(), NewScriptBuilder().AddOp(OpIf).AddOp(OpIf).AddOp(OpReturn).AddOp(OpEndIf).AddOp(OpEndIf).AddInt(1).Script(), false},
+		{"unbalanced if", NewScriptBuilder().AddInt(1).Script(), NewScriptBuilder().AddOp(OpIf).AddInt(1).Script(), true},
+		{"else without if", NewScriptBuilder().AddInt(1).Script(), NewScriptBuilder().AddOp(OpElse).Script(), true},
+		{"endif without if", NewScriptBuilder().AddInt(1).Script(), NewScriptBuilder().AddOp(OpEndIf).Script(), true},
+		{"return", NewScriptBuilder().AddInt(1).Script(), NewScriptBuilder().AddOp(OpReturn).Script(), true},
+		{"unknown opcode", NewScriptBuilder().AddInt(1).Script(), Script{0x61}, true},
+		{"empty stack", nil, NewScriptBuilder().AddOp(OpDrop).AddInt(1).Script(), true},
+		{"ends false", nil, NewScriptBuilder().AddData(nil).Script(), true},
+		{"equal", NewScriptBuilder().AddInt(2).Script(), NewScriptBuilder().AddInt(2).AddOp(OpEqual).Script(), false},
+		{"not equal", NewScriptBuilder().AddInt(2).Script(), NewScriptBuilder().AddInt(3).AddOp(OpEqual).Script(), true},
+		{"equal verify fails", NewScriptBuilder().AddInt(2).Script(), NewScriptBuilder().AddInt(3).AddOp(OpEqualVerify).AddInt(1).Script(), true},
+		{"hash preimage", NewScriptBuilder().AddData(secret).Script(), NewScriptBuilder().AddOp(OpSHA256).AddData(hash[:]).AddOp(OpEqual).Script(), false},
+		{"wrong preimage", NewScriptBuilder().AddData([]byte("guess")).Script(), NewScriptBuilder().AddOp(OpSHA256).AddData(hash[:]).AddOp(OpEqual).Script(), true},
+		{"true", NewScriptBuilder().AddData([]byte{0x80, 0}).Script(), verify, false},
+		{"zero", NewScriptBuilder().AddData([]byte{0, 0}).Script(), verify, true},
+		{"negative zero", NewScriptBuilder().AddData([]byte{0, 0x80}).Script(), verify, true},
+		{"operations at limit", NewScriptBuilder().AddInt(1).Script(), repeat(OpDup, MaxScriptOps), false},
+		{"operations over limit", NewScriptBuilder().AddInt(1).Script(), repeat(OpDup, MaxScriptOps+1), true},
+		{"push at limit", NewScriptBuilder().AddData(make([]byte, MaxScriptElementSize)).Script(), NewScriptBuilder().AddOp(OpDrop).AddInt(1).Script(), false},
+		{"push over limit", NewScriptBuilder().AddData(make([]byte, MaxScriptElementSize+1)).Script(), NewScriptBuilder().AddOp(OpDrop).AddInt(1).Script(), true},
+		{"stack at limit", repeat(Op1, MaxStackSize), NewScriptBuilder().AddOp(OpDrop).AddInt(1).Script(), false},
+		{"stack over limit", repeat(Op1, MaxStackSize+1), NewScriptBuilder().AddInt(1).Script(), true},
+		{"script over limit", nil, append(repeat(Op1, MaxScriptSize), OpDup), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prevOut := testOutput("", tt.locking)
+			tx := spendingTx(prevOut)
+			tx.Inputs[0].UnlockingScript = tt.unlocking
+
+			err := VerifyScript(tx, 0, prevOut)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyScript error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package blockchain
+
+// A transaction's LockTime is the first block it may be mined in: a block
+// height, or a median time past if at least LockTimeThreshold. Zero, the
+// default, is always satisfied.
+const LockTimeThreshold = 500000000
+
+// An input's Sequence locks it relative to the output it spends: it may not
+// be mined until that output has aged the number of blocks in the low 16
+// bits, or, with SequenceLockTimeIsSeconds set, that many 512-second units
+// of median time past. Zero, the default, sets no relative lock.
+const (
+	SequenceLockTimeIsSeconds   = 1 << 22
+	SequenceLockTimeMask        = 0x0000ffff
+	SequenceLockTimeGranularity = 9 // Seconds are counted in units of 1<<9
+)
+
+// validSequence reports whether a sequence sets only the bits defined above.
+func validSequence(sequence int64) bool {
+	return sequence >= 0 && sequence&^(SequenceLockTimeIsSeconds|SequenceLockTimeMask) == 0
+}
+
+// IsFinal reports whether the transaction's lock time allows it into a block
+// at blockHeight whose parent has median time past blockTime.
+func (tx *Transaction) IsFinal(blockHeight, blockTime int64) bool {
+	if tx.LockTime < LockTimeThreshold {
+		return blockHeight >= tx.LockTime
+	}
+	return blockTime >= tx.LockTime
+}
+
+// medianTimeBefore returns the median time past of the block before height
+// on the best chain, which a relative time lock on an output created at
+// height counts from. Heights past the tip, for outputs not yet mined, use
+// the tip.
+func (bc *Blockchain) medianTimeBefore(height int64) int64 {
+	if height > int64(len(bc.bestChain)) {
+		height = int64(len(bc.bestChain))
+	}
+	if height < 1 {
+		height = 1
+	}
+	return bc.bestChain[height-1].medianTimePast(bc.params.MedianTimeBlocks)
+}
+
+// checkLockTimes fails unless tx may be mined in a block at height whose
+// parent has median time past blockTime: its lock time must have passed, and
+// each input's relative lock counted from the output it spends, resolved
+// through view.
+func (bc *Blockchain) checkLockTimes(tx *Transaction, view UTXOView, height, blockTime int64) error {
+	if !tx.IsFinal(height, blockTime) {
+		if tx.LockTime < LockTimeThreshold {
+			return ruleError(ErrUnfinalizedTx, "transaction %s is locked until height %d, block height is %d", tx.ID, tx.LockTime, height)
+		}
+		return ruleError(ErrUnfinalizedTx, "transaction %s is locked until time %d, block time is %d", tx.ID, tx.LockTime, blockTime)
+	}
+
+	for i, input := range tx.Inputs {
+		if input.Sequence == 0 {
+			continue
+		}
+
+		op := OutPoint{TxID: input.TxID, Index: input.OutputIndex}
+		entry, exists := view.Get(op)
+		if !exists {
+			return ruleError(ErrMissingInput, "transaction %s input %d references missing or spent output %s", tx.ID, i, op)
+		}
+
+		value := int64(input.Sequence & SequenceLockTimeMask)
+		if input.Sequence&SequenceLockTimeIsSeconds != 0 {
+			if unlockTime := bc.medianTimeBefore(entry.Height) + value<<SequenceLockTimeGranularity; blockTime < unlockTime {
+				return ruleError(ErrSequenceLocked, "transaction %s input %d is locked until time %d, block time is %d", tx.ID, i, unlockTime, blockTime)
+			}
+		} else if unlockHeight := entry.Height + value; height < unlockHeight {
+			return ruleError(ErrSequenceLocked, "transaction %s input %d is locked until height %d, block height is %d", tx.ID, i, unlockHeight, height)
+		}
+	}
+
+	return nil
+}
+
+// CheckTransactionLocks fails unless tx's lock time and relative locks let it
+// into the next block. Its inputs are resolved through view, or the UTXO set
+// if view is nil. Blocks are checked as they connect; this is for
+// transactions still waiting to be mined.
+func (bc *Blockchain) CheckTransactionLocks(tx *Transaction, view UTXOView) error {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	if view == nil {
+		view = bc.utxoSet
+	}
+
+	tip := bc.tip()
+	return bc.checkLockTimes(tx, view, tip.height+1, tip.medianTimePast(bc.params.MedianTimeBlocks))
+}
@@ -0,0 +1,230 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIsFinal(t *testing.T) {
+	const lockTime = LockTimeThreshold + 1000
+
+	tests := []struct {
+		name      string
+		lockTime  int64
+		height    int64
+		blockTime int64
+		want      bool
+	}{
+		{"no lock", 0, 1, 0, true},
+		{"before lock height", 100, 99, lockTime, false},
+		{"at lock height", 100, 100, 0, true},
+		{"after lock height", 100, 101, 0, true},
+		{"height below threshold", LockTimeThreshold - 1, LockTimeThreshold - 2, lockTime, false},
+		{"before lock time", lockTime, lockTime, lockTime - 1, false},
+		{"at lock time", lockTime, 1, lockTime, true},
+		{"after lock time", lockTime, 1, lockTime + 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := &Transaction{LockTime: tt.lockTime}
+			if got := tx.IsFinal(tt.height, tt.blockTime); got != tt.want {
+				t.Errorf("IsFinal(%d, %d) with lock time %d = %v, want %v", tt.height, tt.blockTime, tt.lockTime, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckLockTimes(t *testing.T) {
+	bc, clock := newTestChain(t)
+	miner := newTestKey(t)
+	for i := 0; i < 20; i++ {
+		clock.now = testStart.Add(time.Duration(i) * 10 * time.Minute)
+		mineBlocks(t, bc, miner.address, 1)
+	}
+
+	const outputHeight = 10
+	prevOut := testOutput(miner.address, nil)
+	prevOut.Height = outputHeight
+	view := testView{prevOut.OutPoint: prevOut}
+
+	lockTime := testStart.Unix()
+	unlockTime := bc.medianTimeBefore(outputHeight) + 2<<SequenceLockTimeGranularity
+
+	tests := []struct {
+		name      string
+		lockTime  int64
+		sequence  uint32
+		missing   bool // leave the output spent out of the view
+		height    int64
+		blockTime int64
+		wantCode  ErrorCode
+		wantErr   bool
+	}{
+		{name: "no locks", height: 1, blockTime: 0},
+		{name: "at lock height", lockTime: 25, height: 25},
+		{name: "before lock height", lockTime: 25, height: 24, wantCode: ErrUnfinalizedTx, wantErr: true},
+		{name: "at lock time", lockTime: lockTime, height: 1, blockTime: lockTime},
+		{name: "before lock time", lockTime: lockTime, height: 1000, blockTime: lockTime - 1, wantCode: ErrUnfinalizedTx, wantErr: true},
+		{name: "at relative height", sequence: 5, height: outputHeight + 5},
+		{name: "before relative height", sequence: 5, height: outputHeight + 4, wantCode: ErrSequenceLocked, wantErr: true},
+		{name: "at relative time", sequence: SequenceLockTimeIsSeconds | 2, height: 1000, blockTime: unlockTime},
+		{name: "before relative time", sequence: SequenceLockTimeIsSeconds | 2, height: 1000, blockTime: unlockTime - 1, wantCode: ErrSequenceLocked, wantErr: true},
+		{name: "relative lock on a missing output", sequence: 5, missing: true, height: 1000, wantCode: ErrMissingInput, wantErr: true},
+		{name: "no relative lock on a missing output", missing: true, height: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := spendingTx(prevOut)
+			tx.LockTime = tt.lockTime
+			tx.Inputs[0].Sequence = tt.sequence
+			tx.SetID()
+
+			txView := view
+			if tt.missing {
+				txView = testView{}
+			}
+
+			err := bc.checkLockTimes(tx, txView, tt.height, tt.blockTime)
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("checkLockTimes = %v, want nil", err)
+				}
+				return
+			}
+
+			var ruleErr RuleError
+			if !errors.As(err, &ruleErr) || ruleErr.Code != tt.wantCode {
+				t.Errorf("checkLockTimes = %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestCheckTransactionLocksUsesNextBlock(t *testing.T) {
+	bc, _ := newTestChain(t)
+	miner := newTestKey(t)
+	mineBlocks(t, bc, miner.address, 5)
+
+	prevOut := testOutput(miner.address, nil)
+	view := testView{prevOut.OutPoint: prevOut}
+
+	tx := spendingTx(prevOut)
+	tx.LockTime = bc.tip().height + 1
+	tx.SetID()
+	if err := bc.CheckTransactionLocks(tx, view); err != nil {
+		t.Errorf("CheckTransactionLocks with lock time at the next height = %v, want nil", err)
+	}
+
+	tx.LockTime++
+	tx.SetID()
+	if err := bc.CheckTransactionLocks(tx, view); err == nil {
+		t.Error("CheckTransactionLocks accepted a lock time past the next height")
+	}
+}
+
+func TestVerifyScriptLockTimes(t *testing.T) {
+	key := newTestKey(t)
+	const lockTime = LockTimeThreshold + 1000
+
+	tests := []struct {
+		name string
+		// relative locks with RelativeTimeLockScript, else TimeLockScript
+		relative   bool
+		lock       int64
+		txLockTime int64
+		sequence   uint32
+		wantErr    bool
+	}{
+		{name: "height reached", lock: 100, txLockTime: 100},
+		{name: "height passed", lock: 100, txLockTime: 150},
+		{name: "height not reached", lock: 100, txLockTime: 99, wantErr: true},
+		{name: "time reached", lock: lockTime, txLockTime: lockTime},
+		{name: "time not reached", lock: lockTime, txLockTime: lockTime - 1, wantErr: true},
+		{name: "time lock with height", lock: lockTime, txLockTime: 100, wantErr: true},
+		{name: "height lock with time", lock: 100, txLockTime: lockTime, wantErr: true},
+		{name: "no lock time", lock: 100, wantErr: true},
+		{name: "relative height reached", relative: true, lock: 10, sequence: 10},
+		{name: "relative height passed", relative: true, lock: 10, sequence: 11},
+		{name: "relative height not reached", relative: true, lock: 10, sequence: 9, wantErr: true},
+		{name: "relative time reached", relative: true, lock: SequenceLockTimeIsSeconds | 10, sequence: SequenceLockTimeIsSeconds | 10},
+		{name: "relative time not reached", relative: true, lock: SequenceLockTimeIsSeconds | 10, sequence: SequenceLockTimeIsSeconds | 9, wantErr: true},
+		{name: "relative time with height", relative: true, lock: SequenceLockTimeIsSeconds | 10, sequence: 10, wantErr: true},
+		{name: "relative height with time", relative: true, lock: 10, sequence: SequenceLockTimeIsSeconds | 10, wantErr: true},
+		{name: "no sequence", relative: true, lock: 10, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := TimeLockScript(tt.lock, key.pubKeyHash(t))
+			if tt.relative {
+				script = RelativeTimeLockScript(uint32(tt.lock), key.pubKeyHash(t))
+			}
+			prevOut := testOutput("", script)
+
+			tx := spendingTx(prevOut)
+			tx.LockTime = tt.txLockTime
+			tx.Inputs[0].Sequence = tt.sequence
+			tx.SetID()
+			tx.Inputs[0].UnlockingScript = SignatureScript(key.sign(t, tx, 0, prevOut), key.publicKey)
+
+			err := VerifyScript(tx, 0, prevOut)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyScript error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseTimeLockScript(t *testing.T) {
+	pubKeyHash := newTestKey(t).pubKeyHash(t)
+
+	// lockScript is a time lock script whose lock is pushed by push
+	lockScript := func(push Script) Script {
+		script := append(push, OpCheckLockTimeVerify, OpDrop)
+		return append(script, PayToPubKeyHashScript(pubKeyHash)...)
+	}
+
+	tests := []struct {
+		name         string
+		script       Script
+		wantLock     int64
+		wantRelative bool
+		wantErr      bool
+	}{
+		{"small height", TimeLockScript(16, pubKeyHash), 16, false, false},
+		{"height", TimeLockScript(100000, pubKeyHash), 100000, false, false},
+		{"time", TimeLockScript(LockTimeThreshold+1, pubKeyHash), LockTimeThreshold + 1, false, false},
+		{"relative height", RelativeTimeLockScript(10, pubKeyHash), 10, true, false},
+		{"relative time", RelativeTimeLockScript(SequenceLockTimeIsSeconds|10, pubKeyHash), SequenceLockTimeIsSeconds | 10, true, false},
+		{"relative with undefined bits", RelativeTimeLockScript(1<<31|10, pubKeyHash), 0, false, true},
+		{"negative", append(NewScriptBuilder().AddInt(-1).AddOp(OpCheckLockTimeVerify).AddOp(OpDrop).Script(), PayToPubKeyHashScript(pubKeyHash)...), 0, false, true},
+		{"pay to pubkey hash", PayToPubKeyHashScript(pubKeyHash), 0, false, true},
+		{"lock pushed with a longer push opcode", lockScript(Script{OpPushData1, 3, 0xa0, 0x86, 0x01}), 0, false, true},
+		{"small lock pushed as data", lockScript(Script{1, 5}), 0, false, true},
+		{"OP_PUSHDATA4 lock", lockScript(Script{0x4e, 1, 0, 0, 0, 5}), 0, false, true},
+		{"OP_1NEGATE lock", lockScript(Script{0x4f}), 0, false, true},
+		{"OP_RESERVED lock", lockScript(Script{0x50}), 0, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lock, relative, hash, err := ParseTimeLockScript(tt.script)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTimeLockScript error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if lock != tt.wantLock || relative != tt.wantRelative {
+				t.Errorf("ParseTimeLockScript = %d, %v, want %d, %v", lock, relative, tt.wantLock, tt.wantRelative)
+			}
+			if !bytes.Equal(hash, pubKeyHash) {
+				t.Errorf("ParseTimeLockScript key hash = %x, want %x", hash, pubKeyHash)
+			}
+		})
+	}
+}
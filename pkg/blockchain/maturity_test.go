@@ -0,0 +1,126 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsMature(t *testing.T) {
+	tests := []struct {
+		name        string
+		isCoinbase  bool
+		height      int64
+		spendHeight int64
+		want        bool
+	}{
+		{"coinbase before maturity", true, 10, 109, false},
+		{"coinbase at maturity", true, 10, 110, true},
+		{"coinbase after maturity", true, 10, 111, true},
+		{"coinbase in the next block", true, 10, 11, false},
+		{"regular output in the next block", false, 10, 11, true},
+		{"regular output in the same block", false, 10, 10, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := &UTXO{Height: tt.height, IsCoinbase: tt.isCoinbase}
+			if got := entry.IsMature(tt.spendHeight, 100); got != tt.want {
+				t.Errorf("IsMature(%d, 100) = %v, want %v", tt.spendHeight, got, tt.want)
+			}
+		})
+	}
+}
+
+// newMaturityChain returns a chain whose coinbase outputs need three blocks
+// built on them, with blocks 1 to 3 paying miner.
+func newMaturityChain(t *testing.T, miner *testKey) *Blockchain {
+	t.Helper()
+
+	params := RegTestParams
+	params.CoinbaseMaturity = 3
+	bc := newChainWithParams(t, &params)
+
+	for i := 0; i < 3; i++ {
+		if _, err := bc.MineBlock(miner.address, nil); err != nil {
+			t.Fatalf("MineBlock: %v", err)
+		}
+	}
+	return bc
+}
+
+func TestValidateTransactionsRejectsImmatureSpend(t *testing.T) {
+	alice := newTestKey(t)
+	bc := newMaturityChain(t, alice)
+
+	block1, err := bc.GetBlock(1)
+	if err != nil {
+		t.Fatalf("GetBlock: %v", err)
+	}
+	coin := output(&block1.Transactions[0], 0)
+
+	tx := NewTransaction(
+		[]TxInput{{TxID: coin.OutPoint.TxID, OutputIndex: coin.OutPoint.Index}},
+		[]TxOutput{{Value: coin.Value, Address: alice.address}},
+	)
+	alice.signInput(t, tx, 0, coin)
+	tx.SetID()
+
+	tests := []struct {
+		height  int64
+		wantErr bool
+	}{
+		{2, true},
+		{3, true},
+		{4, false},
+		{5, false},
+	}
+
+	for _, tt := range tests {
+		block := &Block{
+			Header:       BlockHeader{Height: tt.height},
+			Transactions: []Transaction{*NewCoinbaseTransaction(alice.address, 1, tt.height), *tx},
+		}
+
+		err := bc.validateTransactions(block, true)
+		if !tt.wantErr {
+			if err != nil {
+				t.Errorf("spend at height %d = %v, want nil", tt.height, err)
+			}
+			continue
+		}
+
+		var ruleErr RuleError
+		if !errors.As(err, &ruleErr) || ruleErr.Code != ErrImmatureSpend {
+			t.Errorf("spend at height %d = %v, want %s", tt.height, err, ErrImmatureSpend)
+		}
+	}
+}
+
+func TestSpendableBalance(t *testing.T) {
+	alice := newTestKey(t)
+	bc := newMaturityChain(t, alice)
+	subsidy := CalcBlockSubsidy(1, bc.params)
+
+	// A transaction in block 4 may spend block 1's coinbase only
+	want := AddressBalance{
+		Total:     3 * subsidy,
+		Spendable: subsidy,
+		Mature:    subsidy,
+		Immature:  2 * subsidy,
+	}
+	if got := bc.GetBalanceDetails(alice.address); got != want {
+		t.Errorf("GetBalanceDetails = %+v, want %+v", got, want)
+	}
+
+	spendable := bc.FindSpendableUTXO(alice.address)
+	if len(spendable) != 1 || spendable[0].Height != 1 {
+		t.Errorf("FindSpendableUTXO = %+v, want block 1's coinbase", spendable)
+	}
+
+	if _, err := bc.CreateTransaction(alice.address, "bob", subsidy+1, 0, 0, nil); err == nil {
+		t.Error("CreateTransaction spent immature coinbase outputs")
+	}
+	if _, err := bc.CreateTransaction(alice.address, "bob", subsidy, 0, 0, nil); err != nil {
+		t.Errorf("CreateTransaction of the spendable balance: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package blockchain
+
+import (
+	"blockchain-node/pkg/crypto"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// nonceOffset is where the nonce sits in a serialized block header.
+const nonceOffset = 80
+
+// hashBatch is how many hashes a worker tries between checks for
+// cancellation and updates of the shared hash count.
+const hashBatch = 1 << 12
+
+// Miner searches for block proof of work on several goroutines. It holds no
+// chain state, so one Miner may solve blocks for several callers at once.
+type Miner struct {
+	workers int
+
+	mutex     sync.Mutex
+	lastStats MiningStats
+}
+
+// MiningStats describes a proof of work search.
+type MiningStats struct {
+	Hashes   uint64        `json:"hashes"`
+	Duration time.Duration `json:"duration"`
+	HashRate float64       `json:"hash_rate"` // Hashes per second
+}
+
+// NewMiner creates a miner with the given number of worker goroutines, or
+// one per CPU if workers is not positive.
+func NewMiner(workers int) *Miner {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &Miner{workers: workers}
+}
+
+// Workers returns the number of goroutines a search runs on.
+func (m *Miner) Workers() int {
+	return m.workers
+}
+
+// Stats returns the statistics of the most recently finished search.
+func (m *Miner) Stats() MiningStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.lastStats
+}
+
+// Solve searches for a header whose hash meets the target in the block's
+// Difficulty field and sets the block's Nonce and Hash to it. The nonce
+// space is split evenly between the workers; if all of it is exhausted the
+// timestamp is rolled forward and the search starts over. If ctx is done
+// first, Solve returns its error and leaves the block unchanged.
+func (m *Miner) Solve(ctx context.Context, block *Block) error {
+	target := CompactToBig(block.Header.Difficulty)
+	if target.Sign() <= 0 || target.BitLen() > 256 {
+		return fmt.Errorf("invalid target difficulty %08x", block.Header.Difficulty)
+	}
+
+	var targetBytes [32]byte
+	target.FillBytes(targetBytes[:])
+
+	var hashes atomic.Uint64
+	start := time.Now()
+	defer func() {
+		m.recordStats(hashes.Load(), time.Since(start))
+	}()
+
+	header := block.Header
+	for {
+		headerBytes, err := header.Serialize()
+		if err != nil {
+			return err
+		}
+
+		nonce, found, err := m.searchNonces(ctx, headerBytes, targetBytes[:], &hashes)
+		if err != nil {
+			return err
+		}
+
+		if found {
+			header.Nonce = nonce
+			binary.LittleEndian.PutUint64(headerBytes[nonceOffset:], nonce)
+			header.Hash = hashHeader(headerBytes)
+			block.Header = header
+			return nil
+		}
+
+		// No nonce works with this header; a new timestamp gives a fresh
+		// set of hashes to search
+		header.Timestamp++
+	}
+}
+
+// searchNonces tries every nonce with the other header fields fixed,
+// giving each worker a contiguous share of the nonce space.
+func (m *Miner) searchNonces(ctx context.Context, headerBytes, target []byte, hashes *atomic.Uint64) (uint64, bool, error) {
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	found := make(chan uint64, m.workers)
+	share := math.MaxUint64 / uint64(m.workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < m.workers; i++ {
+		first := uint64(i) * share
+		last := first + share - 1
+		if i == m.workers-1 {
+			last = math.MaxUint64
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			buf := append([]byte(nil), headerBytes...)
+			var batch uint64
+			for nonce := first; ; nonce++ {
+				binary.LittleEndian.PutUint64(buf[nonceOffset:], nonce)
+				hash := crypto.DoubleHashSHA256(buf)
+				batch++
+
+				if bytes.Compare(hash, target) <= 0 {
+					found <- nonce
+					cancel()
+					break
+				}
+
+				if nonce == last {
+					break
+				}
+
+				if batch == hashBatch {
+					hashes.Add(batch)
+					batch = 0
+					if searchCtx.Err() != nil {
+						break
+					}
+				}
+			}
+			hashes.Add(batch)
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case nonce := <-found:
+		return nonce, true, nil
+	default:
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, false, err
+	}
+	return 0, false, nil
+}
+
+func (m *Miner) recordStats(hashes uint64, duration time.Duration) {
+	stats := MiningStats{Hashes: hashes, Duration: duration}
+	if seconds := duration.Seconds(); seconds > 0 {
+		stats.HashRate = float64(hashes) / seconds
+	}
+
+	m.mutex.Lock()
+	m.lastStats = stats
+	m.mutex.Unlock()
+}
@@ -0,0 +1,126 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// unsolvableBits is a target no search finds a hash under in a test's
+// lifetime.
+const unsolvableBits = 0x03000001
+
+func TestSolveFindsValidNonce(t *testing.T) {
+	genesis := NewGenesisBlock(&RegTestParams)
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			block := childBlock(genesis, "miner", 50)
+			block.Header.Difficulty = DefaultDifficultyBits
+
+			miner := NewMiner(workers)
+			if miner.Workers() != workers {
+				t.Fatalf("Workers = %d, want %d", miner.Workers(), workers)
+			}
+			if err := miner.Solve(context.Background(), block); err != nil {
+				t.Fatalf("Solve with %d workers: %v", workers, err)
+			}
+
+			if got := block.calculateHash(); got != block.Header.Hash {
+				t.Errorf("hash %s does not match header %s", block.Header.Hash, got)
+			}
+			if err := checkProofOfWork(block.Header.Hash, block.Header.Difficulty); err != nil {
+				t.Errorf("checkProofOfWork = %v, want nil", err)
+			}
+			if err := block.Validate(genesis); err != nil {
+				t.Errorf("Validate = %v, want nil", err)
+			}
+
+			stats := miner.Stats()
+			if stats.Hashes == 0 || stats.Duration <= 0 {
+				t.Errorf("Stats = %+v, want hashes and a duration", stats)
+			}
+			if want := float64(stats.Hashes) / stats.Duration.Seconds(); stats.HashRate != want {
+				t.Errorf("HashRate = %f, want %f", stats.HashRate, want)
+			}
+		})
+	}
+}
+
+func TestSolveIsDeterministicOnOneWorker(t *testing.T) {
+	genesis := NewGenesisBlock(&RegTestParams)
+	block := childBlock(genesis, "miner", 50)
+	block.Header.Difficulty = DefaultDifficultyBits
+	again := *block
+
+	if err := NewMiner(1).Solve(context.Background(), block); err != nil {
+		t.Fatalf("Solve: %v", err)
+	}
+	if err := NewMiner(1).Solve(context.Background(), &again); err != nil {
+		t.Fatalf("Solve: %v", err)
+	}
+	if block.Header.Nonce != again.Header.Nonce || block.Header.Hash != again.Header.Hash {
+		t.Errorf("second search found nonce %d, want %d", again.Header.Nonce, block.Header.Nonce)
+	}
+}
+
+func TestSolveCancelled(t *testing.T) {
+	genesis := NewGenesisBlock(&RegTestParams)
+
+	tests := []struct {
+		name  string
+		delay time.Duration // Before the search is cancelled
+	}{
+		{"before the search", 0},
+		{"during the search", 50 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := childBlock(genesis, "miner", 50)
+			block.Header.Difficulty = unsolvableBits
+			header := block.Header
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.delay == 0 {
+				cancel()
+			} else {
+				time.AfterFunc(tt.delay, cancel)
+			}
+			defer cancel()
+
+			miner := NewMiner(4)
+			done := make(chan error, 1)
+			go func() {
+				done <- miner.Solve(ctx, block)
+			}()
+
+			select {
+			case err := <-done:
+				if !errors.Is(err, context.Canceled) {
+					t.Fatalf("Solve = %v, want %v", err, context.Canceled)
+				}
+			case <-time.After(tt.delay + 2*time.Second):
+				t.Fatal("Solve did not return after its context was cancelled")
+			}
+
+			if block.Header != header {
+				t.Errorf("cancelled search changed the header to %+v", block.Header)
+			}
+			if tt.delay > 0 && miner.Stats().Hashes == 0 {
+				t.Error("Stats counted no hashes for a cancelled search")
+			}
+		})
+	}
+}
+
+func TestSolveRejectsInvalidTarget(t *testing.T) {
+	for _, bits := range []uint32{0, 0x01800000, 0x23000001} {
+		block := &Block{Header: BlockHeader{Difficulty: bits}}
+		if err := NewMiner(1).Solve(context.Background(), block); err == nil {
+			t.Errorf("Solve accepted difficulty %08x", bits)
+		}
+	}
+}
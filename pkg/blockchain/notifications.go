@@ -0,0 +1,71 @@
+package blockchain
+
+// NotificationType identifies the change to the active chain a Notification
+// reports.
+type NotificationType int
+
+const (
+	// NTBlockConnected reports a block connected to the tip of the active
+	// chain.
+	NTBlockConnected NotificationType = iota
+
+	// NTBlockDisconnected reports the tip disconnected from the active chain
+	// during a reorganization.
+	NTBlockDisconnected
+)
+
+var notificationTypeStrings = map[NotificationType]string{
+	NTBlockConnected:    "block-connected",
+	NTBlockDisconnected: "block-disconnected",
+}
+
+func (t NotificationType) String() string {
+	return notificationTypeStrings[t]
+}
+
+// Notification reports a block connected to or disconnected from the active
+// chain.
+type Notification struct {
+	Type  NotificationType
+	Block *Block
+}
+
+// Subscribe registers callback to be told of every block connected to or
+// disconnected from the active chain, in order. Callbacks run after the
+// chain lock is released, on the goroutine that changed the chain, so they
+// may read the chain but must not submit blocks themselves.
+func (bc *Blockchain) Subscribe(callback func(Notification)) {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	bc.subscribers = append(bc.subscribers, callback)
+}
+
+// queueNotification records a change to the active chain for delivery once
+// the chain lock is released. Must be called with the chain lock held.
+func (bc *Blockchain) queueNotification(notificationType NotificationType, block *Block) {
+	if len(bc.subscribers) == 0 {
+		return
+	}
+	bc.notifications = append(bc.notifications, Notification{Type: notificationType, Block: block})
+}
+
+// deliverNotifications hands queued notifications to the subscribers. It is
+// called without the chain lock by every method that can change the active
+// chain; notifyMutex keeps deliveries by concurrent callers in order.
+func (bc *Blockchain) deliverNotifications() {
+	bc.notifyMutex.Lock()
+	defer bc.notifyMutex.Unlock()
+
+	bc.mutex.Lock()
+	notifications := bc.notifications
+	subscribers := bc.subscribers
+	bc.notifications = nil
+	bc.mutex.Unlock()
+
+	for _, notification := range notifications {
+		for _, callback := range subscribers {
+			callback(notification)
+		}
+	}
+}
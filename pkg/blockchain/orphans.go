@@ -0,0 +1,221 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Limits on the orphan pool, which holds blocks that arrived before their
+// parents. Orphans cannot be fully validated, so the pool is kept small and
+// no single source can fill it.
+const (
+	MaxOrphanBlocks     = 100
+	MaxOrphanBytes      = 20 * MaxBlockSize
+	MaxOrphansPerSource = 10
+	OrphanExpiry        = time.Hour
+)
+
+type orphanBlock struct {
+	block      *Block
+	source     string
+	size       int
+	expiration time.Time
+}
+
+// orphanPool indexes orphans by hash and by the parent they are waiting
+// for. It is guarded by the chain lock.
+type orphanPool struct {
+	orphans   map[string]*orphanBlock
+	byParent  map[string][]*orphanBlock
+	bySource  map[string]int
+	totalSize int
+}
+
+func newOrphanPool() *orphanPool {
+	return &orphanPool{
+		orphans:  make(map[string]*orphanBlock),
+		byParent: make(map[string][]*orphanBlock),
+		bySource: make(map[string]int),
+	}
+}
+
+func (p *orphanPool) add(orphan *orphanBlock) {
+	hash := orphan.block.Header.Hash
+	parent := orphan.block.Header.PreviousHash
+
+	p.orphans[hash] = orphan
+	p.byParent[parent] = append(p.byParent[parent], orphan)
+	p.bySource[orphan.source]++
+	p.totalSize += orphan.size
+}
+
+func (p *orphanPool) remove(orphan *orphanBlock) {
+	hash := orphan.block.Header.Hash
+	parent := orphan.block.Header.PreviousHash
+
+	delete(p.orphans, hash)
+
+	siblings := p.byParent[parent]
+	for i, sibling := range siblings {
+		if sibling == orphan {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(p.byParent, parent)
+	} else {
+		p.byParent[parent] = siblings
+	}
+
+	if p.bySource[orphan.source]--; p.bySource[orphan.source] == 0 {
+		delete(p.bySource, orphan.source)
+	}
+	p.totalSize -= orphan.size
+}
+
+// oldest returns the orphan closest to expiry, optionally only among those
+// from source.
+func (p *orphanPool) oldest(source string, anySource bool) *orphanBlock {
+	var oldest *orphanBlock
+	for _, orphan := range p.orphans {
+		if !anySource && orphan.source != source {
+			continue
+		}
+		if oldest == nil || orphan.expiration.Before(oldest.expiration) {
+			oldest = orphan
+		}
+	}
+	return oldest
+}
+
+func (p *orphanPool) expire(now time.Time) {
+	for _, orphan := range p.orphans {
+		if now.After(orphan.expiration) {
+			p.remove(orphan)
+		}
+	}
+}
+
+// ProcessBlock validates and connects a block like SubmitBlock, but a block
+// whose parent is unknown is held in the orphan pool instead of rejected
+// and reported with isOrphan. source identifies where the block came from,
+// such as a peer address, and limits how much of the pool it may use.
+// Orphans are connected as soon as their parent is accepted.
+func (bc *Blockchain) ProcessBlock(block *Block, source string) (isOrphan bool, err error) {
+	if block == nil {
+		return false, errors.New("block cannot be nil")
+	}
+
+	defer bc.deliverNotifications()
+
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	if _, exists := bc.orphans.orphans[block.Header.Hash]; exists {
+		return true, nil
+	}
+
+	err = bc.processBlock(block)
+	var ruleErr RuleError
+	if errors.As(err, &ruleErr) && ruleErr.Code == ErrOrphanBlock {
+		if err := bc.addOrphan(block, source); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	bc.processOrphans(block.Header.Hash)
+	return false, nil
+}
+
+// addOrphan stores a block whose parent is unknown after the checks that
+// need no parent, including that it claims at least the work the chain could
+// require at its height, so orphans cost real proof of work. It makes room
+// by evicting the source's own oldest orphan once it reaches its share, then
+// the oldest orphans overall.
+func (bc *Blockchain) addOrphan(block *Block, source string) error {
+	if err := block.Validate(nil); err != nil {
+		return fmt.Errorf("block validation failed: %w", err)
+	}
+
+	if checkpoint, exists := bc.checkpointAt(block.Header.Height); exists && checkpoint.Hash != block.Header.Hash {
+		return ruleError(ErrCheckpointMismatch, "block %s at height %d does not match checkpoint %s", block.Header.Hash, block.Header.Height, checkpoint.Hash)
+	}
+
+	if easiest := bc.calcEasiestDifficulty(block.Header.Height); CompactToBig(block.Header.Difficulty).Cmp(CompactToBig(easiest)) > 0 {
+		return ruleError(ErrBadDifficulty, "orphan difficulty %08x is easier than the easiest possible difficulty %08x at height %d", block.Header.Difficulty, easiest, block.Header.Height)
+	}
+
+	now := bc.clock.Now()
+	if maxTime := now.Add(bc.params.MaxFutureBlockTime).Unix(); block.Header.Timestamp > maxTime {
+		return ruleError(ErrTimeTooNew, "block timestamp %d is too far in the future, limit is %d", block.Header.Timestamp, maxTime)
+	}
+
+	bc.orphans.expire(now)
+
+	if bc.orphans.bySource[source] >= MaxOrphansPerSource {
+		bc.orphans.remove(bc.orphans.oldest(source, false))
+	}
+
+	orphan := &orphanBlock{
+		block:      block,
+		source:     source,
+		size:       block.GetSize(),
+		expiration: now.Add(OrphanExpiry),
+	}
+
+	for len(bc.orphans.orphans) >= MaxOrphanBlocks || (len(bc.orphans.orphans) > 0 && bc.orphans.totalSize+orphan.size > MaxOrphanBytes) {
+		bc.orphans.remove(bc.orphans.oldest("", true))
+	}
+
+	bc.orphans.add(orphan)
+	return nil
+}
+
+// processOrphans connects the orphans waiting on an accepted block, then
+// those waiting on each of them in turn. An orphan that fails validation is
+// dropped along with the chance of its descendants connecting.
+func (bc *Blockchain) processOrphans(hash string) {
+	queue := []string{hash}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+
+		for _, orphan := range append([]*orphanBlock(nil), bc.orphans.byParent[parent]...) {
+			bc.orphans.remove(orphan)
+
+			if err := bc.processBlock(orphan.block); err == nil {
+				queue = append(queue, orphan.block.Header.Hash)
+			}
+		}
+	}
+}
+
+// OrphanRoot returns the hash of the earliest block missing below an
+// orphan: the block to request so the orphan and its ancestors in the pool
+// can connect. It returns the hash unchanged if it is not an orphan.
+func (bc *Blockchain) OrphanRoot(hash string) string {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	for {
+		orphan, exists := bc.orphans.orphans[hash]
+		if !exists {
+			return hash
+		}
+		hash = orphan.block.Header.PreviousHash
+	}
+}
+
+// OrphanCount returns the number of blocks in the orphan pool.
+func (bc *Blockchain) OrphanCount() int {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	return len(bc.orphans.orphans)
+}
@@ -0,0 +1,260 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newOrphan returns a block on an unknown parent, distinct for each i,
+// holding transactions after its coinbase.
+func newOrphan(i int, transactions ...Transaction) *Block {
+	parent := &Block{Header: BlockHeader{
+		Hash:       fmt.Sprintf("%064x", i+1),
+		Height:     10,
+		Timestamp:  testStart.Unix(),
+		Difficulty: PowLimitBits,
+	}}
+	return childBlock(parent, "miner", 50, transactions...)
+}
+
+func TestProcessBlockConnectsOrphans(t *testing.T) {
+	bc, _ := newTestChain(t)
+	miner := newTestKey(t)
+
+	// Blocks 2 to 4 arrive before block 1, and a second child of block 2
+	// arrives too
+	block1 := childBlock(bc.GetLatestBlock(), miner.address, 50)
+	block2 := childBlock(block1, miner.address, 50)
+	block3 := childBlock(block2, miner.address, 50)
+	block4 := childBlock(block3, miner.address, 50)
+	sibling := childBlock(block2, miner.address, 49)
+
+	for _, block := range []*Block{block4, block3, sibling, block2, block2} {
+		isOrphan, err := bc.ProcessBlock(block, "peer")
+		if err != nil || !isOrphan {
+			t.Fatalf("ProcessBlock(%d) = %v, %v, want an orphan", block.Header.Height, isOrphan, err)
+		}
+	}
+	if got := bc.OrphanCount(); got != 4 {
+		t.Fatalf("OrphanCount = %d, want 4", got)
+	}
+	if got := bc.OrphanRoot(block4.Header.Hash); got != block1.Header.Hash {
+		t.Errorf("OrphanRoot = %s, want block 1 %s", got, block1.Header.Hash)
+	}
+
+	isOrphan, err := bc.ProcessBlock(block1, "peer")
+	if err != nil || isOrphan {
+		t.Fatalf("ProcessBlock(1) = %v, %v, want it connected", isOrphan, err)
+	}
+
+	if got := bc.OrphanCount(); got != 0 {
+		t.Errorf("OrphanCount after the parent arrived = %d, want 0", got)
+	}
+	if tip := bc.GetLatestBlock(); tip.Header.Hash != block4.Header.Hash {
+		t.Errorf("tip is %d %s, want block 4 %s", tip.Header.Height, tip.Header.Hash, block4.Header.Hash)
+	}
+	if _, err := bc.GetBlockByHash(sibling.Header.Hash); err != nil {
+		t.Errorf("side branch orphan was not connected: %v", err)
+	}
+}
+
+func TestSubmitBlockDoesNotHoldOrphans(t *testing.T) {
+	bc, _ := newTestChain(t)
+
+	if err := bc.SubmitBlock(newOrphan(0)); err == nil {
+		t.Fatal("SubmitBlock accepted a block on an unknown parent")
+	}
+	if got := bc.OrphanCount(); got != 0 {
+		t.Errorf("OrphanCount = %d, want 0", got)
+	}
+}
+
+func TestOrphanPoolLimits(t *testing.T) {
+	// Each big orphan holds two transactions just under the transaction size
+	// limit, so the byte limit is reached well before the count limit
+	big := strings.Repeat("b", MaxTransactionSize-1000)
+	bigOrphan := func(i int) *Block {
+		var transactions []Transaction
+		for j := 0; j < 2; j++ {
+			transactions = append(transactions, *NewTransaction([]TxInput{{TxID: zeroHash, OutputIndex: j}}, []TxOutput{{Value: 1, Address: big}}))
+		}
+		return newOrphan(i, transactions...)
+	}
+	bigSize := bigOrphan(0).GetSize()
+
+	tests := []struct {
+		name      string
+		orphans   int
+		block     func(i int) *Block
+		source    func(i int) string
+		wantCount int
+	}{
+		{
+			name:      "count",
+			orphans:   MaxOrphanBlocks + 5,
+			block:     func(i int) *Block { return newOrphan(i) },
+			source:    func(i int) string { return fmt.Sprintf("peer%d", i) },
+			wantCount: MaxOrphanBlocks,
+		},
+		{
+			name:      "per source",
+			orphans:   MaxOrphansPerSource + 5,
+			block:     func(i int) *Block { return newOrphan(i) },
+			source:    func(i int) string { return "peer" },
+			wantCount: MaxOrphansPerSource,
+		},
+		{
+			name:      "bytes",
+			orphans:   MaxOrphanBytes/bigSize + 3,
+			block:     bigOrphan,
+			source:    func(i int) string { return fmt.Sprintf("peer%d", i) },
+			wantCount: MaxOrphanBytes / bigSize,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc, clock := newTestChain(t)
+
+			var blocks []*Block
+			for i := 0; i < tt.orphans; i++ {
+				// Each orphan arrives a second after the last, so the oldest
+				// are evicted first
+				clock.now = testStart.Add(time.Duration(i) * time.Second)
+				block := tt.block(i)
+				if isOrphan, err := bc.ProcessBlock(block, tt.source(i)); err != nil || !isOrphan {
+					t.Fatalf("ProcessBlock(%d) = %v, %v, want an orphan", i, isOrphan, err)
+				}
+				blocks = append(blocks, block)
+			}
+
+			if got := bc.OrphanCount(); got != tt.wantCount {
+				t.Errorf("OrphanCount = %d, want %d", got, tt.wantCount)
+			}
+			if bc.orphans.totalSize > MaxOrphanBytes {
+				t.Errorf("orphans take %d bytes, limit is %d", bc.orphans.totalSize, MaxOrphanBytes)
+			}
+
+			evicted := tt.orphans - tt.wantCount
+			for i, block := range blocks {
+				_, held := bc.orphans.orphans[block.Header.Hash]
+				if held != (i >= evicted) {
+					t.Errorf("orphan %d held = %v, want %v", i, held, i >= evicted)
+				}
+			}
+		})
+	}
+}
+
+func TestOrphanPoolPerSourceLimitSparesOtherSources(t *testing.T) {
+	bc, clock := newTestChain(t)
+
+	if _, err := bc.ProcessBlock(newOrphan(0), "honest"); err != nil {
+		t.Fatalf("ProcessBlock: %v", err)
+	}
+	for i := 1; i <= 2*MaxOrphansPerSource; i++ {
+		clock.now = testStart.Add(time.Duration(i) * time.Second)
+		if _, err := bc.ProcessBlock(newOrphan(i), "flooder"); err != nil {
+			t.Fatalf("ProcessBlock: %v", err)
+		}
+	}
+
+	if got := bc.orphans.bySource["honest"]; got != 1 {
+		t.Errorf("honest source holds %d orphans, want 1", got)
+	}
+	if got := bc.orphans.bySource["flooder"]; got != MaxOrphansPerSource {
+		t.Errorf("flooding source holds %d orphans, want %d", got, MaxOrphansPerSource)
+	}
+}
+
+func TestOrphanPoolExpiry(t *testing.T) {
+	bc, clock := newTestChain(t)
+
+	old := newOrphan(0)
+	if _, err := bc.ProcessBlock(old, "peer"); err != nil {
+		t.Fatalf("ProcessBlock: %v", err)
+	}
+
+	// Expiry is checked as orphans are added
+	clock.now = testStart.Add(OrphanExpiry)
+	if _, err := bc.ProcessBlock(newOrphan(1), "peer"); err != nil {
+		t.Fatalf("ProcessBlock: %v", err)
+	}
+	if _, held := bc.orphans.orphans[old.Header.Hash]; !held {
+		t.Fatal("orphan expired at its expiry time")
+	}
+
+	clock.now = testStart.Add(OrphanExpiry + time.Second)
+	if _, err := bc.ProcessBlock(newOrphan(2), "peer"); err != nil {
+		t.Fatalf("ProcessBlock: %v", err)
+	}
+	if _, held := bc.orphans.orphans[old.Header.Hash]; held {
+		t.Error("orphan held past its expiry")
+	}
+	if got := bc.OrphanCount(); got != 2 {
+		t.Errorf("OrphanCount = %d, want 2", got)
+	}
+	if got := bc.orphans.bySource["peer"]; got != 2 {
+		t.Errorf("source holds %d orphans, want 2", got)
+	}
+}
+
+func TestOrphanPoolRejectsEasyDifficulty(t *testing.T) {
+	// A retargeting chain whose difficulty can still ease at each boundary
+	params := RegTestParams
+	params.GenesisBits = BigToCompact(new(big.Int).Rsh(powLimit, 8))
+	params.RetargetWindow = 10
+	params.MaxRetargetFactor = 4
+	params.TargetSpacing = 10 * time.Minute
+	params.Checkpoints = nil
+	bits := params.GenesisBits
+
+	tests := []struct {
+		name    string
+		height  int64
+		bits    uint32
+		wantErr bool
+	}{
+		{"tip's next difficulty", 5, bits, false},
+		{"easier than the next difficulty", 5, scaleBits(bits, 2, 1), true},
+		{"eased at one retarget", 15, scaleBits(bits, 4, 1), false},
+		{"easier than one retarget allows", 15, scaleBits(bits, 5, 1), true},
+		{"eased at two retargets", 25, scaleBits(bits, 16, 1), false},
+		{"easier than two retargets allow", 25, scaleBits(bits, 17, 1), true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newChainWithParams(t, &params)
+			bc.SetClock(&fixedClock{now: testStart})
+
+			parent := &Block{Header: BlockHeader{
+				Hash:       fmt.Sprintf("%064x", i+1),
+				Height:     tt.height - 1,
+				Timestamp:  testStart.Unix(),
+				Difficulty: tt.bits,
+			}}
+			block := childBlock(parent, "miner", 50)
+
+			isOrphan, err := bc.ProcessBlock(block, "peer")
+			if !tt.wantErr {
+				if err != nil || !isOrphan {
+					t.Errorf("ProcessBlock = %v, %v, want an orphan", isOrphan, err)
+				}
+				return
+			}
+
+			var ruleErr RuleError
+			if !errors.As(err, &ruleErr) || ruleErr.Code != ErrBadDifficulty {
+				t.Errorf("ProcessBlock = %v, want %s", err, ErrBadDifficulty)
+			}
+			if got := bc.OrphanCount(); got != 0 {
+				t.Errorf("OrphanCount = %d, want 0", got)
+			}
+		})
+	}
+}
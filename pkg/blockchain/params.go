@@ -0,0 +1,218 @@
+package blockchain
+
+import (
+	"blockchain-node/pkg/crypto"
+	"fmt"
+	"time"
+)
+
+// Checkpoint pins the hash of the active chain's block at a height.
+type Checkpoint struct {
+	Height int64
+	Hash   string
+}
+
+// ChainParams holds the consensus rules a node validates blocks against,
+// along with the constants that identify its network.
+type ChainParams struct {
+	// Name identifies the network, e.g. "mainnet"
+	Name string
+
+	// Magic prefixes messages between nodes so peers on different networks
+	// reject each other
+	Magic [4]byte
+
+	// AddressVersion is the version byte of addresses on this network
+	AddressVersion byte
+
+	// ScriptAddressVersion is the version byte of pay-to-script-hash
+	// addresses on this network
+	ScriptAddressVersion byte
+
+	// GenesisTimestamp is the fixed timestamp of the genesis block and its
+	// coinbase, so every node derives the same genesis hash
+	GenesisTimestamp int64
+
+	// GenesisBits is the compact target of the genesis block, and so the
+	// difficulty of the chain until the first retarget
+	GenesisBits uint32
+
+	// TargetSpacing is the desired average time between blocks
+	TargetSpacing time.Duration
+
+	// RetargetWindow is the number of blocks between difficulty adjustments
+	// and the span of blocks whose timestamps are measured to make them.
+	// Zero disables retargeting
+	RetargetWindow int64
+
+	// MaxRetargetFactor bounds how far one adjustment can move the target
+	// in either direction
+	MaxRetargetFactor int64
+
+	// InitialSubsidy is the block reward, in satoshis, before any halving
+	InitialSubsidy int64
+
+	// SubsidyHalvingInterval is the number of blocks between reward halvings
+	SubsidyHalvingInterval int64
+
+	// CoinbaseMaturity is the number of blocks that must be built on top of
+	// a coinbase before its output can be spent
+	CoinbaseMaturity int64
+
+	// MedianTimeBlocks is the number of previous blocks whose median
+	// timestamp a new block's timestamp must exceed
+	MedianTimeBlocks int
+
+	// MaxFutureBlockTime is how far ahead of node-adjusted time a block's
+	// timestamp may be
+	MaxFutureBlockTime time.Duration
+
+	// Checkpoints are known blocks of the network's chain, in ascending
+	// height order. A block at a checkpoint height must have its hash, and
+	// no block may fork from the active chain below the latest checkpoint
+	// it has passed
+	Checkpoints []Checkpoint
+
+	// AssumeValid is the hash of a block whose signatures, and those of its
+	// ancestors, are trusted rather than verified when blocks are imported
+	// at startup. Empty verifies every signature
+	AssumeValid string
+}
+
+// MainNetParams are the parameters of the main network.
+var MainNetParams = ChainParams{
+	Name:                 "mainnet",
+	Magic:                [4]byte{0xb1, 0x0c, 0x4e, 0xd1},
+	AddressVersion:       0x00,
+	ScriptAddressVersion: crypto.ScriptAddressVersionMainNet,
+	GenesisTimestamp:     1735689600, // 2025-01-01 00:00:00 UTC
+	GenesisBits:          DefaultDifficultyBits,
+
+	TargetSpacing:     30 * time.Second,
+	RetargetWindow:    10,
+	MaxRetargetFactor: 4,
+
+	InitialSubsidy:         50 * 100000000,
+	SubsidyHalvingInterval: 210000,
+	CoinbaseMaturity:       100,
+
+	MedianTimeBlocks:   11,
+	MaxFutureBlockTime: 2 * time.Hour,
+
+	// Releases move the checkpoints and the assume-valid block forward to
+	// blocks buried deep in the network's chain
+	Checkpoints: []Checkpoint{
+		{Height: 0, Hash: "00008c022b7e87a00332e78c5f42526c330f9c3efb52cbcf6639f5436815e0bc"},
+	},
+	AssumeValid: "00008c022b7e87a00332e78c5f42526c330f9c3efb52cbcf6639f5436815e0bc",
+}
+
+// TestNetParams are the parameters of the public test network. The rules
+// match mainnet, but addresses and the genesis block differ so coins
+// cannot be confused between the two.
+var TestNetParams = ChainParams{
+	Name:                 "testnet",
+	Magic:                [4]byte{0x7e, 0x57, 0x4e, 0x70},
+	AddressVersion:       0x6f,
+	ScriptAddressVersion: crypto.ScriptAddressVersionTestNet,
+	GenesisTimestamp:     1735776000, // 2025-01-02 00:00:00 UTC
+	GenesisBits:          DefaultDifficultyBits,
+
+	TargetSpacing:     30 * time.Second,
+	RetargetWindow:    10,
+	MaxRetargetFactor: 4,
+
+	InitialSubsidy:         50 * 100000000,
+	SubsidyHalvingInterval: 210000,
+	CoinbaseMaturity:       100,
+
+	MedianTimeBlocks:   11,
+	MaxFutureBlockTime: 2 * time.Hour,
+
+	// Releases move the checkpoints and the assume-valid block forward to
+	// blocks buried deep in the network's chain
+	Checkpoints: []Checkpoint{
+		{Height: 0, Hash: "0000f061a1a76e1939b4d0b23969c296f4f1974db15bb9485a6aa206f3c09dc4"},
+	},
+	AssumeValid: "0000f061a1a76e1939b4d0b23969c296f4f1974db15bb9485a6aa206f3c09dc4",
+}
+
+// RegTestParams are the parameters of a private regression test network:
+// minimum difficulty that never retargets, so blocks can be mined on demand,
+// and a short halving interval to exercise the subsidy schedule.
+var RegTestParams = ChainParams{
+	Name:                 "regtest",
+	Magic:                [4]byte{0x4e, 0x67, 0x7e, 0x57},
+	AddressVersion:       0x6f,
+	ScriptAddressVersion: crypto.ScriptAddressVersionTestNet,
+	GenesisTimestamp:     1735862400, // 2025-01-03 00:00:00 UTC
+	GenesisBits:          PowLimitBits,
+
+	TargetSpacing:     30 * time.Second,
+	RetargetWindow:    0,
+	MaxRetargetFactor: 4,
+
+	InitialSubsidy:         50 * 100000000,
+	SubsidyHalvingInterval: 150,
+	CoinbaseMaturity:       100,
+
+	MedianTimeBlocks:   11,
+	MaxFutureBlockTime: 2 * time.Hour,
+
+	Checkpoints: []Checkpoint{
+		{Height: 0, Hash: "0225735982c3bc735dda03435d369ef3b2eb7cb48a40428e56120f78fe309222"},
+	},
+}
+
+// Validate fails for parameters a chain cannot run with, such as ones the
+// difficulty retarget would divide by zero with.
+func (p *ChainParams) Validate() error {
+	if p.RetargetWindow < 0 {
+		return fmt.Errorf("retarget window must not be negative, got %d", p.RetargetWindow)
+	}
+	if p.RetargetWindow > 0 {
+		if p.TargetSpacing < time.Second {
+			return fmt.Errorf("target spacing must be at least one second when retargeting, got %v", p.TargetSpacing)
+		}
+		if p.MaxRetargetFactor < 1 {
+			return fmt.Errorf("max retarget factor must be at least 1 when retargeting, got %d", p.MaxRetargetFactor)
+		}
+	}
+
+	if target := CompactToBig(p.GenesisBits); target.Sign() <= 0 || target.Cmp(powLimit) > 0 {
+		return fmt.Errorf("genesis difficulty %08x must be a positive target no easier than the pow limit %08x", p.GenesisBits, PowLimitBits)
+	}
+	if p.MedianTimeBlocks < 1 {
+		return fmt.Errorf("median time blocks must be at least 1, got %d", p.MedianTimeBlocks)
+	}
+
+	if p.InitialSubsidy < 0 || p.InitialSubsidy > MaxMoney {
+		return fmt.Errorf("initial subsidy must be within 0..%d, got %d", MaxMoney, p.InitialSubsidy)
+	}
+	if p.CoinbaseMaturity < 0 {
+		return fmt.Errorf("coinbase maturity must not be negative, got %d", p.CoinbaseMaturity)
+	}
+	if p.MaxFutureBlockTime < 0 {
+		return fmt.Errorf("max future block time must not be negative, got %v", p.MaxFutureBlockTime)
+	}
+
+	return nil
+}
+
+// IsValidAddress reports whether address is a pay-to-pubkey-hash or
+// pay-to-script-hash address of this network.
+func (p *ChainParams) IsValidAddress(address string) bool {
+	return crypto.IsValidAddressForNetwork(address, p.AddressVersion) ||
+		crypto.IsValidAddressForNetwork(address, p.ScriptAddressVersion)
+}
+
+// ParamsForNetwork returns a copy of the named network's parameters, which
+// the caller may adjust before starting a chain.
+func ParamsForNetwork(name string) (*ChainParams, error) {
+	for _, params := range []ChainParams{MainNetParams, TestNetParams, RegTestParams} {
+		if params.Name == name {
+			return &params, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown network %q, expected mainnet, testnet or regtest", name)
+}
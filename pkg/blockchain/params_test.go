@@ -0,0 +1,99 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewGenesisBlockIsDeterministic(t *testing.T) {
+	hashes := make(map[string]string)
+	for _, params := range []ChainParams{MainNetParams, TestNetParams, RegTestParams} {
+		t.Run(params.Name, func(t *testing.T) {
+			genesis := NewGenesisBlock(&params)
+			if again := NewGenesisBlock(&params); again.Header.Hash != genesis.Header.Hash {
+				t.Fatalf("genesis hash %s on a second build, want %s", again.Header.Hash, genesis.Header.Hash)
+			}
+
+			if genesis.Header.Timestamp != params.GenesisTimestamp {
+				t.Errorf("timestamp = %d, want %d", genesis.Header.Timestamp, params.GenesisTimestamp)
+			}
+			if genesis.Header.Difficulty != params.GenesisBits {
+				t.Errorf("difficulty = %08x, want %08x", genesis.Header.Difficulty, params.GenesisBits)
+			}
+			if err := genesis.Validate(nil); err != nil {
+				t.Errorf("Validate = %v, want nil", err)
+			}
+
+			// Two chains on the same network agree on their genesis block
+			bc := newChainWithParams(t, &params)
+			if got := bc.GetLatestBlock().Header.Hash; got != genesis.Header.Hash {
+				t.Errorf("chain genesis = %s, want %s", got, genesis.Header.Hash)
+			}
+
+			if other, ok := hashes[genesis.Header.Hash]; ok {
+				t.Errorf("genesis hash shared with %s", other)
+			}
+			hashes[genesis.Header.Hash] = params.Name
+		})
+	}
+}
+
+func TestParamsForNetwork(t *testing.T) {
+	for _, name := range []string{"mainnet", "testnet", "regtest"} {
+		params, err := ParamsForNetwork(name)
+		if err != nil {
+			t.Fatalf("ParamsForNetwork(%q): %v", name, err)
+		}
+		if params.Name != name {
+			t.Errorf("ParamsForNetwork(%q) returned %s", name, params.Name)
+		}
+	}
+
+	// The result is a copy, so adjusting it leaves the profile alone
+	params, _ := ParamsForNetwork("regtest")
+	params.CoinbaseMaturity = 1
+	if RegTestParams.CoinbaseMaturity == 1 {
+		t.Error("adjusting the returned params changed RegTestParams")
+	}
+
+	if _, err := ParamsForNetwork("simnet"); err == nil {
+		t.Error("ParamsForNetwork accepted an unknown network")
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(p *ChainParams)
+		wantErr bool
+	}{
+		{"unchanged", func(p *ChainParams) {}, false},
+		{"no retargeting", func(p *ChainParams) { p.RetargetWindow, p.TargetSpacing, p.MaxRetargetFactor = 0, 0, 0 }, false},
+		{"negative retarget window", func(p *ChainParams) { p.RetargetWindow = -1 }, true},
+		{"target spacing under a second", func(p *ChainParams) { p.RetargetWindow, p.TargetSpacing = 10, time.Millisecond }, true},
+		{"max retarget factor of zero", func(p *ChainParams) { p.RetargetWindow, p.MaxRetargetFactor = 10, 0 }, true},
+		{"genesis difficulty easier than the pow limit", func(p *ChainParams) { p.GenesisBits = 0x2100ffff }, true},
+		{"zero genesis target", func(p *ChainParams) { p.GenesisBits = 0 }, true},
+		{"median time over no blocks", func(p *ChainParams) { p.MedianTimeBlocks = 0 }, true},
+		{"negative subsidy", func(p *ChainParams) { p.InitialSubsidy = -1 }, true},
+		{"subsidy over MaxMoney", func(p *ChainParams) { p.InitialSubsidy = MaxMoney + 1 }, true},
+		{"negative coinbase maturity", func(p *ChainParams) { p.CoinbaseMaturity = -1 }, true},
+		{"negative max future block time", func(p *ChainParams) { p.MaxFutureBlockTime = -time.Second }, true},
+	}
+
+	for _, base := range []ChainParams{MainNetParams, TestNetParams, RegTestParams} {
+		for _, tt := range tests {
+			t.Run(base.Name+" "+tt.name, func(t *testing.T) {
+				params := base
+				tt.change(&params)
+
+				if err := params.Validate(); (err != nil) != tt.wantErr {
+					t.Errorf("Validate = %v, want error %v", err, tt.wantErr)
+				}
+				if _, err := NewBlockchainWithParams(&params); (err != nil) != tt.wantErr {
+					t.Errorf("NewBlockchainWithParams = %v, want error %v", err, tt.wantErr)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package blockchain
+
+// Standardness policy. These limits are stricter than consensus and only
+// decide which transactions this node accepts for mining; blocks mined
+// elsewhere are judged by consensus rules alone, so the policy can change
+// without splitting the chain.
+const (
+	// MaxStandardTxSize is the largest transaction, in bytes of its binary
+	// encoding, the node will mine
+	MaxStandardTxSize = 100000
+
+	// MaxStandardTxOutputs is the most outputs a standard transaction may
+	// create
+	MaxStandardTxOutputs = 100
+
+	// DustThreshold is the smallest output value, in satoshis, worth
+	// creating. Smaller outputs would cost more in fees to spend than they
+	// are worth and only bloat the UTXO set
+	DustThreshold = 546
+)
+
+// CheckTransactionStandard returns a PolicyError if the node should not mine
+// tx even though it may be valid. It does not check consensus rules.
+func CheckTransactionStandard(tx *Transaction, params *ChainParams) error {
+	if tx.IsCoinbase() {
+		return policyError("coinbase", "coinbase transaction %s is only valid in a block", tx.ID)
+	}
+
+	if size := tx.GetSize(); size > MaxStandardTxSize {
+		return policyError("tx-size", "transaction %s is %d bytes, standard limit is %d", tx.ID, size, MaxStandardTxSize)
+	}
+
+	if len(tx.Outputs) > MaxStandardTxOutputs {
+		return policyError("too-many-outputs", "transaction %s has %d outputs, standard limit is %d", tx.ID, len(tx.Outputs), MaxStandardTxOutputs)
+	}
+
+	for i, output := range tx.Outputs {
+		if len(output.LockingScript) > 0 {
+			if ClassifyScript(output.LockingScript) == NonStandardScript {
+				return policyError("nonstandard-script", "transaction %s output %d has a nonstandard locking script", tx.ID, i)
+			}
+		} else if !params.IsValidAddress(output.Address) {
+			return policyError("bad-address", "transaction %s output %d pays %q, which is not a %s address", tx.ID, i, output.Address, params.Name)
+		}
+
+		if output.Value < DustThreshold {
+			return policyError("dust", "transaction %s output %d of %d is below the dust threshold of %d", tx.ID, i, output.Value, DustThreshold)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package blockchain
+
+import (
+	"blockchain-node/pkg/crypto"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckTransactionStandard(t *testing.T) {
+	params := RegTestParams
+	bob := newTestKey(t)
+	mainnet := crypto.GenerateAddressFromKeyPair(bob.keyPair, MainNetParams.AddressVersion)
+
+	// payment returns a transaction paying each of values to address
+	payment := func(address string, values ...int64) *Transaction {
+		var outputs []TxOutput
+		for _, value := range values {
+			outputs = append(outputs, TxOutput{Value: value, Address: address})
+		}
+		return NewTransaction([]TxInput{{TxID: zeroHash, OutputIndex: 0}}, outputs)
+	}
+	manyOutputs := func(n int) []int64 {
+		values := make([]int64, n)
+		for i := range values {
+			values[i] = DustThreshold
+		}
+		return values
+	}
+
+	tests := []struct {
+		name       string
+		tx         *Transaction
+		wantReason string
+	}{
+		{"standard", payment(bob.address, 1000), ""},
+		{"output at the dust threshold", payment(bob.address, DustThreshold), ""},
+		{"outputs at the limit", payment(bob.address, manyOutputs(MaxStandardTxOutputs)...), ""},
+		{"coinbase", NewCoinbaseTransaction(bob.address, 1000, 1), "coinbase"},
+		{"dust output", payment(bob.address, 1000, DustThreshold-1), "dust"},
+		{"too many outputs", payment(bob.address, manyOutputs(MaxStandardTxOutputs+1)...), "too-many-outputs"},
+		{"address of another network", payment(mainnet, 1000), "bad-address"},
+		{"malformed address", payment("bob", 1000), "bad-address"},
+		{"too big", payment(strings.Repeat("b", MaxStandardTxSize), 1000), "tx-size"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckTransactionStandard(tt.tx, &params)
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Errorf("CheckTransactionStandard = %v, want nil", err)
+				}
+				return
+			}
+
+			var policyErr PolicyError
+			if !errors.As(err, &policyErr) || policyErr.Reason != tt.wantReason {
+				t.Errorf("CheckTransactionStandard = %v, want %s", err, tt.wantReason)
+			}
+			if err := tt.tx.Validate(); err != nil {
+				t.Errorf("Validate = %v, want a transaction valid by consensus", err)
+			}
+		})
+	}
+}
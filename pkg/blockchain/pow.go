@@ -0,0 +1,125 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"math/big"
+)
+
+const (
+	// DefaultDifficultyBits is the compact form of a target with four leading
+	// zero hex digits, the difficulty the node has always started at.
+	DefaultDifficultyBits uint32 = 0x1f00ffff
+
+	// PowLimitBits is the easiest target any block may claim.
+	PowLimitBits uint32 = 0x207fffff
+)
+
+var (
+	bigOne    = big.NewInt(1)
+	oneLsh256 = new(big.Int).Lsh(bigOne, 256)
+	powLimit  = CompactToBig(PowLimitBits)
+)
+
+// CompactToBig decodes the compact target representation used in block
+// headers: the high byte is a base-256 exponent, bit 23 is the sign and the
+// low 23 bits are the mantissa, so target = mantissa * 256^(exponent-3).
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	isNegative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+
+	var target *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		target = big.NewInt(int64(mantissa))
+	} else {
+		target = big.NewInt(int64(mantissa))
+		target.Lsh(target, 8*(exponent-3))
+	}
+
+	if isNegative {
+		target = target.Neg(target)
+	}
+
+	return target
+}
+
+// BigToCompact is the inverse of CompactToBig. Precision beyond the three
+// mantissa bytes is truncated.
+func BigToCompact(target *big.Int) uint32 {
+	if target.Sign() == 0 {
+		return 0
+	}
+
+	var mantissa uint32
+	exponent := uint(len(target.Bytes()))
+	if exponent <= 3 {
+		mantissa = uint32(target.Bits()[0])
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		tmp := new(big.Int).Abs(target)
+		mantissa = uint32(tmp.Rsh(tmp, 8*(exponent-3)).Bits()[0])
+	}
+
+	// Keep the mantissa clear of the sign bit
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	compact := uint32(exponent<<24) | mantissa
+	if target.Sign() < 0 {
+		compact |= 0x00800000
+	}
+	return compact
+}
+
+// HashToBig interprets a hex block hash as a big-endian 256-bit integer.
+func HashToBig(hash string) *big.Int {
+	hashBytes, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil
+	}
+	return new(big.Int).SetBytes(hashBytes)
+}
+
+// CalcWork returns the expected number of hashes needed to find a block
+// meeting the target encoded in bits: 2^256 / (target + 1).
+func CalcWork(bits uint32) *big.Int {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+
+	denominator := new(big.Int).Add(target, bigOne)
+	return new(big.Int).Div(oneLsh256, denominator)
+}
+
+// CalcDifficultyRatio expresses bits as a multiple of the easiest allowed
+// target, which is easier to read than a raw compact value.
+func CalcDifficultyRatio(bits uint32) float64 {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return 0
+	}
+
+	ratio, _ := new(big.Rat).SetFrac(powLimit, target).Float64()
+	return ratio
+}
+
+func checkProofOfWork(hash string, bits uint32) error {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return ruleError(ErrBadDifficulty, "block target difficulty of %08x is not positive", bits)
+	}
+	if target.Cmp(powLimit) > 0 {
+		return ruleError(ErrBadDifficulty, "block target difficulty of %08x is easier than the minimum %08x", bits, PowLimitBits)
+	}
+
+	hashNum := HashToBig(hash)
+	if hashNum == nil || hashNum.Cmp(target) > 0 {
+		return ruleError(ErrHighHash, "block hash %s is higher than target %064x", hash, target)
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+func hexToBig(t *testing.T, s string) *big.Int {
+	t.Helper()
+
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("bad hex number %q", s)
+	}
+	return n
+}
+
+func TestCompactToBig(t *testing.T) {
+	tests := []struct {
+		compact uint32
+		want    string // Hex, with a leading minus if negative
+	}{
+		{0x00000000, "0"},
+		{0x00123456, "0"},
+		{0x01003456, "0"},
+		{0x01123456, "12"},
+		{0x02008000, "80"},
+		{0x03123456, "123456"},
+		{0x04123456, "12345600"},
+		{0x04923456, "-12345600"},
+		{0x05009234, "92340000"},
+		{0x1d00ffff, "ffff0000000000000000000000000000000000000000000000000000"},
+		{PowLimitBits, "7fffff0000000000000000000000000000000000000000000000000000000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%08x", tt.compact), func(t *testing.T) {
+			if got := CompactToBig(tt.compact); got.Cmp(hexToBig(t, tt.want)) != 0 {
+				t.Errorf("CompactToBig = %x, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBigToCompact(t *testing.T) {
+	tests := []struct {
+		target string
+		want   uint32
+	}{
+		{"0", 0},
+		{"12", 0x01120000},
+		{"80", 0x02008000},
+		{"123456", 0x03123456},
+		{"12345600", 0x04123456},
+		{"-12345600", 0x04923456},
+		{"92340000", 0x05009234},
+		// Precision past three bytes is dropped
+		{"12345678", 0x04123456},
+		{"ffff0000000000000000000000000000000000000000000000000000", 0x1d00ffff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			if got := BigToCompact(hexToBig(t, tt.target)); got != tt.want {
+				t.Errorf("BigToCompact = %08x, want %08x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompactRoundTrip(t *testing.T) {
+	for _, compact := range []uint32{0x01120000, 0x03123456, 0x04923456, 0x1b0404cb, 0x1d00ffff, DefaultDifficultyBits, PowLimitBits} {
+		if got := BigToCompact(CompactToBig(compact)); got != compact {
+			t.Errorf("BigToCompact(CompactToBig(%08x)) = %08x", compact, got)
+		}
+	}
+}
+
+func TestCalcWork(t *testing.T) {
+	tests := []struct {
+		bits uint32
+		want string
+	}{
+		{PowLimitBits, "2"},
+		{0x1d00ffff, "100010001"},
+		{0x1f00ffff, "10001"},
+		{0, "0"},
+		{0x04923456, "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%08x", tt.bits), func(t *testing.T) {
+			if got := CalcWork(tt.bits); got.Cmp(hexToBig(t, tt.want)) != 0 {
+				t.Errorf("CalcWork = %x, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// A harder target is more work
+	if CalcWork(0x1d00ffff).Cmp(CalcWork(DefaultDifficultyBits)) <= 0 {
+		t.Error("CalcWork of a lower target is not greater")
+	}
+}
+
+func TestCheckProofOfWork(t *testing.T) {
+	target := CompactToBig(DefaultDifficultyBits)
+	atTarget := fmt.Sprintf("%064x", target)
+	aboveTarget := fmt.Sprintf("%064x", new(big.Int).Add(target, bigOne))
+
+	tests := []struct {
+		name     string
+		hash     string
+		bits     uint32
+		wantCode ErrorCode
+		wantErr  bool
+	}{
+		{"below target", fmt.Sprintf("%064x", 1), DefaultDifficultyBits, 0, false},
+		{"at target", atTarget, DefaultDifficultyBits, 0, false},
+		{"above target", aboveTarget, DefaultDifficultyBits, ErrHighHash, true},
+		{"malformed hash", "zz", DefaultDifficultyBits, ErrHighHash, true},
+		{"zero target", atTarget, 0, ErrBadDifficulty, true},
+		{"negative target", atTarget, 0x04923456, ErrBadDifficulty, true},
+		{"easier than the limit", atTarget, 0x21008000, ErrBadDifficulty, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkProofOfWork(tt.hash, tt.bits)
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("checkProofOfWork = %v, want nil", err)
+				}
+				return
+			}
+
+			var ruleErr RuleError
+			if !errors.As(err, &ruleErr) || ruleErr.Code != tt.wantCode {
+				t.Errorf("checkProofOfWork = %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+}
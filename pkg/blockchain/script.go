@@ -0,0 +1,531 @@
+package blockchain
+
+import (
+	"blockchain-node/pkg/crypto"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Script is a program in the transaction scripting language. An output's
+// locking script states the conditions for spending it; a spending input's
+// unlocking script pushes the data, such as signatures, that satisfy them.
+// Scripts are hex strings in JSON.
+type Script []byte
+
+func (s Script) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(s))
+}
+
+func (s *Script) UnmarshalJSON(data []byte) error {
+	var hexScript string
+	if err := json.Unmarshal(data, &hexScript); err != nil {
+		return err
+	}
+
+	decoded, err := hex.DecodeString(hexScript)
+	if err != nil {
+		return fmt.Errorf("invalid script hex: %v", err)
+	}
+	*s = decoded
+	return nil
+}
+
+// String disassembles the script, e.g. "OP_DUP OP_HASH160 <20 bytes> ...".
+// Pushed data is shown in hex.
+func (s Script) String() string {
+	instructions, err := parseScript(s)
+	if err != nil {
+		return fmt.Sprintf("[invalid script: %v]", err)
+	}
+
+	parts := make([]string, len(instructions))
+	for i, ins := range instructions {
+		if ins.op <= OpPushData2 && ins.op != Op0 {
+			parts[i] = hex.EncodeToString(ins.data)
+		} else {
+			parts[i] = opcodeName(ins.op)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Opcodes of the scripting language. Their values follow Bitcoin's so that
+// scripts read the same to anyone familiar with it.
+const (
+	Op0                   byte = 0x00 // Push an empty value, which is false
+	OpPushData1           byte = 0x4c // Push data with a 1-byte length
+	OpPushData2           byte = 0x4d // Push data with a 2-byte length
+	Op1                   byte = 0x51 // Op1 to Op16 push the numbers 1 to 16
+	Op16                  byte = 0x60
+	OpIf                  byte = 0x63
+	OpNotIf               byte = 0x64
+	OpElse                byte = 0x67
+	OpEndIf               byte = 0x68
+	OpVerify              byte = 0x69
+	OpReturn              byte = 0x6a
+	OpDrop                byte = 0x75
+	OpDup                 byte = 0x76
+	OpEqual               byte = 0x87
+	OpEqualVerify         byte = 0x88
+	OpSHA256              byte = 0xa8
+	OpHash160             byte = 0xa9
+	OpCheckSig            byte = 0xac
+	OpCheckSigVerify      byte = 0xad
+	OpCheckMultiSig       byte = 0xae
+	OpCheckMultiSigVerify byte = 0xaf
+	OpCheckLockTimeVerify byte = 0xb1
+	OpCheckSequenceVerify byte = 0xb2
+)
+
+var opcodeNames = map[byte]string{
+	Op0:                   "OP_0",
+	OpIf:                  "OP_IF",
+	OpNotIf:               "OP_NOTIF",
+	OpElse:                "OP_ELSE",
+	OpEndIf:               "OP_ENDIF",
+	OpVerify:              "OP_VERIFY",
+	OpReturn:              "OP_RETURN",
+	OpDrop:                "OP_DROP",
+	OpDup:                 "OP_DUP",
+	OpEqual:               "OP_EQUAL",
+	OpEqualVerify:         "OP_EQUALVERIFY",
+	OpSHA256:              "OP_SHA256",
+	OpHash160:             "OP_HASH160",
+	OpCheckSig:            "OP_CHECKSIG",
+	OpCheckSigVerify:      "OP_CHECKSIGVERIFY",
+	OpCheckMultiSig:       "OP_CHECKMULTISIG",
+	OpCheckMultiSigVerify: "OP_CHECKMULTISIGVERIFY",
+	OpCheckLockTimeVerify: "OP_CHECKLOCKTIMEVERIFY",
+	OpCheckSequenceVerify: "OP_CHECKSEQUENCEVERIFY",
+}
+
+func opcodeName(op byte) string {
+	if op >= Op1 && op <= Op16 {
+		return fmt.Sprintf("OP_%d", op-Op1+1)
+	}
+	if name, exists := opcodeNames[op]; exists {
+		return name
+	}
+	return fmt.Sprintf("OP_UNKNOWN_%#02x", op)
+}
+
+// instruction is a parsed opcode with the data it pushes, if any.
+type instruction struct {
+	op   byte
+	data []byte
+}
+
+func parseScript(script Script) ([]instruction, error) {
+	var instructions []instruction
+	for i := 0; i < len(script); {
+		op := script[i]
+		i++
+
+		var length int
+		switch {
+		case op > Op0 && op < OpPushData1:
+			length = int(op)
+		case op == OpPushData1:
+			if i+1 > len(script) {
+				return nil, errors.New("truncated push length")
+			}
+			length = int(script[i])
+			i++
+		case op == OpPushData2:
+			if i+2 > len(script) {
+				return nil, errors.New("truncated push length")
+			}
+			length = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		default:
+			instructions = append(instructions, instruction{op: op})
+			continue
+		}
+
+		if i+length > len(script) {
+			return nil, fmt.Errorf("push of %d bytes runs past the end of the script", length)
+		}
+		instructions = append(instructions, instruction{op: op, data: script[i : i+length]})
+		i += length
+	}
+	return instructions, nil
+}
+
+// isMinimalPush reports whether ins is a push in the form ScriptBuilder
+// would have written it: Op1 to Op16 for small numbers, otherwise the
+// shortest data push.
+func isMinimalPush(ins instruction) bool {
+	switch {
+	case ins.op >= Op1 && ins.op <= Op16:
+		return true
+	case ins.op > OpPushData2:
+		return false
+	case len(ins.data) == 1 && ins.data[0] >= 1 && ins.data[0] <= 16:
+		return false
+	}
+	return NewScriptBuilder().AddData(ins.data).Script()[0] == ins.op
+}
+
+// isPushOnly reports whether the instructions only push data.
+func isPushOnly(instructions []instruction) bool {
+	for _, ins := range instructions {
+		if ins.op > Op16 {
+			return false
+		}
+	}
+	return true
+}
+
+// ScriptBuilder assembles a script, choosing the shortest encoding for each
+// push.
+type ScriptBuilder struct {
+	script Script
+}
+
+func NewScriptBuilder() *ScriptBuilder {
+	return &ScriptBuilder{}
+}
+
+func (b *ScriptBuilder) AddOp(op byte) *ScriptBuilder {
+	b.script = append(b.script, op)
+	return b
+}
+
+func (b *ScriptBuilder) AddData(data []byte) *ScriptBuilder {
+	switch {
+	case len(data) == 0:
+		b.script = append(b.script, Op0)
+	case len(data) < int(OpPushData1):
+		b.script = append(b.script, byte(len(data)))
+	case len(data) <= 0xff:
+		b.script = append(b.script, OpPushData1, byte(len(data)))
+	default:
+		b.script = append(b.script, OpPushData2)
+		b.script = binary.LittleEndian.AppendUint16(b.script, uint16(len(data)))
+	}
+	b.script = append(b.script, data...)
+	return b
+}
+
+// AddInt pushes a number, using Op1 to Op16 where possible.
+func (b *ScriptBuilder) AddInt(n int64) *ScriptBuilder {
+	if n >= 1 && n <= 16 {
+		return b.AddOp(Op1 + byte(n-1))
+	}
+	return b.AddData(encodeScriptNum(n))
+}
+
+func (b *ScriptBuilder) Script() Script {
+	return b.script
+}
+
+// encodeScriptNum encodes n little-endian in as few bytes as possible, with
+// the sign in the top bit of the last byte. Zero is empty.
+func encodeScriptNum(n int64) []byte {
+	if n == 0 {
+		return nil
+	}
+
+	negative := n < 0
+	magnitude := uint64(n)
+	if negative {
+		magnitude = uint64(-n)
+	}
+
+	var result []byte
+	for magnitude > 0 {
+		result = append(result, byte(magnitude))
+		magnitude >>= 8
+	}
+
+	if result[len(result)-1]&0x80 != 0 {
+		extra := byte(0)
+		if negative {
+			extra = 0x80
+		}
+		result = append(result, extra)
+	} else if negative {
+		result[len(result)-1] |= 0x80
+	}
+	return result
+}
+
+// decodeScriptNum is the inverse of encodeScriptNum for values of at most
+// maxLength bytes. Non-minimal encodings are rejected so each number has
+// one form.
+func decodeScriptNum(data []byte, maxLength int) (int64, error) {
+	if len(data) > maxLength {
+		return 0, fmt.Errorf("number is %d bytes, limit is %d", len(data), maxLength)
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	last := data[len(data)-1]
+	if last&0x7f == 0 && (len(data) == 1 || data[len(data)-2]&0x80 == 0) {
+		return 0, errors.New("number is not minimally encoded")
+	}
+
+	var result int64
+	for i, b := range data {
+		result |= int64(b) << (8 * i)
+	}
+
+	if last&0x80 != 0 {
+		result &^= int64(0x80) << (8 * (len(data) - 1))
+		return -result, nil
+	}
+	return result, nil
+}
+
+// PayToPubKeyHashScript locks an output to the key whose Hash160 is
+// pubKeyHash. It is spent with SignatureScript.
+func PayToPubKeyHashScript(pubKeyHash []byte) Script {
+	return NewScriptBuilder().
+		AddOp(OpDup).AddOp(OpHash160).AddData(pubKeyHash).AddOp(OpEqualVerify).
+		AddOp(OpCheckSig).
+		Script()
+}
+
+// PayToAddressScript is the locking script an address stands for:
+// pay-to-script-hash for a script address, otherwise pay-to-pubkey-hash.
+func PayToAddressScript(address string) (Script, error) {
+	hash, err := crypto.ExtractPublicKeyHash(address)
+	if err != nil {
+		return nil, err
+	}
+	if crypto.IsScriptAddress(address) {
+		return PayToScriptHashScript(hash), nil
+	}
+	return PayToPubKeyHashScript(hash), nil
+}
+
+// HashLockScript locks an output to the key whose Hash160 is pubKeyHash,
+// but only once the SHA-256 preimage of hash is revealed. It is spent with
+// a SignatureScript followed by a push of the preimage.
+func HashLockScript(hash []byte, pubKeyHash []byte) Script {
+	return NewScriptBuilder().
+		AddOp(OpSHA256).AddData(hash).AddOp(OpEqualVerify).
+		AddOp(OpDup).AddOp(OpHash160).AddData(pubKeyHash).AddOp(OpEqualVerify).
+		AddOp(OpCheckSig).
+		Script()
+}
+
+// TimeLockScript locks an output to the key whose Hash160 is pubKeyHash
+// until lockTime: a block height, or a median time past if at least
+// LockTimeThreshold. It is spent with SignatureScript by a transaction whose
+// lock time is at least lockTime.
+func TimeLockScript(lockTime int64, pubKeyHash []byte) Script {
+	return NewScriptBuilder().
+		AddInt(lockTime).AddOp(OpCheckLockTimeVerify).AddOp(OpDrop).
+		AddOp(OpDup).AddOp(OpHash160).AddData(pubKeyHash).AddOp(OpEqualVerify).
+		AddOp(OpCheckSig).
+		Script()
+}
+
+// RelativeTimeLockScript locks an output to the key whose Hash160 is
+// pubKeyHash until it has aged by sequence, encoded like TxInput.Sequence.
+// It is spent with SignatureScript by an input whose sequence is at least
+// sequence.
+func RelativeTimeLockScript(sequence uint32, pubKeyHash []byte) Script {
+	return NewScriptBuilder().
+		AddInt(int64(sequence)).AddOp(OpCheckSequenceVerify).AddOp(OpDrop).
+		AddOp(OpDup).AddOp(OpHash160).AddData(pubKeyHash).AddOp(OpEqualVerify).
+		AddOp(OpCheckSig).
+		Script()
+}
+
+// ParseTimeLockScript returns the lock of a TimeLockScript or
+// RelativeTimeLockScript and the key hash it pays to. relative tells which
+// it is: the lock is a lock time for the first and a sequence for the second.
+func ParseTimeLockScript(script Script) (lock int64, relative bool, pubKeyHash []byte, err error) {
+	instructions, err := parseScript(script)
+	if err != nil {
+		return 0, false, nil, err
+	}
+
+	if len(instructions) != 8 || !isMinimalPush(instructions[0]) ||
+		(instructions[1].op != OpCheckLockTimeVerify && instructions[1].op != OpCheckSequenceVerify) ||
+		instructions[2].op != OpDrop || !isPubKeyHash(instructions[3:]) {
+		return 0, false, nil, errors.New("not a time lock script")
+	}
+
+	lock = int64(smallInt(instructions[0].op))
+	if instructions[0].op <= OpPushData2 {
+		if lock, err = decodeScriptNum(instructions[0].data, 5); err != nil {
+			return 0, false, nil, err
+		}
+	}
+
+	relative = instructions[1].op == OpCheckSequenceVerify
+	if lock < 0 || (relative && !validSequence(lock)) {
+		return 0, false, nil, fmt.Errorf("invalid lock %d", lock)
+	}
+	return lock, relative, instructions[5].data, nil
+}
+
+// MultiSigScript locks an output until required of the public keys have
+// signed, each at most once. It is spent with MultiSigUnlockingScript.
+func MultiSigScript(required int, publicKeys [][]byte) (Script, error) {
+	if len(publicKeys) == 0 || len(publicKeys) > MaxMultiSigKeys {
+		return nil, fmt.Errorf("multisig needs 1 to %d public keys, got %d", MaxMultiSigKeys, len(publicKeys))
+	}
+	if required < 1 || required > len(publicKeys) {
+		return nil, fmt.Errorf("multisig needs 1 to %d signatures, got %d", len(publicKeys), required)
+	}
+
+	builder := NewScriptBuilder().AddInt(int64(required))
+	for _, publicKey := range publicKeys {
+		builder.AddData(publicKey)
+	}
+	return builder.AddInt(int64(len(publicKeys))).AddOp(OpCheckMultiSig).Script(), nil
+}
+
+// ParseMultiSigScript returns the number of signatures a MultiSigScript
+// requires and its public keys.
+func ParseMultiSigScript(script Script) (required int, publicKeys [][]byte, err error) {
+	instructions, err := parseScript(script)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	count := len(instructions) - 3
+	if count < 1 || instructions[len(instructions)-1].op != OpCheckMultiSig ||
+		smallInt(instructions[0].op) < 1 || smallInt(instructions[len(instructions)-2].op) != count {
+		return 0, nil, errors.New("not a multisig script")
+	}
+
+	required = smallInt(instructions[0].op)
+	if required > count {
+		return 0, nil, errors.New("multisig script requires more signatures than it has keys")
+	}
+
+	for _, ins := range instructions[1 : 1+count] {
+		if ins.op > OpPushData2 || len(ins.data) != 33 {
+			return 0, nil, errors.New("multisig script key is not a compressed public key")
+		}
+		publicKeys = append(publicKeys, ins.data)
+	}
+	return required, publicKeys, nil
+}
+
+// smallInt returns the number pushed by Op1 to Op16, or 0 for any other
+// opcode.
+func smallInt(op byte) int {
+	if op < Op1 || op > Op16 {
+		return 0
+	}
+	return int(op-Op1) + 1
+}
+
+// PayToScriptHashScript locks an output to the script whose Hash160 is
+// scriptHash, the redeem script. The spender reveals the redeem script as
+// the last push of the unlocking script, after the data that satisfies it.
+func PayToScriptHashScript(scriptHash []byte) Script {
+	return NewScriptBuilder().AddOp(OpHash160).AddData(scriptHash).AddOp(OpEqual).Script()
+}
+
+// isPayToScriptHash reports whether a locking script is in the exact form
+// PayToScriptHashScript makes, which triggers redeem script evaluation.
+func isPayToScriptHash(script Script) bool {
+	return len(script) == 23 && script[0] == OpHash160 && script[1] == 20 && script[22] == OpEqual
+}
+
+// SignatureScript is the unlocking script for the key-locked scripts above.
+func SignatureScript(signature, publicKey []byte) Script {
+	return NewScriptBuilder().AddData(signature).AddData(publicKey).Script()
+}
+
+// MultiSigUnlockingScript spends a multisig output. The signatures must be
+// in the same order as their keys in the multisig script. For a
+// pay-to-script-hash output redeemScript is the multisig script; for a bare
+// multisig locking script it is nil.
+func MultiSigUnlockingScript(signatures [][]byte, redeemScript Script) Script {
+	builder := NewScriptBuilder()
+	for _, signature := range signatures {
+		builder.AddData(signature)
+	}
+	if redeemScript != nil {
+		builder.AddData(redeemScript)
+	}
+	return builder.Script()
+}
+
+// ScriptClass names the standard forms of locking script.
+type ScriptClass int
+
+const (
+	NonStandardScript ScriptClass = iota
+	PubKeyHashScript
+	HashLockedScript
+	TimeLockedScript
+	MultiSigLockedScript
+	ScriptHashScript
+	RelativeTimeLockedScript
+)
+
+var scriptClassStrings = map[ScriptClass]string{
+	NonStandardScript:        "nonstandard",
+	PubKeyHashScript:         "pubkeyhash",
+	HashLockedScript:         "hashlock",
+	TimeLockedScript:         "timelock",
+	MultiSigLockedScript:     "multisig",
+	ScriptHashScript:         "scripthash",
+	RelativeTimeLockedScript: "relativetimelock",
+}
+
+func (c ScriptClass) String() string {
+	return scriptClassStrings[c]
+}
+
+// ClassifyScript returns the standard form a locking script takes, if any.
+func ClassifyScript(script Script) ScriptClass {
+	instructions, err := parseScript(script)
+	if err != nil {
+		return NonStandardScript
+	}
+
+	if _, _, err := ParseMultiSigScript(script); err == nil {
+		return MultiSigLockedScript
+	}
+
+	switch {
+	case isPayToScriptHash(script):
+		return ScriptHashScript
+	case isPubKeyHash(instructions):
+		return PubKeyHashScript
+	case len(instructions) == 8 && instructions[0].op == OpSHA256 && len(instructions[1].data) == 32 &&
+		instructions[2].op == OpEqualVerify && isPubKeyHash(instructions[3:]):
+		return HashLockedScript
+	}
+
+	if _, relative, _, err := ParseTimeLockScript(script); err == nil {
+		if relative {
+			return RelativeTimeLockedScript
+		}
+		return TimeLockedScript
+	}
+	return NonStandardScript
+}
+
+func isPubKeyHash(instructions []instruction) bool {
+	return len(instructions) == 5 &&
+		instructions[0].op == OpDup &&
+		instructions[1].op == OpHash160 &&
+		len(instructions[2].data) == 20 &&
+		instructions[3].op == OpEqualVerify &&
+		instructions[4].op == OpCheckSig
+}
+
+// lockingScript returns the script an output is locked by: its own locking
+// script, or pay-to-pubkey-hash for an output that pays an address.
+func lockingScript(address string, script Script) (Script, error) {
+	if len(script) > 0 {
+		return script, nil
+	}
+	return PayToAddressScript(address)
+}
@@ -0,0 +1,175 @@
+package blockchain
+
+import (
+	"blockchain-node/pkg/crypto"
+	"bytes"
+	"testing"
+)
+
+func TestVerifyScriptMultiSig(t *testing.T) {
+	keys := []*testKey{newTestKey(t), newTestKey(t), newTestKey(t)}
+	publicKeys := make([][]byte, len(keys))
+	for i, key := range keys {
+		publicKeys[i] = key.publicKey
+	}
+
+	redeemScript, err := MultiSigScript(2, publicKeys)
+	if err != nil {
+		t.Fatalf("MultiSigScript: %v", err)
+	}
+	otherScript, err := MultiSigScript(1, publicKeys)
+	if err != nil {
+		t.Fatalf("MultiSigScript: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		signers []int // Indexes into keys, in signing order
+		p2sh    bool
+		// redeem is the redeem script revealed for a pay-to-script-hash
+		// output, if not redeemScript
+		redeem  Script
+		wantErr bool
+	}{
+		{name: "first and second", signers: []int{0, 1}},
+		{name: "first and third", signers: []int{0, 2}},
+		{name: "second and third", signers: []int{1, 2}},
+		{name: "out of order", signers: []int{1, 0}, wantErr: true},
+		{name: "same key twice", signers: []int{0, 0}, wantErr: true},
+		{name: "too few signatures", signers: []int{0}, wantErr: true},
+		{name: "no signatures", wantErr: true},
+		{name: "script hash", signers: []int{0, 2}, p2sh: true},
+		{name: "script hash out of order", signers: []int{2, 0}, p2sh: true, wantErr: true},
+		{name: "script hash too few signatures", signers: []int{1}, p2sh: true, wantErr: true},
+		{name: "script hash other redeem script", signers: []int{0}, p2sh: true, redeem: otherScript, wantErr: true},
+		{name: "script hash no redeem script", signers: []int{0, 1}, p2sh: true, redeem: Script{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prevOut := testOutput("", redeemScript)
+			var reveal Script
+			if tt.p2sh {
+				prevOut = testOutput("", PayToScriptHashScript(crypto.Hash160(redeemScript)))
+				reveal = redeemScript
+				if tt.redeem != nil {
+					reveal = tt.redeem
+				}
+			}
+
+			tx := spendingTx(prevOut)
+			signatures := make([][]byte, len(tt.signers))
+			for i, signer := range tt.signers {
+				signatures[i] = keys[signer].sign(t, tx, 0, prevOut)
+			}
+			tx.Inputs[0].UnlockingScript = MultiSigUnlockingScript(signatures, reveal)
+
+			err := VerifyScript(tx, 0, prevOut)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyScript error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyScriptPayToScriptHashRunsRedeemScript(t *testing.T) {
+	// A redeem script that always fails must fail the spend even though
+	// its hash matches
+	redeemScript := NewScriptBuilder().AddOp(OpReturn).Script()
+	prevOut := testOutput("", PayToScriptHashScript(crypto.Hash160(redeemScript)))
+
+	tx := spendingTx(prevOut)
+	tx.Inputs[0].UnlockingScript = NewScriptBuilder().AddData(redeemScript).Script()
+	if err := VerifyScript(tx, 0, prevOut); err == nil {
+		t.Error("VerifyScript accepted a failing redeem script")
+	}
+}
+
+func TestMultiSigScript(t *testing.T) {
+	var publicKeys [][]byte
+	for i := 0; i < MaxMultiSigKeys+1; i++ {
+		publicKeys = append(publicKeys, newTestKey(t).publicKey)
+	}
+
+	tests := []struct {
+		name     string
+		required int
+		keys     int
+		wantErr  bool
+	}{
+		{"1 of 1", 1, 1, false},
+		{"2 of 3", 2, 3, false},
+		{"3 of 3", 3, 3, false},
+		{"most keys", MaxMultiSigKeys, MaxMultiSigKeys, false},
+		{"no keys", 1, 0, true},
+		{"too many keys", 1, MaxMultiSigKeys + 1, true},
+		{"no signatures", 0, 3, true},
+		{"more signatures than keys", 4, 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := MultiSigScript(tt.required, publicKeys[:tt.keys])
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MultiSigScript error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if class := ClassifyScript(script); class != MultiSigLockedScript {
+				t.Errorf("ClassifyScript = %s, want %s", class, MultiSigLockedScript)
+			}
+
+			required, keys, err := ParseMultiSigScript(script)
+			if err != nil {
+				t.Fatalf("ParseMultiSigScript: %v", err)
+			}
+			if required != tt.required {
+				t.Errorf("ParseMultiSigScript required = %d, want %d", required, tt.required)
+			}
+			if len(keys) != tt.keys {
+				t.Fatalf("ParseMultiSigScript returned %d keys, want %d", len(keys), tt.keys)
+			}
+			for i, key := range keys {
+				if !bytes.Equal(key, publicKeys[i]) {
+					t.Errorf("key %d = %x, want %x", i, key, publicKeys[i])
+				}
+			}
+		})
+	}
+}
+
+func TestClassifyScript(t *testing.T) {
+	key := newTestKey(t)
+	pubKeyHash := key.pubKeyHash(t)
+	multiSig, err := MultiSigScript(1, [][]byte{key.publicKey})
+	if err != nil {
+		t.Fatalf("MultiSigScript: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		script Script
+		want   ScriptClass
+	}{
+		{"pay to pubkey hash", PayToPubKeyHashScript(pubKeyHash), PubKeyHashScript},
+		{"hash lock", HashLockScript(make([]byte, 32), pubKeyHash), HashLockedScript},
+		{"time lock", TimeLockScript(1000, pubKeyHash), TimeLockedScript},
+		{"multisig", multiSig, MultiSigLockedScript},
+		{"script hash", PayToScriptHashScript(crypto.Hash160(multiSig)), ScriptHashScript},
+		{"multisig with a short key", NewScriptBuilder().AddInt(1).AddData(key.publicKey[:32]).AddInt(1).AddOp(OpCheckMultiSig).Script(), NonStandardScript},
+		{"multisig with a wrong key count", NewScriptBuilder().AddInt(1).AddData(key.publicKey).AddInt(2).AddOp(OpCheckMultiSig).Script(), NonStandardScript},
+		{"script hash of the wrong length", NewScriptBuilder().AddOp(OpHash160).AddData(make([]byte, 19)).AddOp(OpEqual).Script(), NonStandardScript},
+		{"truncated", Script{OpPushData1}, NonStandardScript},
+		{"empty", nil, NonStandardScript},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyScript(tt.script); got != tt.want {
+				t.Errorf("ClassifyScript(%s) = %s, want %s", tt.script, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package blockchain
+
+// CalcBlockSubsidy returns the new coins a block at the given height may
+// create. The subsidy halves every SubsidyHalvingInterval blocks and reaches
+// zero once it has been shifted past its last bit.
+func CalcBlockSubsidy(height int64, params *ChainParams) int64 {
+	if params.SubsidyHalvingInterval <= 0 {
+		return params.InitialSubsidy
+	}
+
+	halvings := height / params.SubsidyHalvingInterval
+	if halvings >= 63 {
+		return 0
+	}
+
+	return params.InitialSubsidy >> uint(halvings)
+}
@@ -0,0 +1,92 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCalcBlockSubsidy(t *testing.T) {
+	params := MainNetParams
+	initial := params.InitialSubsidy
+	interval := params.SubsidyHalvingInterval
+
+	tests := []struct {
+		name   string
+		height int64
+		want   int64
+	}{
+		{"genesis", 0, initial},
+		{"before the first halving", interval - 1, initial},
+		{"first halving", interval, initial / 2},
+		{"before the second halving", 2*interval - 1, initial / 2},
+		{"second halving", 2 * interval, initial / 4},
+		{"last satoshi", 32 * interval, 1},
+		{"run out", 33 * interval, 0},
+		{"past the shift width", 64 * interval, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CalcBlockSubsidy(tt.height, &params); got != tt.want {
+				t.Errorf("CalcBlockSubsidy(%d) = %d, want %d", tt.height, got, tt.want)
+			}
+		})
+	}
+
+	params.SubsidyHalvingInterval = 0
+	if got := CalcBlockSubsidy(100*interval, &params); got != initial {
+		t.Errorf("CalcBlockSubsidy without halvings = %d, want %d", got, initial)
+	}
+}
+
+func TestValidateTransactionsCapsCoinbase(t *testing.T) {
+	alice := newTestKey(t)
+	const fee = 10
+
+	tests := []struct {
+		name     string
+		withFee  bool  // include a transaction paying fee
+		excess   int64 // coinbase value over the subsidy
+		wantCode ErrorCode
+		wantErr  bool
+	}{
+		{name: "subsidy", excess: 0},
+		{name: "under the subsidy", excess: -1},
+		{name: "over the subsidy", excess: 1, wantCode: ErrBadCoinbaseValue, wantErr: true},
+		{name: "subsidy plus fees", withFee: true, excess: fee},
+		{name: "over subsidy plus fees", withFee: true, excess: fee + 1, wantCode: ErrBadCoinbaseValue, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc, _ := newTestChain(t)
+			const height = 2
+			subsidy := CalcBlockSubsidy(height, bc.params)
+
+			transactions := []Transaction{*NewCoinbaseTransaction(alice.address, subsidy+tt.excess, height)}
+			if tt.withFee {
+				funding := fund(bc, alice.address, 50)
+				tx := NewTransaction(
+					[]TxInput{{TxID: funding.ID, OutputIndex: 0}},
+					[]TxOutput{{Value: 50 - fee, Address: alice.address}},
+				)
+				alice.signInput(t, tx, 0, output(funding, 0))
+				tx.SetID()
+				transactions = append(transactions, *tx)
+			}
+
+			err := bc.validateTransactions(&Block{Header: BlockHeader{Height: height}, Transactions: transactions}, true)
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("validateTransactions = %v, want nil", err)
+				}
+				return
+			}
+
+			var ruleErr RuleError
+			if !errors.As(err, &ruleErr) || ruleErr.Code != tt.wantCode {
+				t.Errorf("validateTransactions = %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+}
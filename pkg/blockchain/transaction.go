@@ -1,31 +1,60 @@
 package blockchain
 
 import (
+	"blockchain-node/pkg/crypto"
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
-	"crypto/sha256"
 	"time"
 	"fmt"
 )
 
+// Consensus limits on a single transaction. Sizes are measured on the binary
+// wire encoding.
+const (
+	MaxTransactionSize = 500000
+	MaxTxInputs        = 5000
+	MaxTxOutputs       = 5000
+)
+
+// MaxMoney is the most satoshis that will ever exist: 21 million coins. No
+// output may carry more, nor may the inputs or outputs of a transaction add
+// up to more, so sums of values can never overflow.
+const MaxMoney = 21000000 * 100000000
+
 type Transaction struct {
-	ID        string    `json:"id"`
-	Inputs    []TxInput `json:"inputs"`
-	Outputs   []TxOutput `json:"outputs"`
-	Timestamp int64     `json:"timestamp"`
-	Signature string    `json:"signature"`
+	ID                string     `json:"id"`
+	Inputs            []TxInput  `json:"inputs"`
+	Outputs           []TxOutput `json:"outputs"`
+	Timestamp         int64      `json:"timestamp"`
+	LockTime          int64      `json:"lock_time,omitempty"`          // First height or median time past the transaction may be mined at
+	Height            int64      `json:"height,omitempty"`             // Block height, set on coinbase transactions only
+	WitnessCommitment string     `json:"witness_commitment,omitempty"` // Witness merkle root, set on coinbase transactions only
 }
 
 type TxInput struct {
-	TxID        string `json:"tx_id"`
-	OutputIndex int    `json:"output_index"`
-	PublicKey   string `json:"public_key"`
-	Signature   string `json:"signature"`
+	TxID            string `json:"tx_id"`
+	OutputIndex     int    `json:"output_index"`
+	Sequence        uint32 `json:"sequence,omitempty"`         // Relative lock on the output spent
+	UnlockingScript Script `json:"unlocking_script,omitempty"` // Satisfies the locking script of the output spent
 }
 
+// TxOutput pays either an address, which locks it to the address's key as a
+// pay-to-pubkey-hash script would, or an explicit locking script.
 type TxOutput struct {
-	Value   int64  `json:"value"`
-	Address string `json:"address"`
+	Value         int64  `json:"value"`
+	Address       string `json:"address,omitempty"`
+	LockingScript Script `json:"locking_script,omitempty"`
+}
+
+// PublicKey returns the hex public key an input was signed with: the last
+// value its unlocking script pushes. It is empty if the script pushes none.
+func (in TxInput) PublicKey() string {
+	instructions, err := parseScript(in.UnlockingScript)
+	if err != nil || len(instructions) == 0 {
+		return ""
+	}
+	return hex.EncodeToString(instructions[len(instructions)-1].data)
 }
 
 func NewTransaction(inputs []TxInput, outputs []TxOutput) *Transaction {
@@ -38,49 +67,101 @@ func NewTransaction(inputs []TxInput, outputs []TxOutput) *Transaction {
 	return tx
 }
 
-func NewCoinbaseTransaction(toAddress string, reward int64) *Transaction {
+func NewCoinbaseTransaction(toAddress string, reward int64, height int64) *Transaction {
 	// Coinbase transaction has no inputs, only outputs
 	txOut := TxOutput{
 		Value:   reward,
 		Address: toAddress,
 	}
 	
+	// The height keeps coinbase IDs unique even when two blocks pay the same reward to the same address
 	tx := &Transaction{
 		Inputs:    []TxInput{},
 		Outputs:   []TxOutput{txOut},
 		Timestamp: time.Now().Unix(),
+		Height:    height,
 	}
 	tx.ID = tx.calculateID()
 	return tx
 }
 
+// calculateID hashes the binary transaction without its unlocking scripts,
+// so signing a transaction or re-encoding its
+// signatures never changes its ID. A transaction that cannot be serialized
+// gets an empty ID.
 func (tx *Transaction) calculateID() string {
-	txCopy := Transaction{
-		Inputs:    tx.Inputs,
-		Outputs:   tx.Outputs,
-		Timestamp: tx.Timestamp,
-		Signature: tx.Signature,
+	var buf bytes.Buffer
+	if err := tx.writeBinary(&buf, false); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(crypto.DoubleHashSHA256(buf.Bytes()))
+}
+
+func (tx *Transaction) SetID() {
+	tx.ID = tx.calculateID()
+}
+
+// WitnessHash hashes the full binary transaction, unlocking data included.
+// For a coinbase, which has none, it equals the ID.
+func (tx *Transaction) WitnessHash() string {
+	data, err := tx.SerializeBinary()
+	if err != nil {
+		return ""
 	}
+	return hex.EncodeToString(crypto.DoubleHashSHA256(data))
+}
 
-	data, _ := json.Marshal(txCopy)
-	hash := sha256.Sum256(data)
-	return hex.EncodeToString(hash[:])
+// SignatureHash is the digest signed for a single input: the double SHA-256
+// of the transaction's binary encoding without unlocking scripts, which
+// commits to every input's outpoint and sequence, the outputs and the lock
+// time, followed by the index of the input being signed and the value,
+// address and locking script of the output it spends. A transaction that
+// cannot be encoded has no signature hash and nil is returned.
+func (tx *Transaction) SignatureHash(inputIndex int, prevOut *UTXO) []byte {
+	var buf bytes.Buffer
+	if err := tx.writeBinary(&buf, false); err != nil {
+		return nil
+	}
+	
+	writeVarInt(&buf, uint64(inputIndex))
+	writeUint64(&buf, uint64(prevOut.Value))
+	writeVarString(&buf, prevOut.Address)
+	writeVarBytes(&buf, prevOut.LockingScript)
+	
+	return crypto.DoubleHashSHA256(buf.Bytes())
 }
 
 func (tx *Transaction) IsCoinbase() bool {
 	return len(tx.Inputs) == 0
 }
 
-func (tx *Transaction) GetTotalInput() int64 {
+// GetTotalInput sums the values of the outputs spent by tx, resolved through
+// view. Coinbase transactions have no inputs and total zero.
+func (tx *Transaction) GetTotalInput(view UTXOView) (int64, error) {
+	if tx.IsCoinbase() {
+		return 0, nil
+	}
+	
 	var total int64
-	for _, input := range tx.Inputs {
-		if tx.IsCoinbase() {
-			return 0
+	for i, input := range tx.Inputs {
+		op := OutPoint{TxID: input.TxID, Index: input.OutputIndex}
+		entry, exists := view.Get(op)
+		if !exists {
+			return 0, ruleError(ErrMissingInput, "transaction %s input %d references missing or spent output %s", tx.ID, i, op)
+		}
+		
+		if entry.Value < 0 || entry.Value > MaxMoney {
+			return 0, ruleError(ErrBadInputValue, "transaction %s input %d spends output %s of value %d, outside 0..%d", tx.ID, i, op, entry.Value, MaxMoney)
+		}
+		if total += entry.Value; total > MaxMoney {
+			return 0, ruleError(ErrBadInputValue, "transaction %s inputs total more than %d", tx.ID, MaxMoney)
 		}
 	}
-	return total
+	return total, nil
 }
 
+// GetTotalOutput sums the output values. It is only meaningful for a
+// transaction that passed Validate, which keeps the sum within MaxMoney.
 func (tx *Transaction) GetTotalOutput() int64 {
 	var total int64
 	for _, output := range tx.Outputs {
@@ -89,11 +170,79 @@ func (tx *Transaction) GetTotalOutput() int64 {
 	return total
 }
 
+// checkOutputValues fails unless every output value is within 0..MaxMoney
+// and so is their running total.
+func (tx *Transaction) checkOutputValues() error {
+	var total int64
+	for i, output := range tx.Outputs {
+		if output.Value < 0 || output.Value > MaxMoney {
+			return ruleError(ErrBadOutputValue, "output %d value %d is outside 0..%d", i, output.Value, MaxMoney)
+		}
+		if total += output.Value; total > MaxMoney {
+			return ruleError(ErrBadOutputValue, "outputs total more than %d", MaxMoney)
+		}
+	}
+	return nil
+}
+
+// GetFee returns total input minus total output. Coinbase transactions have no fee.
+func (tx *Transaction) GetFee(view UTXOView) (int64, error) {
+	if tx.IsCoinbase() {
+		return 0, nil
+	}
+	
+	if err := tx.checkOutputValues(); err != nil {
+		return 0, err
+	}
+	
+	totalInput, err := tx.GetTotalInput(view)
+	if err != nil {
+		return 0, err
+	}
+	
+	return totalInput - tx.GetTotalOutput(), nil
+}
+
 func (tx *Transaction) Validate() error {
+	if len(tx.Inputs) > MaxTxInputs {
+		return ruleError(ErrTooManyInputs, "transaction has %d inputs, limit is %d", len(tx.Inputs), MaxTxInputs)
+	}
+	
+	if len(tx.Outputs) > MaxTxOutputs {
+		return ruleError(ErrTooManyOutputs, "transaction has %d outputs, limit is %d", len(tx.Outputs), MaxTxOutputs)
+	}
+	
+	data, err := tx.SerializeBinary()
+	if err != nil {
+		return fmt.Errorf("malformed transaction: %v", err)
+	}
+	
+	if len(data) > MaxTransactionSize {
+		return ruleError(ErrTxTooBig, "transaction is %d bytes, limit is %d", len(data), MaxTransactionSize)
+	}
+
 	expectedID := tx.calculateID()
 	if tx.ID != expectedID {
 		return fmt.Errorf("invalid transaction ID")
 	}
+	
+	if tx.LockTime < 0 {
+		return fmt.Errorf("negative lock time")
+	}
+	
+	// Every output, coinbase included, is locked in exactly one way
+	for i, output := range tx.Outputs {
+		if (output.Address == "") == (len(output.LockingScript) == 0) {
+			return fmt.Errorf("output %d must pay either an address or a locking script", i)
+		}
+		if len(output.LockingScript) > MaxScriptSize {
+			return fmt.Errorf("output %d locking script is %d bytes, limit is %d", i, len(output.LockingScript), MaxScriptSize)
+		}
+	}
+	
+	if err := tx.checkOutputValues(); err != nil {
+		return err
+	}
 
 	if tx.IsCoinbase() {
 		if len(tx.Outputs) != 1 {
@@ -106,10 +255,23 @@ func (tx *Transaction) Validate() error {
 		return fmt.Errorf("transaction must have at least one input")
 	}
 	
+	if tx.WitnessCommitment != "" {
+		return fmt.Errorf("only coinbase transactions may carry a witness commitment")
+	}
+	
 	if len(tx.Outputs) == 0 {
 		return fmt.Errorf("transaction must have at least one output")
 	}
 	
+	for i, input := range tx.Inputs {
+		if len(input.UnlockingScript) > MaxScriptSize {
+			return fmt.Errorf("input %d unlocking script is %d bytes, limit is %d", i, len(input.UnlockingScript), MaxScriptSize)
+		}
+		if !validSequence(int64(input.Sequence)) {
+			return fmt.Errorf("input %d sequence %#x sets undefined bits", i, input.Sequence)
+		}
+	}
+	
 	for _, output := range tx.Outputs {
 		if output.Value <= 0 {
 			return fmt.Errorf("output value must be positive")
@@ -119,6 +281,14 @@ func (tx *Transaction) Validate() error {
 	return nil
 }
 
+
+// GetSize returns the length of the binary encoding, which size limits and
+// fee rates are measured on.
+func (tx *Transaction) GetSize() int {
+	data, _ := tx.SerializeBinary()
+	return len(data)
+}
+
 func (tx *Transaction) Serialize() ([]byte, error) {
 	return json.Marshal(tx)
 }
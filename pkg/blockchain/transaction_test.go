@@ -0,0 +1,437 @@
+package blockchain
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGetFee(t *testing.T) {
+	view := testView{
+		{TxID: "aa", Index: 0}: {OutPoint: OutPoint{TxID: "aa", Index: 0}, Value: 30},
+		{TxID: "aa", Index: 1}: {OutPoint: OutPoint{TxID: "aa", Index: 1}, Value: 20},
+	}
+
+	tests := []struct {
+		name      string
+		inputs    []OutPoint
+		outputs   []int64
+		wantInput int64
+		wantFee   int64
+		wantErr   bool
+	}{
+		{name: "one input", inputs: []OutPoint{{"aa", 0}}, outputs: []int64{25}, wantInput: 30, wantFee: 5},
+		{name: "two inputs", inputs: []OutPoint{{"aa", 0}, {"aa", 1}}, outputs: []int64{25, 20}, wantInput: 50, wantFee: 5},
+		{name: "no fee", inputs: []OutPoint{{"aa", 1}}, outputs: []int64{20}, wantInput: 20},
+		{name: "outputs over inputs", inputs: []OutPoint{{"aa", 1}}, outputs: []int64{21}, wantInput: 20, wantFee: -1},
+		{name: "coinbase", outputs: []int64{50}},
+		{name: "missing input", inputs: []OutPoint{{"aa", 0}, {"aa", 2}}, outputs: []int64{1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inputs []TxInput
+			for _, op := range tt.inputs {
+				inputs = append(inputs, TxInput{TxID: op.TxID, OutputIndex: op.Index})
+			}
+			var outputs []TxOutput
+			for _, value := range tt.outputs {
+				outputs = append(outputs, TxOutput{Value: value, Address: "bob"})
+			}
+			tx := NewTransaction(inputs, outputs)
+
+			totalInput, err := tx.GetTotalInput(view)
+			fee, feeErr := tx.GetFee(view)
+			if tt.wantErr {
+				var ruleErr RuleError
+				if !errors.As(err, &ruleErr) || ruleErr.Code != ErrMissingInput {
+					t.Errorf("GetTotalInput = %v, want %s", err, ErrMissingInput)
+				}
+				if !errors.As(feeErr, &ruleErr) || ruleErr.Code != ErrMissingInput {
+					t.Errorf("GetFee = %v, want %s", feeErr, ErrMissingInput)
+				}
+				return
+			}
+			if err != nil || feeErr != nil {
+				t.Fatalf("GetTotalInput = %v, GetFee = %v, want nil", err, feeErr)
+			}
+
+			if totalInput != tt.wantInput {
+				t.Errorf("GetTotalInput = %d, want %d", totalInput, tt.wantInput)
+			}
+			if fee != tt.wantFee {
+				t.Errorf("GetFee = %d, want %d", fee, tt.wantFee)
+			}
+		})
+	}
+}
+
+func TestGetTransactionDetails(t *testing.T) {
+	bc, _ := newTestChain(t)
+	alice := newTestKey(t)
+	bob := newTestKey(t)
+
+	funded, err := bc.MineBlock(alice.address, nil)
+	if err != nil {
+		t.Fatalf("MineBlock: %v", err)
+	}
+	coin := output(&funded.Transactions[0], 0)
+
+	const fee = 1000
+	tx := NewTransaction(
+		[]TxInput{{TxID: coin.OutPoint.TxID, OutputIndex: coin.OutPoint.Index}},
+		[]TxOutput{{Value: 1000000, Address: bob.address}, {Value: coin.Value - 1000000 - fee, Address: alice.address}},
+	)
+	alice.signInput(t, tx, 0, coin)
+	tx.SetID()
+
+	// A second transaction in the block spends the first's change
+	change := output(tx, 1)
+	child := NewTransaction(
+		[]TxInput{{TxID: change.OutPoint.TxID, OutputIndex: change.OutPoint.Index}},
+		[]TxOutput{{Value: change.Value - fee, Address: bob.address}},
+	)
+	alice.signInput(t, child, 0, change)
+	child.SetID()
+
+	block, err := bc.MineBlock(alice.address, []Transaction{*tx, *child})
+	if err != nil {
+		t.Fatalf("MineBlock: %v", err)
+	}
+
+	// The spent output has left the UTXO set but still resolves
+	details, err := bc.GetTransactionDetails(tx.ID)
+	if err != nil {
+		t.Fatalf("GetTransactionDetails: %v", err)
+	}
+	if details.BlockHash != block.Header.Hash || details.BlockHeight != block.Header.Height {
+		t.Errorf("confirmed in %s at %d, want %s at %d", details.BlockHash, details.BlockHeight, block.Header.Hash, block.Header.Height)
+	}
+	if details.TotalInput != coin.Value || details.TotalOutput != coin.Value-fee || details.Fee != fee {
+		t.Errorf("input %d, output %d, fee %d, want %d, %d, %d", details.TotalInput, details.TotalOutput, details.Fee, coin.Value, coin.Value-fee, fee)
+	}
+
+	details, err = bc.GetTransactionDetails(child.ID)
+	if err != nil {
+		t.Fatalf("GetTransactionDetails(child): %v", err)
+	}
+	if details.TotalInput != change.Value || details.Fee != fee {
+		t.Errorf("child input %d, fee %d, want %d, %d", details.TotalInput, details.Fee, change.Value, fee)
+	}
+
+	details, err = bc.GetTransactionDetails(block.Transactions[0].ID)
+	if err != nil {
+		t.Fatalf("GetTransactionDetails(coinbase): %v", err)
+	}
+	if details.TotalInput != 0 || details.Fee != 0 {
+		t.Errorf("coinbase input %d, fee %d, want 0, 0", details.TotalInput, details.Fee)
+	}
+
+	// The block's coinbase claims both fees
+	subsidy := CalcBlockSubsidy(block.Header.Height, bc.params)
+	if got := block.Transactions[0].GetTotalOutput(); got != subsidy+2*fee {
+		t.Errorf("coinbase pays %d, want subsidy plus fees %d", got, subsidy+2*fee)
+	}
+
+	if _, err := bc.GetTransactionDetails("missing"); err == nil {
+		t.Error("GetTransactionDetails found a transaction that was never confirmed")
+	}
+}
+
+func TestTransactionIDIgnoresUnlockingData(t *testing.T) {
+	bc, _ := newTestChain(t)
+	alice := newTestKey(t)
+	mallory := newTestKey(t)
+	prev := fund(bc, alice.address, 50)
+
+	tx := NewTransaction([]TxInput{{TxID: prev.ID, OutputIndex: 0}}, []TxOutput{{Value: 50, Address: "bob"}})
+	unsignedID := tx.ID
+
+	alice.signInput(t, tx, 0, output(prev, 0))
+	if tx.ID != unsignedID {
+		t.Errorf("signing changed the ID from %s to %s", unsignedID, tx.ID)
+	}
+	signedWitness := tx.WitnessHash()
+	if signedWitness == tx.ID {
+		t.Error("witness hash of a signed transaction equals its ID")
+	}
+
+	// Swapping the unlocking data for another key's keeps the ID but not the
+	// witness hash
+	mallory.signInput(t, tx, 0, output(prev, 0))
+	if tx.ID != unsignedID {
+		t.Errorf("re-signing changed the ID from %s to %s", unsignedID, tx.ID)
+	}
+	if tx.WitnessHash() == signedWitness {
+		t.Error("re-signing left the witness hash unchanged")
+	}
+	if err := tx.Validate(); err != nil {
+		t.Errorf("Validate after re-signing = %v, want nil", err)
+	}
+
+	tx.Outputs[0].Value = 49
+	tx.SetID()
+	if tx.ID == unsignedID {
+		t.Error("changing an output left the ID unchanged")
+	}
+}
+
+func TestValidateWitnessCommitment(t *testing.T) {
+	bc, _ := newTestChain(t)
+	alice := newTestKey(t)
+	mallory := newTestKey(t)
+	prev := fund(bc, alice.address, 50)
+	genesis := bc.GetLatestBlock()
+
+	// block returns a block on genesis holding a spend of prev signed by alice
+	block := func() *Block {
+		spend := NewTransaction([]TxInput{{TxID: prev.ID, OutputIndex: 0}}, []TxOutput{{Value: 50, Address: "bob"}})
+		alice.signInput(t, spend, 0, output(prev, 0))
+		return childBlock(genesis, alice.address, 50, *spend)
+	}
+
+	// remine recomputes the merkle root and proof of work after a change to a
+	// transaction ID
+	remine := func(b *Block) {
+		b.Header.MerkleRoot = b.calculateMerkleRoot()
+		b.Mine(b.Header.Difficulty)
+	}
+
+	tests := []struct {
+		name    string
+		block   func() *Block
+		wantErr bool
+	}{
+		{
+			name:  "committed spend",
+			block: block,
+		},
+		{
+			name: "coinbase only",
+			block: func() *Block {
+				return childBlock(genesis, alice.address, 50)
+			},
+		},
+		{
+			name: "signature swapped after mining",
+			block: func() *Block {
+				b := block()
+				mallory.signInput(t, &b.Transactions[1], 0, output(prev, 0))
+				return b
+			},
+			wantErr: true,
+		},
+		{
+			name: "commitment missing",
+			block: func() *Block {
+				b := block()
+				b.Transactions[0].WitnessCommitment = ""
+				b.Transactions[0].SetID()
+				remine(b)
+				return b
+			},
+			wantErr: true,
+		},
+		{
+			name: "commitment on a coinbase-only block",
+			block: func() *Block {
+				b := childBlock(genesis, alice.address, 50)
+				b.Transactions[0].WitnessCommitment = strings.Repeat("f", 64)
+				b.Transactions[0].SetID()
+				remine(b)
+				return b
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.block()
+			if got := b.calculateMerkleRoot(); got != b.Header.MerkleRoot {
+				t.Fatalf("merkle root %s does not match header %s", got, b.Header.MerkleRoot)
+			}
+
+			err := b.Validate(genesis)
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("Validate = %v, want nil", err)
+				}
+				return
+			}
+
+			var ruleErr RuleError
+			if !errors.As(err, &ruleErr) || ruleErr.Code != ErrBadWitnessCommitment {
+				t.Errorf("Validate = %v, want %s", err, ErrBadWitnessCommitment)
+			}
+		})
+	}
+}
+
+func TestTransactionValidateLimits(t *testing.T) {
+	// transaction returns a transaction with the given number of inputs and
+	// outputs, each output paying address
+	transaction := func(inputs, outputs int, address string) *Transaction {
+		tx := &Transaction{Inputs: make([]TxInput, inputs), Outputs: make([]TxOutput, outputs)}
+		for i := range tx.Inputs {
+			tx.Inputs[i] = TxInput{TxID: zeroHash, OutputIndex: i}
+		}
+		for i := range tx.Outputs {
+			tx.Outputs[i] = TxOutput{Value: 1, Address: address}
+		}
+		tx.SetID()
+		return tx
+	}
+
+	tests := []struct {
+		name     string
+		tx       *Transaction
+		wantCode ErrorCode
+		wantErr  bool
+	}{
+		{name: "inputs at the limit", tx: transaction(MaxTxInputs, 1, "bob")},
+		{name: "too many inputs", tx: transaction(MaxTxInputs+1, 1, "bob"), wantCode: ErrTooManyInputs, wantErr: true},
+		{name: "outputs at the limit", tx: transaction(1, MaxTxOutputs, "bob")},
+		{name: "too many outputs", tx: transaction(1, MaxTxOutputs+1, "bob"), wantCode: ErrTooManyOutputs, wantErr: true},
+		{name: "too big", tx: transaction(1, 1, strings.Repeat("b", MaxTransactionSize)), wantCode: ErrTxTooBig, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.tx.Validate()
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("Validate = %v, want nil", err)
+				}
+				return
+			}
+
+			var ruleErr RuleError
+			if !errors.As(err, &ruleErr) || ruleErr.Code != tt.wantCode {
+				t.Errorf("Validate = %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestTransactionValueBounds(t *testing.T) {
+	prev := strings.Repeat("a", 64)
+	view := testView{
+		{TxID: prev, Index: 0}: {OutPoint: OutPoint{TxID: prev, Index: 0}, Value: MaxMoney},
+		{TxID: prev, Index: 1}: {OutPoint: OutPoint{TxID: prev, Index: 1}, Value: 1},
+		{TxID: prev, Index: 2}: {OutPoint: OutPoint{TxID: prev, Index: 2}, Value: MaxMoney + 1},
+	}
+
+	tests := []struct {
+		name     string
+		inputs   []OutPoint
+		outputs  []int64
+		wantCode ErrorCode // From GetFee, and from Validate for ErrBadOutputValue
+		wantErr  bool
+	}{
+		{name: "output of MaxMoney", inputs: []OutPoint{{prev, 0}}, outputs: []int64{MaxMoney}},
+		{name: "negative output", inputs: []OutPoint{{prev, 1}}, outputs: []int64{-1}, wantCode: ErrBadOutputValue, wantErr: true},
+		{name: "output over MaxMoney", inputs: []OutPoint{{prev, 0}}, outputs: []int64{MaxMoney + 1}, wantCode: ErrBadOutputValue, wantErr: true},
+		{name: "outputs totalling over MaxMoney", inputs: []OutPoint{{prev, 0}}, outputs: []int64{MaxMoney, 1}, wantCode: ErrBadOutputValue, wantErr: true},
+		{name: "input over MaxMoney", inputs: []OutPoint{{prev, 2}}, outputs: []int64{1}, wantCode: ErrBadInputValue, wantErr: true},
+		{name: "inputs totalling over MaxMoney", inputs: []OutPoint{{prev, 0}, {prev, 1}}, outputs: []int64{1}, wantCode: ErrBadInputValue, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inputs []TxInput
+			for _, op := range tt.inputs {
+				inputs = append(inputs, TxInput{TxID: op.TxID, OutputIndex: op.Index})
+			}
+			var outputs []TxOutput
+			for _, value := range tt.outputs {
+				outputs = append(outputs, TxOutput{Value: value, Address: "bob"})
+			}
+			tx := NewTransaction(inputs, outputs)
+
+			var ruleErr RuleError
+			err := tx.Validate()
+			if tt.wantCode == ErrBadOutputValue {
+				if !errors.As(err, &ruleErr) || ruleErr.Code != tt.wantCode {
+					t.Errorf("Validate = %v, want %s", err, tt.wantCode)
+				}
+			} else if err != nil {
+				t.Errorf("Validate = %v, want nil", err)
+			}
+
+			_, err = tx.GetFee(view)
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("GetFee = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.As(err, &ruleErr) || ruleErr.Code != tt.wantCode {
+				t.Errorf("GetFee = %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestValidateTransactionsBoundsFees(t *testing.T) {
+	bc, _ := newTestChain(t)
+	funding := fund(bc, "alice", MaxMoney, MaxMoney)
+
+	// Each transaction's fee is within MaxMoney, their sum is not
+	block := &Block{
+		Header:       BlockHeader{Height: 2},
+		Transactions: []Transaction{*NewCoinbaseTransaction("alice", 50, 2)},
+	}
+	for i := range funding.Outputs {
+		tx := NewTransaction([]TxInput{{TxID: funding.ID, OutputIndex: i}}, []TxOutput{{Value: 1, Address: "bob"}})
+		block.Transactions = append(block.Transactions, *tx)
+	}
+
+	var ruleErr RuleError
+	if err := bc.validateTransactions(block, false); !errors.As(err, &ruleErr) || ruleErr.Code != ErrBadInputValue {
+		t.Errorf("validateTransactions = %v, want %s", err, ErrBadInputValue)
+	}
+}
+
+func TestGetTransactionProof(t *testing.T) {
+	bc, _ := newTestChain(t)
+	alice := newTestKey(t)
+	mineBlocks(t, bc, alice.address, 1)
+	prev := fund(bc, alice.address, 5000, 6000, 7000)
+
+	var spends []Transaction
+	for i := range prev.Outputs {
+		tx := NewTransaction([]TxInput{{TxID: prev.ID, OutputIndex: i}}, []TxOutput{{Value: prev.Outputs[i].Value, Address: alice.address}})
+		alice.signInput(t, tx, 0, output(prev, i))
+		spends = append(spends, *tx)
+	}
+	block, err := bc.MineBlock(alice.address, spends)
+	if err != nil {
+		t.Fatalf("MineBlock: %v", err)
+	}
+	genesis := bc.GetAllBlocks()[0]
+
+	for _, tx := range block.Transactions {
+		proof, err := bc.GetTransactionProof(tx.ID)
+		if err != nil {
+			t.Fatalf("GetTransactionProof(%s): %v", tx.ID, err)
+		}
+		if proof.BlockHash != block.Header.Hash || proof.MerkleRoot != block.Header.MerkleRoot {
+			t.Errorf("proof for %s is against block %s root %s, want %s root %s", tx.ID, proof.BlockHash, proof.MerkleRoot, block.Header.Hash, block.Header.MerkleRoot)
+		}
+
+		if !VerifyTransactionProof(&block.Header, tx.ID, proof.Proof) {
+			t.Errorf("proof for %s does not verify against its block", tx.ID)
+		}
+		if VerifyTransactionProof(&genesis.Header, tx.ID, proof.Proof) {
+			t.Errorf("proof for %s verifies against the genesis block", tx.ID)
+		}
+		if VerifyTransactionProof(&block.Header, prev.ID, proof.Proof) {
+			t.Errorf("proof for %s verifies another transaction", tx.ID)
+		}
+	}
+
+	if _, err := bc.GetTransactionProof(prev.ID); err == nil {
+		t.Error("GetTransactionProof proved a transaction that is in no block")
+	}
+}
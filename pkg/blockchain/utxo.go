@@ -0,0 +1,168 @@
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+)
+
+type OutPoint struct {
+	TxID  string `json:"tx_id"`
+	Index int    `json:"output_index"`
+}
+
+func (op OutPoint) String() string {
+	return fmt.Sprintf("%s:%d", op.TxID, op.Index)
+}
+
+type UTXO struct {
+	OutPoint      OutPoint `json:"outpoint"`
+	Value         int64    `json:"value"`
+	Address       string   `json:"address,omitempty"`
+	LockingScript Script   `json:"locking_script,omitempty"`
+	Height        int64    `json:"height"`
+	IsCoinbase    bool     `json:"is_coinbase"`
+}
+
+// IsMature reports whether the output may be spent by a transaction in a block
+// at spendHeight. Only coinbase outputs are subject to maturity.
+func (u *UTXO) IsMature(spendHeight, maturity int64) bool {
+	return !u.IsCoinbase || spendHeight-u.Height >= maturity
+}
+
+// UTXOView resolves outpoints to the outputs they reference.
+type UTXOView interface {
+	Get(op OutPoint) (*UTXO, bool)
+}
+
+// UTXOSet indexes unspent outputs by outpoint, with a secondary index by
+// address so balance and coin lookups don't scan the whole set.
+type UTXOSet struct {
+	entries   map[OutPoint]*UTXO
+	byAddress map[string]map[OutPoint]struct{}
+}
+
+func NewUTXOSet() *UTXOSet {
+	return &UTXOSet{
+		entries:   make(map[OutPoint]*UTXO),
+		byAddress: make(map[string]map[OutPoint]struct{}),
+	}
+}
+
+func (s *UTXOSet) Get(op OutPoint) (*UTXO, bool) {
+	entry, exists := s.entries[op]
+	return entry, exists
+}
+
+func (s *UTXOSet) Add(entry *UTXO) {
+	if old, exists := s.entries[entry.OutPoint]; exists {
+		s.removeFromAddress(old)
+	}
+
+	s.entries[entry.OutPoint] = entry
+
+	// Outputs locked by a script rather than an address are not indexed
+	if entry.Address == "" {
+		return
+	}
+
+	outpoints, exists := s.byAddress[entry.Address]
+	if !exists {
+		outpoints = make(map[OutPoint]struct{})
+		s.byAddress[entry.Address] = outpoints
+	}
+	outpoints[entry.OutPoint] = struct{}{}
+}
+
+func (s *UTXOSet) Spend(op OutPoint) (*UTXO, bool) {
+	entry, exists := s.entries[op]
+	if !exists {
+		return nil, false
+	}
+
+	delete(s.entries, op)
+	s.removeFromAddress(entry)
+
+	return entry, true
+}
+
+func (s *UTXOSet) removeFromAddress(entry *UTXO) {
+	outpoints, exists := s.byAddress[entry.Address]
+	if !exists {
+		return
+	}
+
+	delete(outpoints, entry.OutPoint)
+	if len(outpoints) == 0 {
+		delete(s.byAddress, entry.Address)
+	}
+}
+
+// FindByAddress returns copies of the address's unspent outputs, oldest first,
+// so callers get a stable order for coin selection and API listings.
+func (s *UTXOSet) FindByAddress(address string) []UTXO {
+	outpoints := s.byAddress[address]
+
+	result := make([]UTXO, 0, len(outpoints))
+	for op := range outpoints {
+		result = append(result, *s.entries[op])
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Height != result[j].Height {
+			return result[i].Height < result[j].Height
+		}
+		if result[i].OutPoint.TxID != result[j].OutPoint.TxID {
+			return result[i].OutPoint.TxID < result[j].OutPoint.TxID
+		}
+		return result[i].OutPoint.Index < result[j].OutPoint.Index
+	})
+
+	return result
+}
+
+func (s *UTXOSet) Balance(address string) int64 {
+	var balance int64
+	for op := range s.byAddress[address] {
+		balance += s.entries[op].Value
+	}
+	return balance
+}
+
+func (s *UTXOSet) Size() int {
+	return len(s.entries)
+}
+
+// blockView layers outputs created earlier in a block over the UTXO set, so
+// transactions can spend outputs of transactions before them in the same block.
+type blockView struct {
+	base    *UTXOSet
+	created map[OutPoint]*UTXO
+}
+
+func newBlockView(base *UTXOSet) *blockView {
+	return &blockView{
+		base:    base,
+		created: make(map[OutPoint]*UTXO),
+	}
+}
+
+func (v *blockView) Get(op OutPoint) (*UTXO, bool) {
+	if entry, exists := v.created[op]; exists {
+		return entry, true
+	}
+	return v.base.Get(op)
+}
+
+func (v *blockView) addOutputs(tx *Transaction, height int64) {
+	for i, output := range tx.Outputs {
+		op := OutPoint{TxID: tx.ID, Index: i}
+		v.created[op] = &UTXO{
+			OutPoint:      op,
+			Value:         output.Value,
+			Address:       output.Address,
+			LockingScript: output.LockingScript,
+			Height:        height,
+			IsCoinbase:    tx.IsCoinbase(),
+		}
+	}
+}
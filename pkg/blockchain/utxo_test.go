@@ -0,0 +1,111 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+func TestUTXOSet(t *testing.T) {
+	set := NewUTXOSet()
+	entries := []*UTXO{
+		{OutPoint: OutPoint{TxID: "bb", Index: 0}, Value: 30, Address: "alice", Height: 2},
+		{OutPoint: OutPoint{TxID: "aa", Index: 1}, Value: 20, Address: "alice", Height: 2},
+		{OutPoint: OutPoint{TxID: "cc", Index: 0}, Value: 10, Address: "alice", Height: 1},
+		{OutPoint: OutPoint{TxID: "aa", Index: 0}, Value: 5, Address: "bob", Height: 2},
+	}
+	for _, entry := range entries {
+		set.Add(entry)
+	}
+
+	if set.Size() != 4 {
+		t.Errorf("Size = %d, want 4", set.Size())
+	}
+	if got := set.Balance("alice"); got != 60 {
+		t.Errorf("Balance(alice) = %d, want 60", got)
+	}
+
+	// Oldest first, then by outpoint
+	want := []OutPoint{{"cc", 0}, {"aa", 1}, {"bb", 0}}
+	coins := set.FindByAddress("alice")
+	if len(coins) != len(want) {
+		t.Fatalf("FindByAddress returned %d coins, want %d", len(coins), len(want))
+	}
+	for i, coin := range coins {
+		if coin.OutPoint != want[i] {
+			t.Errorf("coin %d = %s, want %s", i, coin.OutPoint, want[i])
+		}
+	}
+
+	// Outputs of the same transaction are separate coins
+	spent, ok := set.Spend(OutPoint{TxID: "aa", Index: 1})
+	if !ok || spent.Value != 20 {
+		t.Fatalf("Spend(aa:1) = %v, %v, want the 20 output", spent, ok)
+	}
+	if _, ok := set.Spend(OutPoint{TxID: "aa", Index: 1}); ok {
+		t.Error("Spend succeeded twice for the same outpoint")
+	}
+	if _, ok := set.Get(OutPoint{TxID: "aa", Index: 0}); !ok {
+		t.Error("Spend(aa:1) removed aa:0")
+	}
+	if got := set.Balance("alice"); got != 40 {
+		t.Errorf("Balance(alice) after spend = %d, want 40", got)
+	}
+	if got := set.Balance("bob"); got != 5 {
+		t.Errorf("Balance(bob) after spend = %d, want 5", got)
+	}
+
+	// Replacing an entry moves it to its new address
+	set.Add(&UTXO{OutPoint: OutPoint{TxID: "aa", Index: 0}, Value: 5, Address: "carol", Height: 3})
+	if got := set.Balance("bob"); got != 0 {
+		t.Errorf("Balance(bob) after replace = %d, want 0", got)
+	}
+	if got := set.Balance("carol"); got != 5 {
+		t.Errorf("Balance(carol) after replace = %d, want 5", got)
+	}
+	if set.Size() != 3 {
+		t.Errorf("Size after replace = %d, want 3", set.Size())
+	}
+}
+
+func TestUpdateUTXOSetSpendsOutpoints(t *testing.T) {
+	bc := NewBlockchain()
+
+	funding := NewTransaction(nil, []TxOutput{
+		{Value: 50, Address: "alice"},
+		{Value: 70, Address: "alice"},
+	})
+	bc.updateUTXOSet(&Block{Header: BlockHeader{Height: 1}, Transactions: []Transaction{*funding}})
+
+	// Spending the second output must leave the first, even though both pay
+	// the same address
+	spend := NewTransaction(
+		[]TxInput{{TxID: funding.ID, OutputIndex: 1}},
+		[]TxOutput{{Value: 70, Address: "bob"}},
+	)
+	bc.updateUTXOSet(&Block{Header: BlockHeader{Height: 2}, Transactions: []Transaction{*spend}})
+
+	if _, err := bc.GetUTXO(funding.ID, 1); err == nil {
+		t.Error("spent output still in the UTXO set")
+	}
+	entry, err := bc.GetUTXO(funding.ID, 0)
+	if err != nil {
+		t.Fatalf("unspent output missing: %v", err)
+	}
+	if entry.Value != 50 || entry.Height != 1 {
+		t.Errorf("unspent output = %+v, want value 50 at height 1", entry)
+	}
+
+	entry, err = bc.GetUTXO(spend.ID, 0)
+	if err != nil {
+		t.Fatalf("new output missing: %v", err)
+	}
+	if entry.Address != "bob" || entry.Height != 2 {
+		t.Errorf("new output = %+v, want bob's at height 2", entry)
+	}
+
+	if got := bc.GetBalance("alice"); got != 50 {
+		t.Errorf("GetBalance(alice) = %d, want 50", got)
+	}
+	if got := bc.GetBalance("bob"); got != 70 {
+		t.Errorf("GetBalance(bob) = %d, want 70", got)
+	}
+}
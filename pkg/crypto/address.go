@@ -10,14 +10,34 @@ import (
 const (
 	AddressVersionMainNet = 0x00 
 	AddressVersionTestNet = 0x6f 
+	
+	// Pay-to-script-hash addresses commit to the hash of a script, such as
+	// a multisig script, rather than of a public key
+	ScriptAddressVersionMainNet = 0x05
+	ScriptAddressVersionTestNet = 0xc4
 )
 
 func GenerateAddress(publicKey *ecdsa.PublicKey, version byte) string {
 
 	pubKeyBytes := compressPublicKey(publicKey)
 	
-	hash160 := Hash160(pubKeyBytes)
-	
+	return encodeAddress(Hash160(pubKeyBytes), version)
+}
+
+// GenerateScriptAddress returns the pay-to-script-hash address of a script.
+// version should be a script address version.
+func GenerateScriptAddress(script []byte, version byte) string {
+	return encodeAddress(Hash160(script), version)
+}
+
+// IsScriptAddress reports whether address is a valid pay-to-script-hash
+// address of any network.
+func IsScriptAddress(address string) bool {
+	return IsValidAddressForNetwork(address, ScriptAddressVersionMainNet) ||
+		IsValidAddressForNetwork(address, ScriptAddressVersionTestNet)
+}
+
+func encodeAddress(hash160 []byte, version byte) string {
 	versionedHash := append([]byte{version}, hash160...)
 	
 	checksum := calculateChecksum(versionedHash)
@@ -55,6 +75,8 @@ func ValidateAddress(address string) bool {
 	return true
 }
 
+// ExtractPublicKeyHash returns the hash an address commits to: of a public
+// key, or of a script for a script address.
 func ExtractPublicKeyHash(address string) ([]byte, error) {
 	if !ValidateAddress(address) {
 		return nil, fmt.Errorf("invalid address")
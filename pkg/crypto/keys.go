@@ -65,4 +65,49 @@ func (kp *KeyPair) GetPublicKeyUncompressed() string {
 	for len(x) < 32 {
 		x = append([]byte{0}, x...)
 	}
-}
\ No newline at end of file
+	for len(y) < 32 {
+		y = append([]byte{0}, y...)
+	}
+	
+	uncompressed := append([]byte{0x04}, x...)
+	uncompressed = append(uncompressed, y...)
+	return hex.EncodeToString(uncompressed)
+}
+
+// PrivateKeyFromHex restores a key pair from a private key as produced by GetPrivateKeyHex
+func PrivateKeyFromHex(privateKeyHex string) (*KeyPair, error) {
+	privateKeyBytes, err := hex.DecodeString(privateKeyHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex string: %v", err)
+	}
+	
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(privateKeyBytes)
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, fmt.Errorf("private key out of range")
+	}
+	
+	privateKey := &ecdsa.PrivateKey{D: d}
+	privateKey.PublicKey.Curve = curve
+	privateKey.PublicKey.X, privateKey.PublicKey.Y = curve.ScalarBaseMult(privateKeyBytes)
+	
+	return &KeyPair{
+		PrivateKey: privateKey,
+		PublicKey:  &privateKey.PublicKey,
+	}, nil
+}
+
+// PublicKeyFromHex parses a compressed public key as produced by GetPublicKeyHex
+func PublicKeyFromHex(publicKeyHex string) (*ecdsa.PublicKey, error) {
+	pubKeyBytes, err := hex.DecodeString(publicKeyHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex string: %v", err)
+	}
+	
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), pubKeyBytes)
+	if x == nil {
+		return nil, fmt.Errorf("invalid compressed public key")
+	}
+	
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+}
@@ -0,0 +1,544 @@
+// Package mempool holds transactions that have been accepted by the node but
+// not yet mined, so payments no longer need a block each.
+package mempool
+
+import (
+	"blockchain-node/pkg/blockchain"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default limits on the pool.
+const (
+	DefaultMaxSize = 50 * blockchain.MaxBlockSize
+	DefaultExpiry  = 72 * time.Hour
+)
+
+// Config limits what the pool holds.
+type Config struct {
+	MaxSize int           // Total bytes of the binary encoding of the transactions held
+	Expiry  time.Duration // How long a transaction may wait to be mined before it is dropped
+}
+
+// DefaultConfig returns the default limits.
+func DefaultConfig() Config {
+	return Config{
+		MaxSize: DefaultMaxSize,
+		Expiry:  DefaultExpiry,
+	}
+}
+
+// TxDesc is a transaction in the pool and what the pool learned about it on
+// acceptance.
+type TxDesc struct {
+	Tx     *blockchain.Transaction `json:"transaction"`
+	Fee    int64                   `json:"fee"`
+	Size   int                     `json:"size"`
+	Added  time.Time               `json:"added"`
+	Height int64                   `json:"height"` // Chain height when it was accepted
+
+	seq uint64 // Acceptance order
+}
+
+// FeeRate returns the fee in satoshis per byte.
+func (d *TxDesc) FeeRate() float64 {
+	return float64(d.Fee) / float64(d.Size)
+}
+
+// Mempool validates transactions against the UTXO set plus the outputs of
+// the transactions it already holds, and keeps them until they are mined,
+// conflict with a block, expire or are evicted for better-paying ones. It
+// follows the chain through Subscribe, so it must not be called with the
+// chain lock held.
+type Mempool struct {
+	chain  *blockchain.Blockchain
+	config Config
+	clock  blockchain.Clock
+
+	mutex   sync.RWMutex
+	pool    map[string]*TxDesc
+	spends  map[blockchain.OutPoint]*TxDesc // Pool transaction spending each outpoint
+	size    int
+	nextSeq uint64
+
+	disconnected []*blockchain.Block // Blocks disconnected by a reorganization still in progress, tip first
+}
+
+// New creates an empty pool for chain.
+func New(chain *blockchain.Blockchain, config Config) *Mempool {
+	m := &Mempool{
+		chain:  chain,
+		config: config,
+		clock:  blockchain.NewOffsetClock(0),
+		pool:   make(map[string]*TxDesc),
+		spends: make(map[blockchain.OutPoint]*TxDesc),
+	}
+
+	chain.Subscribe(m.handleNotification)
+	return m
+}
+
+// SetClock replaces the clock acceptance times and expiry are measured with.
+func (m *Mempool) SetClock(clock blockchain.Clock) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.clock = clock
+}
+
+// AddTransaction validates tx and adds it to the pool. Consensus failures
+// are returned as blockchain.RuleError and transactions the pool declines,
+// such as conflicts, as blockchain.PolicyError.
+func (m *Mempool) AddTransaction(tx *blockchain.Transaction) (*TxDesc, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.expire()
+	return m.addTransaction(tx)
+}
+
+func (m *Mempool) addTransaction(tx *blockchain.Transaction) (*TxDesc, error) {
+	if _, exists := m.pool[tx.ID]; exists {
+		return nil, rejectError("duplicate", "transaction %s is already in the mempool", tx.ID)
+	}
+
+	if err := tx.Validate(); err != nil {
+		var ruleErr blockchain.RuleError
+		if !errors.As(err, &ruleErr) {
+			err = blockchain.RuleError{Code: blockchain.ErrInvalidTransaction, Description: fmt.Sprintf("transaction %s is invalid: %v", tx.ID, err)}
+		}
+		return nil, err
+	}
+
+	params := m.chain.Params()
+	if err := blockchain.CheckTransactionStandard(tx, params); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[blockchain.OutPoint]bool)
+	for i, input := range tx.Inputs {
+		op := blockchain.OutPoint{TxID: input.TxID, Index: input.OutputIndex}
+		if seen[op] {
+			return nil, blockchain.RuleError{Code: blockchain.ErrDoubleSpend, Description: fmt.Sprintf("transaction %s spends %s twice", tx.ID, op)}
+		}
+		seen[op] = true
+
+		if spender, exists := m.spends[op]; exists {
+			return nil, rejectError("mempool-conflict", "transaction %s input %d spends %s, already spent by %s in the mempool", tx.ID, i, op, spender.Tx.ID)
+		}
+	}
+
+	height := m.chain.GetHeight() + 1
+	view, err := m.checkInputs(tx, height, params.CoinbaseMaturity)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, input := range tx.Inputs {
+		op := blockchain.OutPoint{TxID: input.TxID, Index: input.OutputIndex}
+		if err := blockchain.VerifyScript(tx, i, view[op]); err != nil {
+			return nil, blockchain.RuleError{Code: blockchain.ErrScriptFailed, Description: fmt.Sprintf("transaction %s input %d: %v", tx.ID, i, err)}
+		}
+	}
+
+	fee, err := tx.GetFee(view)
+	if err != nil {
+		return nil, err
+	}
+	if fee < 0 {
+		return nil, blockchain.RuleError{Code: blockchain.ErrSpendTooHigh, Description: fmt.Sprintf("transaction %s has negative fee: outputs exceed inputs by %d", tx.ID, -fee)}
+	}
+
+	desc := &TxDesc{
+		Tx:     tx,
+		Fee:    fee,
+		Size:   tx.GetSize(),
+		Added:  m.clock.Now(),
+		Height: height - 1,
+		seq:    m.nextSeq,
+	}
+
+	if err := m.makeRoom(desc); err != nil {
+		return nil, err
+	}
+
+	m.nextSeq++
+	m.pool[tx.ID] = desc
+	for _, input := range tx.Inputs {
+		m.spends[blockchain.OutPoint{TxID: input.TxID, Index: input.OutputIndex}] = desc
+	}
+	m.size += desc.Size
+
+	return desc, nil
+}
+
+// inputView holds the outputs a transaction spends, resolved up front so
+// checks against them need no locks.
+type inputView map[blockchain.OutPoint]*blockchain.UTXO
+
+func (v inputView) Get(op blockchain.OutPoint) (*blockchain.UTXO, bool) {
+	entry, exists := v[op]
+	return entry, exists
+}
+
+// fetchInputs resolves the outputs tx spends from the pool's transactions or
+// the UTXO set. Outputs of pool transactions count as created at height, the
+// height of the next block.
+func (m *Mempool) fetchInputs(tx *blockchain.Transaction, height int64) (inputView, error) {
+	view := make(inputView)
+	for i, input := range tx.Inputs {
+		op := blockchain.OutPoint{TxID: input.TxID, Index: input.OutputIndex}
+
+		if parent, exists := m.pool[input.TxID]; exists {
+			if input.OutputIndex >= len(parent.Tx.Outputs) {
+				return nil, missingInput(tx, i, op)
+			}
+
+			output := parent.Tx.Outputs[input.OutputIndex]
+			view[op] = &blockchain.UTXO{
+				OutPoint:      op,
+				Value:         output.Value,
+				Address:       output.Address,
+				LockingScript: output.LockingScript,
+				Height:        height,
+			}
+			continue
+		}
+
+		entry, err := m.chain.GetUTXO(input.TxID, input.OutputIndex)
+		if err != nil {
+			return nil, missingInput(tx, i, op)
+		}
+		view[op] = entry
+	}
+	return view, nil
+}
+
+func missingInput(tx *blockchain.Transaction, i int, op blockchain.OutPoint) error {
+	return blockchain.RuleError{Code: blockchain.ErrMissingInput, Description: fmt.Sprintf("transaction %s input %d references missing or spent output %s", tx.ID, i, op)}
+}
+
+// makeRoom evicts the transactions with the lowest fee rates, each with its
+// descendants, until desc fits within MaxSize. Only transactions paying a
+// lower fee rate than desc are chosen, and never desc's own ancestors; if
+// that does not free enough space desc is rejected and nothing is evicted.
+func (m *Mempool) makeRoom(desc *TxDesc) error {
+	if m.size+desc.Size <= m.config.MaxSize {
+		return nil
+	}
+
+	ancestors := m.ancestors(desc.Tx)
+	candidates := make([]*TxDesc, 0, len(m.pool))
+	for _, candidate := range m.pool {
+		if !ancestors[candidate.Tx.ID] {
+			candidates = append(candidates, candidate)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return lowerFeeRate(candidates[i], candidates[j])
+	})
+
+	evict := make(map[string]*TxDesc)
+	freed := 0
+	for _, candidate := range candidates {
+		if m.size-freed+desc.Size <= m.config.MaxSize {
+			break
+		}
+		if evict[candidate.Tx.ID] != nil {
+			continue
+		}
+		if !lowerFeeRate(candidate, desc) {
+			break
+		}
+
+		for _, descendant := range m.descendants(candidate) {
+			if evict[descendant.Tx.ID] == nil {
+				evict[descendant.Tx.ID] = descendant
+				freed += descendant.Size
+			}
+		}
+	}
+
+	if m.size-freed+desc.Size > m.config.MaxSize {
+		return rejectError("mempool-full", "mempool is full and transaction %s's fee rate of %.2f satoshis per byte is not enough to replace others", desc.Tx.ID, desc.FeeRate())
+	}
+
+	for _, evicted := range evict {
+		m.remove(evicted)
+	}
+	return nil
+}
+
+// lowerFeeRate orders by fee rate, breaking ties by acceptance so the newer
+// transaction comes first.
+func lowerFeeRate(a, b *TxDesc) bool {
+	if a.FeeRate() != b.FeeRate() {
+		return a.FeeRate() < b.FeeRate()
+	}
+	return a.seq > b.seq
+}
+
+// ancestors returns the IDs of the pool transactions tx spends from,
+// directly or through others.
+func (m *Mempool) ancestors(tx *blockchain.Transaction) map[string]bool {
+	ancestors := make(map[string]bool)
+	queue := []*blockchain.Transaction{tx}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, input := range current.Inputs {
+			if parent, exists := m.pool[input.TxID]; exists && !ancestors[input.TxID] {
+				ancestors[input.TxID] = true
+				queue = append(queue, parent.Tx)
+			}
+		}
+	}
+	return ancestors
+}
+
+// descendants returns desc and every pool transaction spending from it,
+// directly or through others, parents before children.
+func (m *Mempool) descendants(desc *TxDesc) []*TxDesc {
+	result := []*TxDesc{desc}
+	seen := map[string]bool{desc.Tx.ID: true}
+	for i := 0; i < len(result); i++ {
+		tx := result[i].Tx
+		for j := range tx.Outputs {
+			child, exists := m.spends[blockchain.OutPoint{TxID: tx.ID, Index: j}]
+			if exists && !seen[child.Tx.ID] {
+				seen[child.Tx.ID] = true
+				result = append(result, child)
+			}
+		}
+	}
+	return result
+}
+
+// remove takes a single transaction out of the pool. Its children stay and
+// must either be removed too or have its outputs confirmed.
+func (m *Mempool) remove(desc *TxDesc) {
+	if _, exists := m.pool[desc.Tx.ID]; !exists {
+		return
+	}
+
+	delete(m.pool, desc.Tx.ID)
+	for _, input := range desc.Tx.Inputs {
+		delete(m.spends, blockchain.OutPoint{TxID: input.TxID, Index: input.OutputIndex})
+	}
+	m.size -= desc.Size
+}
+
+func (m *Mempool) removeWithDescendants(desc *TxDesc) {
+	for _, descendant := range m.descendants(desc) {
+		m.remove(descendant)
+	}
+}
+
+// expire drops transactions that have waited longer than Expiry, with their
+// descendants, which cannot be mined without them.
+func (m *Mempool) expire() {
+	now := m.clock.Now()
+	for _, desc := range m.pool {
+		if now.Sub(desc.Added) > m.config.Expiry {
+			m.removeWithDescendants(desc)
+		}
+	}
+}
+
+func (m *Mempool) handleNotification(notification blockchain.Notification) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	switch notification.Type {
+	case blockchain.NTBlockConnected:
+		m.restoreDisconnected()
+		m.blockConnected(notification.Block)
+	case blockchain.NTBlockDisconnected:
+		// Notifications arrive once the whole reorganization is done, so
+		// the disconnected transactions are checked against the chain it
+		// ends on when the first block of the new branch is reported.
+		m.disconnected = append(m.disconnected, notification.Block)
+	}
+
+	m.expire()
+}
+
+// blockConnected removes the block's transactions, whose children in the
+// pool now spend confirmed outputs, and every pool transaction spending an
+// output the block spent, with its descendants: those double spends can no
+// longer be mined.
+func (m *Mempool) blockConnected(block *blockchain.Block) {
+	for _, tx := range block.Transactions {
+		if desc, exists := m.pool[tx.ID]; exists {
+			m.remove(desc)
+		}
+
+		for _, input := range tx.Inputs {
+			if spender, exists := m.spends[blockchain.OutPoint{TxID: input.TxID, Index: input.OutputIndex}]; exists {
+				m.removeWithDescendants(spender)
+			}
+		}
+	}
+}
+
+// restoreDisconnected returns the transactions of blocks disconnected by a
+// reorganization to the pool, oldest block first so parents come back
+// before their children, unless they are invalid on the new chain or
+// already mined in it. The rest of the pool is then checked against the new
+// tip.
+func (m *Mempool) restoreDisconnected() {
+	if len(m.disconnected) == 0 {
+		return
+	}
+
+	for i := len(m.disconnected) - 1; i >= 0; i-- {
+		for j := range m.disconnected[i].Transactions {
+			if tx := &m.disconnected[i].Transactions[j]; !tx.IsCoinbase() {
+				m.addTransaction(tx)
+			}
+		}
+	}
+	m.disconnected = nil
+
+	m.revalidate()
+}
+
+// revalidate removes, with their descendants, pool transactions the current
+// tip no longer allows: those spending outputs that exist neither in the
+// pool nor the UTXO set, coinbase outputs that are immature again, or that
+// fail their lock time or sequence locks. A reorganization can move the tip
+// to a lower height or median time past than they were accepted at.
+func (m *Mempool) revalidate() {
+	params := m.chain.Params()
+	height := m.chain.GetHeight() + 1
+
+	for _, desc := range m.descs() {
+		if _, exists := m.pool[desc.Tx.ID]; !exists {
+			continue
+		}
+
+		if _, err := m.checkInputs(desc.Tx, height, params.CoinbaseMaturity); err != nil {
+			m.removeWithDescendants(desc)
+		}
+	}
+}
+
+// checkInputs resolves the outputs tx spends and checks that they are
+// mature and its locks are satisfied in a block at height on the current
+// tip. Scripts are left to the caller, since a reorganization cannot change
+// their outcome.
+func (m *Mempool) checkInputs(tx *blockchain.Transaction, height, coinbaseMaturity int64) (inputView, error) {
+	view, err := m.fetchInputs(tx, height)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, input := range tx.Inputs {
+		op := blockchain.OutPoint{TxID: input.TxID, Index: input.OutputIndex}
+		if entry := view[op]; !entry.IsMature(height, coinbaseMaturity) {
+			return nil, blockchain.RuleError{Code: blockchain.ErrImmatureSpend, Description: fmt.Sprintf("transaction %s input %d spends coinbase output %s from height %d, which needs %d confirmations", tx.ID, i, op, entry.Height, coinbaseMaturity)}
+		}
+	}
+
+	if err := m.chain.CheckTransactionLocks(tx, view); err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+// Transactions returns the pool's transactions in the order they were
+// accepted, except that every transaction comes after the pool transactions
+// it spends from. A reorganization can return a parent to the pool after
+// its children.
+func (m *Mempool) Transactions() []*TxDesc {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	descs := m.descs()
+	sort.Slice(descs, func(i, j int) bool {
+		return descs[i].seq < descs[j].seq
+	})
+
+	ordered := make([]*TxDesc, 0, len(descs))
+	visited := make(map[string]bool)
+	var visit func(desc *TxDesc)
+	visit = func(desc *TxDesc) {
+		if visited[desc.Tx.ID] {
+			return
+		}
+		visited[desc.Tx.ID] = true
+
+		for _, input := range desc.Tx.Inputs {
+			if parent, exists := m.pool[input.TxID]; exists {
+				visit(parent)
+			}
+		}
+		ordered = append(ordered, desc)
+	}
+	for _, desc := range descs {
+		visit(desc)
+	}
+	return ordered
+}
+
+// TxDescs returns the pool's transactions, highest fee rate first.
+func (m *Mempool) TxDescs() []*TxDesc {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	descs := m.descs()
+	sort.Slice(descs, func(i, j int) bool {
+		return lowerFeeRate(descs[j], descs[i])
+	})
+	return descs
+}
+
+func (m *Mempool) descs() []*TxDesc {
+	descs := make([]*TxDesc, 0, len(m.pool))
+	for _, desc := range m.pool {
+		descs = append(descs, desc)
+	}
+	return descs
+}
+
+// Get returns a transaction in the pool.
+func (m *Mempool) Get(txID string) (*TxDesc, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	desc, exists := m.pool[txID]
+	return desc, exists
+}
+
+// IsSpent reports whether a pool transaction spends op.
+func (m *Mempool) IsSpent(op blockchain.OutPoint) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	_, exists := m.spends[op]
+	return exists
+}
+
+// Count returns the number of transactions in the pool.
+func (m *Mempool) Count() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return len(m.pool)
+}
+
+// Size returns the total size in bytes of the transactions in the pool.
+func (m *Mempool) Size() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.size
+}
+
+func rejectError(reason string, format string, args ...interface{}) error {
+	return blockchain.PolicyError{Reason: reason, Description: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,356 @@
+package mempool
+
+import (
+	"blockchain-node/internal/testutil"
+	"blockchain-node/pkg/blockchain"
+	"blockchain-node/pkg/wallet"
+	"errors"
+	"testing"
+	"time"
+)
+
+// matureCoins mines enough blocks for n coinbase outputs paying w to
+// mature and returns them.
+func matureCoins(t *testing.T, bc *blockchain.Blockchain, w *wallet.Wallet, n int) []blockchain.UTXO {
+	t.Helper()
+
+	blocks := testutil.MineBlocks(t, bc, w.GetAddress(), int(blockchain.RegTestParams.CoinbaseMaturity)+n)
+	coins := make([]blockchain.UTXO, n)
+	for i := range coins {
+		coins[i] = testutil.Output(&blocks[i].Transactions[0], 0)
+		coins[i].Height = blocks[i].Header.Height
+		coins[i].IsCoinbase = true
+	}
+	return coins
+}
+
+func TestAddTransactionRejects(t *testing.T) {
+	bc := testutil.NewChain(t, testutil.NewClock())
+	w := testutil.NewWallet(t)
+	coins := matureCoins(t, bc, w, 2)
+
+	pool := New(bc, DefaultConfig())
+	pooled := testutil.Spend(t, w, coins[0], coins[0].Value/2, 1000, 0)
+	if _, err := pool.AddTransaction(pooled); err != nil {
+		t.Fatalf("AddTransaction: %v", err)
+	}
+
+	latest := bc.GetLatestBlock()
+	immature := testutil.Output(&latest.Transactions[0], 0)
+
+	// An output past the end of a coinbase transaction
+	missing := coins[1]
+	missing.OutPoint.Index = 1
+
+	tampered := testutil.Spend(t, w, coins[1], coins[1].Value/2, 1000, 0)
+	tampered.Outputs[0].Value--
+	tampered.SetID()
+
+	tests := []struct {
+		name       string
+		tx         *blockchain.Transaction
+		wantReason string // PolicyError reason, or empty for a RuleError
+		wantCode   blockchain.ErrorCode
+	}{
+		{"duplicate", pooled, "duplicate", 0},
+		{"spent in the pool", testutil.Spend(t, w, coins[0], coins[0].Value/4, 1000, 0), "mempool-conflict", 0},
+		{"missing input", testutil.Spend(t, w, missing, coins[1].Value/2, 1000, 0), "", blockchain.ErrMissingInput},
+		{"immature coinbase", testutil.Spend(t, w, immature, immature.Value/2, 1000, 0), "", blockchain.ErrImmatureSpend},
+		{"locked", testutil.Spend(t, w, coins[1], coins[1].Value/2, 1000, bc.GetHeight()+2), "", blockchain.ErrUnfinalizedTx},
+		{"changed after signing", tampered, "", blockchain.ErrScriptFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := pool.AddTransaction(tt.tx)
+			if tt.wantReason != "" {
+				var policyErr blockchain.PolicyError
+				if !errors.As(err, &policyErr) || policyErr.Reason != tt.wantReason {
+					t.Errorf("AddTransaction = %v, want policy error %s", err, tt.wantReason)
+				}
+				return
+			}
+
+			var ruleErr blockchain.RuleError
+			if !errors.As(err, &ruleErr) || ruleErr.Code != tt.wantCode {
+				t.Errorf("AddTransaction = %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+
+	if count := pool.Count(); count != 1 {
+		t.Errorf("pool holds %d transactions, want 1", count)
+	}
+}
+
+func TestAddTransactionEvictsLowerFeeRates(t *testing.T) {
+	tests := []struct {
+		name      string
+		fee       int64
+		wantAdded bool
+	}{
+		{"lowest fee rate", 500, false},
+		{"between the others", 3000, true},
+		{"highest fee rate", 10000, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := testutil.NewChain(t, testutil.NewClock())
+			w := testutil.NewWallet(t)
+			coins := matureCoins(t, bc, w, 3)
+
+			low := testutil.Spend(t, w, coins[0], coins[0].Value/2, 1000, 0)
+			high := testutil.Spend(t, w, coins[1], coins[1].Value/2, 5000, 0)
+			incoming := testutil.Spend(t, w, coins[2], coins[2].Value/2, tt.fee, 0)
+
+			// Room for two of the transactions, not three
+			config := DefaultConfig()
+			config.MaxSize = low.GetSize() + high.GetSize() + incoming.GetSize()/2
+			pool := New(bc, config)
+			for _, tx := range []*blockchain.Transaction{low, high} {
+				if _, err := pool.AddTransaction(tx); err != nil {
+					t.Fatalf("AddTransaction: %v", err)
+				}
+			}
+
+			_, err := pool.AddTransaction(incoming)
+			if !tt.wantAdded {
+				var policyErr blockchain.PolicyError
+				if !errors.As(err, &policyErr) || policyErr.Reason != "mempool-full" {
+					t.Errorf("AddTransaction = %v, want policy error mempool-full", err)
+				}
+				if _, exists := pool.Get(low.ID); !exists {
+					t.Error("the lowest-paying transaction was evicted for one paying less")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("AddTransaction: %v", err)
+			}
+			if _, exists := pool.Get(low.ID); exists {
+				t.Error("the lowest-paying transaction was not evicted")
+			}
+			if _, exists := pool.Get(high.ID); !exists {
+				t.Error("the highest-paying transaction was evicted")
+			}
+			if size := pool.Size(); size > config.MaxSize {
+				t.Errorf("pool holds %d bytes, limit is %d", size, config.MaxSize)
+			}
+		})
+	}
+}
+
+func TestAddTransactionEvictsDescendants(t *testing.T) {
+	bc := testutil.NewChain(t, testutil.NewClock())
+	w := testutil.NewWallet(t)
+	coins := matureCoins(t, bc, w, 2)
+
+	parent := testutil.Spend(t, w, coins[0], coins[0].Value/2, 1000, 0)
+	child := testutil.Spend(t, w, testutil.Output(parent, 0), parent.Outputs[0].Value/2, 2000, 0)
+	incoming := testutil.Spend(t, w, coins[1], coins[1].Value/2, 10000, 0)
+
+	config := DefaultConfig()
+	config.MaxSize = parent.GetSize() + child.GetSize()
+	pool := New(bc, config)
+	for _, tx := range []*blockchain.Transaction{parent, child, incoming} {
+		if _, err := pool.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction: %v", err)
+		}
+	}
+
+	// The child cannot be mined without its parent
+	for _, tx := range []*blockchain.Transaction{parent, child} {
+		if _, exists := pool.Get(tx.ID); exists {
+			t.Errorf("transaction %s was not evicted", tx.ID)
+		}
+	}
+	if count := pool.Count(); count != 1 {
+		t.Errorf("pool holds %d transactions, want 1", count)
+	}
+}
+
+func TestAddTransactionExpiresOldTransactions(t *testing.T) {
+	const expiry = time.Hour
+
+	tests := []struct {
+		name        string
+		elapsed     time.Duration
+		wantExpired bool
+	}{
+		{"before expiry", expiry - time.Second, false},
+		{"at expiry", expiry, false},
+		{"after expiry", expiry + time.Second, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := testutil.NewClock()
+			bc := testutil.NewChain(t, clock)
+			w := testutil.NewWallet(t)
+			coins := matureCoins(t, bc, w, 2)
+
+			config := DefaultConfig()
+			config.Expiry = expiry
+			pool := New(bc, config)
+			pool.SetClock(clock)
+
+			parent := testutil.Spend(t, w, coins[0], coins[0].Value/2, 1000, 0)
+			child := testutil.Spend(t, w, testutil.Output(parent, 0), parent.Outputs[0].Value/2, 1000, 0)
+			for _, tx := range []*blockchain.Transaction{parent, child} {
+				if _, err := pool.AddTransaction(tx); err != nil {
+					t.Fatalf("AddTransaction: %v", err)
+				}
+			}
+
+			// Adding a transaction drops the expired ones
+			clock.Advance(tt.elapsed)
+			if _, err := pool.AddTransaction(testutil.Spend(t, w, coins[1], coins[1].Value/2, 1000, 0)); err != nil {
+				t.Fatalf("AddTransaction: %v", err)
+			}
+
+			for _, tx := range []*blockchain.Transaction{parent, child} {
+				if _, exists := pool.Get(tx.ID); exists == tt.wantExpired {
+					t.Errorf("transaction %s in pool = %v after %v, want %v", tx.ID, exists, tt.elapsed, !tt.wantExpired)
+				}
+			}
+		})
+	}
+}
+
+func TestBlockConnectedRemovesMinedAndConflictingTransactions(t *testing.T) {
+	bc := testutil.NewChain(t, testutil.NewClock())
+	w := testutil.NewWallet(t)
+	coins := matureCoins(t, bc, w, 3)
+	pool := New(bc, DefaultConfig())
+
+	mined := testutil.Spend(t, w, coins[0], coins[0].Value/2, 1000, 0)
+	minedChild := testutil.Spend(t, w, testutil.Output(mined, 0), mined.Outputs[0].Value/2, 1000, 0)
+	conflicted := testutil.Spend(t, w, coins[1], coins[1].Value/2, 1000, 0)
+	conflictedChild := testutil.Spend(t, w, testutil.Output(conflicted, 0), conflicted.Outputs[0].Value/2, 1000, 0)
+	unrelated := testutil.Spend(t, w, coins[2], coins[2].Value/2, 1000, 0)
+	for _, tx := range []*blockchain.Transaction{mined, minedChild, conflicted, conflictedChild, unrelated} {
+		if _, err := pool.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction: %v", err)
+		}
+	}
+
+	conflict := testutil.Spend(t, w, coins[1], coins[1].Value/4, 1000, 0)
+	if _, err := bc.MineBlock(w.GetAddress(), []blockchain.Transaction{*mined, *conflict}); err != nil {
+		t.Fatalf("MineBlock: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		tx         *blockchain.Transaction
+		wantInPool bool
+	}{
+		{"mined", mined, false},
+		{"child of a mined transaction", minedChild, true},
+		{"conflicting with the block", conflicted, false},
+		{"child of a conflicting transaction", conflictedChild, false},
+		{"unrelated", unrelated, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, exists := pool.Get(tt.tx.ID); exists != tt.wantInPool {
+				t.Errorf("in pool = %v, want %v", exists, tt.wantInPool)
+			}
+		})
+	}
+
+	if spent := pool.IsSpent(coins[1].OutPoint); spent {
+		t.Error("the conflicting transaction's input is still marked spent by the pool")
+	}
+}
+
+func TestCreateTransactionSkipsOutputsSpentInPool(t *testing.T) {
+	bc := testutil.NewChain(t, testutil.NewClock())
+	w := testutil.NewWallet(t)
+	to := testutil.NewWallet(t)
+	matureCoins(t, bc, w, 2)
+	pool := New(bc, DefaultConfig())
+
+	// Each payment fits in one coin, so each must select a coin the pool
+	// does not already spend
+	available := bc.FindAvailableUTXO(w.GetAddress(), pool)
+	amount := available[0].Value / 2
+	spent := make(map[blockchain.OutPoint]bool)
+	for i := range available {
+		tx, err := w.CreateTransaction(to.GetAddress(), amount, 1000, 0, bc, pool)
+		if err != nil {
+			t.Fatalf("CreateTransaction(%d): %v", i, err)
+		}
+		if _, err := pool.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction(%d): %v", i, err)
+		}
+		for _, input := range tx.Inputs {
+			spent[blockchain.OutPoint{TxID: input.TxID, Index: input.OutputIndex}] = true
+		}
+	}
+	if len(spent) != len(available) {
+		t.Fatalf("%d transactions spend %d coins, want one each", len(available), len(spent))
+	}
+
+	if utxos := bc.FindAvailableUTXO(w.GetAddress(), pool); len(utxos) != 0 {
+		t.Errorf("FindAvailableUTXO = %+v, want none", utxos)
+	}
+	if _, err := w.CreateTransaction(to.GetAddress(), amount, 1000, 0, bc, pool); err == nil {
+		t.Error("wallet CreateTransaction selected an output spent in the pool")
+	}
+	if _, err := bc.CreateTransaction(w.GetAddress(), to.GetAddress(), amount, 1000, 0, pool); err == nil {
+		t.Error("chain CreateTransaction selected an output spent in the pool")
+	}
+	if _, err := bc.CreateTransaction(w.GetAddress(), to.GetAddress(), amount, 1000, 0, nil); err != nil {
+		t.Errorf("CreateTransaction without a pool: %v", err)
+	}
+}
+
+func TestReorgEvictsTransactionsNoLongerFinal(t *testing.T) {
+	clock := testutil.NewClock()
+	bc := testutil.NewChain(t, clock)
+	miner := testutil.NewWallet(t)
+
+	// A second node shares the chain up to the fork
+	other := testutil.NewChain(t, testutil.NewClock())
+	for _, block := range testutil.MineBlocks(t, bc, miner.GetAddress(), int(blockchain.RegTestParams.CoinbaseMaturity)+1) {
+		if err := other.SubmitBlock(block); err != nil {
+			t.Fatalf("SubmitBlock on the other node: %v", err)
+		}
+	}
+
+	// This node's branch moves median time past an hour ahead, where a
+	// transaction locked until half an hour ahead is final
+	clock.Advance(time.Hour)
+	testutil.MineBlocks(t, bc, miner.GetAddress(), blockchain.RegTestParams.MedianTimeBlocks)
+
+	pool := New(bc, DefaultConfig())
+	pool.SetClock(clock)
+
+	lockTime := testutil.Start.Add(30 * time.Minute).Unix()
+	tx := testutil.Spend(t, miner, bc.FindSpendableUTXO(miner.GetAddress())[0], 1000000, 1000, lockTime)
+	if _, err := pool.AddTransaction(tx); err != nil {
+		t.Fatalf("AddTransaction: %v", err)
+	}
+
+	// The other node's longer branch keeps median time past before the
+	// lock time
+	branch := testutil.MineBlocks(t, other, miner.GetAddress(), blockchain.RegTestParams.MedianTimeBlocks+2)
+	for _, block := range branch {
+		if err := bc.SubmitBlock(block); err != nil {
+			t.Fatalf("SubmitBlock: %v", err)
+		}
+	}
+
+	if tip := bc.GetLatestBlock().Header.Hash; tip != branch[len(branch)-1].Header.Hash {
+		t.Fatalf("tip is %s, want the other branch's %s", tip, branch[len(branch)-1].Header.Hash)
+	}
+	if mtp := bc.GetMedianTimePast(); mtp >= lockTime {
+		t.Fatalf("median time past %d is not before lock time %d", mtp, lockTime)
+	}
+	if _, exists := pool.Get(tx.ID); exists {
+		t.Errorf("transaction locked until %d is still in the pool at median time past %d", lockTime, bc.GetMedianTimePast())
+	}
+}
@@ -0,0 +1,119 @@
+// Package merkle builds the merkle trees that commit to a block's
+// transactions, and produces and verifies proofs that a leaf is included
+// under a root. Verifying a proof needs only the root, so a light client
+// holding block headers can check that a transaction was confirmed without
+// downloading the block.
+package merkle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// HashPair returns the parent of two nodes: the SHA-256 of their hex forms
+// concatenated.
+func HashPair(left, right string) string {
+	hash := sha256.Sum256([]byte(left + right))
+	return hex.EncodeToString(hash[:])
+}
+
+// Root returns the merkle root of the leaves. A level with an odd number of
+// nodes pairs its last node with itself. The root of no leaves is empty.
+func Root(leaves []string) string {
+	root, _ := RootMutated(leaves)
+	return root
+}
+
+// RootMutated returns the merkle root of the leaves and whether the tree is
+// mutated: some level pairs two equal nodes. Because an odd level pairs its
+// last node with itself, repeating the trailing leaves of a list, such as
+// [A B C] and [A B C C], gives the same root, so a root alone does not pin
+// down the leaves. Lists of distinct leaves are never mutated, and for any
+// root at most one such list produces it.
+func RootMutated(leaves []string) (string, bool) {
+	if len(leaves) == 0 {
+		return "", false
+	}
+
+	mutated := false
+	level := leaves
+	for len(level) > 1 {
+		for i := 0; i+1 < len(level); i += 2 {
+			if level[i] == level[i+1] {
+				mutated = true
+			}
+		}
+		level = nextLevel(level)
+	}
+	return level[0], mutated
+}
+
+func nextLevel(level []string) []string {
+	next := make([]string, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		right := level[i]
+		if i+1 < len(level) {
+			right = level[i+1]
+		}
+		next = append(next, HashPair(level[i], right))
+	}
+	return next
+}
+
+// Proof shows that a leaf is included in a merkle tree. Following the
+// siblings from the leaf upwards rebuilds the root, and the bits of Index,
+// lowest first, say on which side of each sibling the path runs.
+type Proof struct {
+	Index    int      `json:"index"`    // Position of the leaf in the tree
+	Siblings []string `json:"siblings"` // Sibling of the path at each level, from the leaves up
+}
+
+// NewProof builds the proof for the leaf at index.
+func NewProof(leaves []string, index int) (*Proof, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, fmt.Errorf("leaf index %d out of range for %d leaves", index, len(leaves))
+	}
+
+	proof := &Proof{Index: index}
+
+	level := leaves
+	for position := index; len(level) > 1; position /= 2 {
+		sibling := position ^ 1
+		if sibling >= len(level) {
+			sibling = position
+		}
+		proof.Siblings = append(proof.Siblings, level[sibling])
+		level = nextLevel(level)
+	}
+
+	return proof, nil
+}
+
+// ComputeRoot returns the root that the proof rebuilds from leaf.
+func (p *Proof) ComputeRoot(leaf string) (string, error) {
+	if p.Index < 0 || (len(p.Siblings) < 63 && p.Index >= 1<<len(p.Siblings)) {
+		return "", errors.New("leaf index does not fit the proof's depth")
+	}
+
+	hash := leaf
+	for level, sibling := range p.Siblings {
+		if p.Index>>level&1 == 1 {
+			hash = HashPair(sibling, hash)
+		} else {
+			hash = HashPair(hash, sibling)
+		}
+	}
+	return hash, nil
+}
+
+// Verify reports whether the proof shows leaf is included under root.
+func Verify(leaf string, proof *Proof, root string) bool {
+	if proof == nil || root == "" {
+		return false
+	}
+
+	computed, err := proof.ComputeRoot(leaf)
+	return err == nil && computed == root
+}
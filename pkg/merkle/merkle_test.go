@@ -0,0 +1,165 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// testLeaves returns n distinct leaves that look like transaction IDs.
+func testLeaves(n int) []string {
+	leaves := make([]string, n)
+	for i := range leaves {
+		hash := sha256.Sum256([]byte(fmt.Sprint(i)))
+		leaves[i] = hex.EncodeToString(hash[:])
+	}
+	return leaves
+}
+
+func TestRoot(t *testing.T) {
+	l := testLeaves(4)
+
+	tests := []struct {
+		name   string
+		leaves []string
+		want   string
+	}{
+		{"no leaves", nil, ""},
+		{"one leaf", l[:1], l[0]},
+		{"two leaves", l[:2], HashPair(l[0], l[1])},
+		{"three leaves", l[:3], HashPair(HashPair(l[0], l[1]), HashPair(l[2], l[2]))},
+		{"four leaves", l[:4], HashPair(HashPair(l[0], l[1]), HashPair(l[2], l[3]))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Root(tt.leaves); got != tt.want {
+				t.Errorf("Root = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		leaves := testLeaves(n)
+		root := Root(leaves)
+		other := testLeaves(n + 1)[n]
+
+		for index := range leaves {
+			t.Run(fmt.Sprintf("leaf %d of %d", index, n), func(t *testing.T) {
+				proof, err := NewProof(leaves, index)
+				if err != nil {
+					t.Fatalf("NewProof: %v", err)
+				}
+
+				if !Verify(leaves[index], proof, root) {
+					t.Error("Verify rejected the leaf's own proof")
+				}
+				if Verify(other, proof, root) {
+					t.Error("Verify accepted a leaf not in the tree")
+				}
+				if Verify(leaves[index], proof, Root(testLeaves(n+1))) {
+					t.Error("Verify accepted the proof under another root")
+				}
+
+				for level := range proof.Siblings {
+					tampered := &Proof{Index: proof.Index, Siblings: append([]string(nil), proof.Siblings...)}
+					tampered.Siblings[level] = other
+					if Verify(leaves[index], tampered, root) {
+						t.Errorf("Verify accepted a proof with sibling %d changed", level)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestProofRejectsWrongPosition(t *testing.T) {
+	leaves := testLeaves(4)
+	root := Root(leaves)
+
+	proof, err := NewProof(leaves, 1)
+	if err != nil {
+		t.Fatalf("NewProof: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		index int
+	}{
+		{"other side", 0},
+		{"other subtree", 3},
+		{"past the depth", 4},
+		{"negative", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moved := &Proof{Index: tt.index, Siblings: proof.Siblings}
+			if Verify(leaves[1], moved, root) {
+				t.Errorf("Verify accepted leaf 1 at index %d", tt.index)
+			}
+		})
+	}
+}
+
+func TestNewProofRejectsIndexOutOfRange(t *testing.T) {
+	leaves := testLeaves(3)
+	for _, index := range []int{-1, 3} {
+		if _, err := NewProof(leaves, index); err == nil {
+			t.Errorf("NewProof accepted index %d of 3 leaves", index)
+		}
+	}
+}
+
+func TestVerifyRejectsMissingProofOrRoot(t *testing.T) {
+	leaves := testLeaves(2)
+	proof, err := NewProof(leaves, 0)
+	if err != nil {
+		t.Fatalf("NewProof: %v", err)
+	}
+
+	if Verify(leaves[0], nil, Root(leaves)) {
+		t.Error("Verify accepted a nil proof")
+	}
+	if Verify(leaves[0], proof, "") {
+		t.Error("Verify accepted an empty root")
+	}
+}
+
+func TestRootMutated(t *testing.T) {
+	l := testLeaves(6)
+
+	tests := []struct {
+		name        string
+		leaves      []string
+		same        []string // Distinct leaves with the same root, if mutated
+		wantMutated bool
+	}{
+		{"one leaf", l[:1], nil, false},
+		{"odd leaves", l[:3], nil, false},
+		{"even leaves", l[:4], nil, false},
+		{"odd leaves at an upper level", l[:6], nil, false},
+		{"two equal leaves", []string{l[0], l[0]}, nil, true},
+		{"last leaf repeated", []string{l[0], l[1], l[2], l[2]}, l[:3], true},
+		{"last pair repeated", []string{l[0], l[1], l[2], l[3], l[4], l[5], l[4], l[5]}, l[:6], true},
+		{"equal leaves in the middle", []string{l[0], l[0], l[1], l[2]}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, mutated := RootMutated(tt.leaves)
+			if mutated != tt.wantMutated {
+				t.Errorf("RootMutated mutated = %v, want %v", mutated, tt.wantMutated)
+			}
+			if root != Root(tt.leaves) {
+				t.Errorf("RootMutated root = %s, Root = %s", root, Root(tt.leaves))
+			}
+			if tt.same != nil && root != Root(tt.same) {
+				t.Errorf("root = %s, want the root of the distinct leaves %s", root, Root(tt.same))
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+// Package mining assembles blocks from the mempool for the node's own miner
+// and for external miners.
+package mining
+
+import (
+	"blockchain-node/pkg/blockchain"
+	"blockchain-node/pkg/mempool"
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// coinbaseReserve is the part of a block's size limit left free of mempool
+// transactions for the header, transaction count and coinbase.
+const coinbaseReserve = 1000
+
+// BlockTemplate is an unsolved block built from the mempool. A miner searches
+// nonces until the block's hash meets Target, then submits it.
+type BlockTemplate struct {
+	Block         *blockchain.Block `json:"block"`
+	Transactions  []TemplateTx      `json:"transactions"`   // The block's transactions after the coinbase
+	CoinbaseValue int64             `json:"coinbase_value"` // Block subsidy plus fees
+	Fees          int64             `json:"fees"`
+	Size          int               `json:"size"`
+	Target        string            `json:"target"` // Hex 256-bit target the block hash must not exceed
+}
+
+// TemplateTx describes a transaction in a block template.
+type TemplateTx struct {
+	ID      string  `json:"id"`
+	Fee     int64   `json:"fee"`
+	Size    int     `json:"size"`
+	FeeRate float64 `json:"fee_rate"`
+	Depends []int   `json:"depends,omitempty"` // Indexes in Transactions of the transactions it spends from
+}
+
+// Generator builds block templates on a chain from a mempool following it.
+type Generator struct {
+	chain *blockchain.Blockchain
+	pool  *mempool.Mempool
+}
+
+// NewGenerator creates a generator of blocks on chain from pool.
+func NewGenerator(chain *blockchain.Blockchain, pool *mempool.Mempool) *Generator {
+	return &Generator{
+		chain: chain,
+		pool:  pool,
+	}
+}
+
+// NewBlockTemplate builds a block on the current tip paying the block subsidy
+// plus fees to minerAddress. It holds the highest fee-rate transactions in the
+// mempool that fit in the block, each after the pool transactions it spends
+// from. A transaction the chain refuses, such as one the pool has not yet
+// caught up on, is left out along with its descendants.
+func (g *Generator) NewBlockTemplate(minerAddress string) (*BlockTemplate, error) {
+	selected := selectTransactions(g.pool.TxDescs(), blockchain.MaxBlockSize-coinbaseReserve, blockchain.MaxBlockTransactions-1)
+
+	var block *blockchain.Block
+	for {
+		transactions := make([]blockchain.Transaction, len(selected))
+		for i, desc := range selected {
+			transactions[i] = *desc.Tx
+		}
+
+		var err error
+		block, err = g.chain.BuildBlock(minerAddress, transactions)
+		if err == nil {
+			break
+		}
+
+		var txErr blockchain.TxError
+		if !errors.As(err, &txErr) || txErr.Index < 1 || txErr.Index > len(selected) {
+			return nil, fmt.Errorf("failed to build block: %w", err)
+		}
+		selected = withoutDescendants(selected, txErr.Index-1)
+	}
+
+	template := &BlockTemplate{
+		Block:         block,
+		Transactions:  make([]TemplateTx, len(selected)),
+		CoinbaseValue: block.Transactions[0].GetTotalOutput(),
+		Size:          block.GetSize(),
+		Target:        fmt.Sprintf("%064x", blockchain.CompactToBig(block.Header.Difficulty)),
+	}
+
+	index := make(map[string]int, len(selected))
+	for i, desc := range selected {
+		index[desc.Tx.ID] = i
+
+		entry := TemplateTx{
+			ID:      desc.Tx.ID,
+			Fee:     desc.Fee,
+			Size:    desc.Size,
+			FeeRate: desc.FeeRate(),
+		}
+		for _, input := range desc.Tx.Inputs {
+			if parent, exists := index[input.TxID]; exists && !containsInt(entry.Depends, parent) {
+				entry.Depends = append(entry.Depends, parent)
+			}
+		}
+
+		template.Transactions[i] = entry
+		template.Fees += desc.Fee
+	}
+
+	return template, nil
+}
+
+// Mine builds block templates paying minerAddress and searches for their
+// proof of work with miner until a block is accepted or ctx is done. When
+// the tip changes during a search, the template is rebuilt on the new tip.
+func (g *Generator) Mine(ctx context.Context, miner *blockchain.Miner, minerAddress string) (*blockchain.Block, error) {
+	for {
+		// Taken before the template is built, so a tip change while it is
+		// being built restarts the search at once
+		tipChanged := g.chain.TipChanged()
+
+		template, err := g.NewBlockTemplate(minerAddress)
+		if err != nil {
+			// The mempool catches up with a new tip just after it is
+			// connected; a selection made in between is retried
+			select {
+			case <-tipChanged:
+				continue
+			default:
+				return nil, err
+			}
+		}
+
+		searchCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-tipChanged:
+				cancel()
+			case <-searchCtx.Done():
+			}
+		}()
+
+		err = miner.Solve(searchCtx, template.Block)
+		cancel()
+
+		if err != nil {
+			if errors.Is(err, context.Canceled) && ctx.Err() == nil {
+				continue
+			}
+			return nil, err
+		}
+
+		if err := g.chain.SubmitBlock(template.Block); err != nil {
+			return nil, err
+		}
+
+		return template.Block, nil
+	}
+}
+
+// selectTransactions picks transactions from descs, highest fee rate first,
+// to fill at most maxSize bytes and maxCount transactions. A transaction only
+// becomes a candidate once every pool transaction it spends from has been
+// picked, so the result lists parents before children; one that does not fit
+// is skipped along with its descendants.
+func selectTransactions(descs []*mempool.TxDesc, maxSize, maxCount int) []*mempool.TxDesc {
+	inPool := make(map[string]bool, len(descs))
+	for _, desc := range descs {
+		inPool[desc.Tx.ID] = true
+	}
+
+	waiting := make(map[string]int)                // Unpicked pool parents of each transaction
+	children := make(map[string][]*mempool.TxDesc) // Pool transactions spending from each transaction
+	candidates := &feeRateHeap{}
+	for _, desc := range descs {
+		parents := make(map[string]bool)
+		for _, input := range desc.Tx.Inputs {
+			if inPool[input.TxID] && !parents[input.TxID] {
+				parents[input.TxID] = true
+				children[input.TxID] = append(children[input.TxID], desc)
+			}
+		}
+
+		if len(parents) == 0 {
+			heap.Push(candidates, desc)
+		} else {
+			waiting[desc.Tx.ID] = len(parents)
+		}
+	}
+
+	var selected []*mempool.TxDesc
+	size := 0
+	for candidates.Len() > 0 && len(selected) < maxCount {
+		desc := heap.Pop(candidates).(*mempool.TxDesc)
+		if size+desc.Size > maxSize {
+			continue
+		}
+
+		selected = append(selected, desc)
+		size += desc.Size
+
+		for _, child := range children[desc.Tx.ID] {
+			if waiting[child.Tx.ID]--; waiting[child.Tx.ID] == 0 {
+				heap.Push(candidates, child)
+			}
+		}
+	}
+
+	return selected
+}
+
+// withoutDescendants returns selected, which lists parents before children,
+// without the transaction at index and those spending from it.
+func withoutDescendants(selected []*mempool.TxDesc, index int) []*mempool.TxDesc {
+	dropped := map[string]bool{selected[index].Tx.ID: true}
+	kept := make([]*mempool.TxDesc, 0, len(selected)-1)
+	for _, desc := range selected {
+		if dropped[desc.Tx.ID] {
+			continue
+		}
+
+		spendsDropped := false
+		for _, input := range desc.Tx.Inputs {
+			if dropped[input.TxID] {
+				spendsDropped = true
+				break
+			}
+		}
+		if spendsDropped {
+			dropped[desc.Tx.ID] = true
+			continue
+		}
+
+		kept = append(kept, desc)
+	}
+	return kept
+}
+
+// feeRateHeap orders transactions by fee rate, highest first, then by
+// acceptance time.
+type feeRateHeap []*mempool.TxDesc
+
+func (h feeRateHeap) Len() int { return len(h) }
+
+func (h feeRateHeap) Less(i, j int) bool {
+	if h[i].FeeRate() != h[j].FeeRate() {
+		return h[i].FeeRate() > h[j].FeeRate()
+	}
+	return h[i].Added.Before(h[j].Added)
+}
+
+func (h feeRateHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *feeRateHeap) Push(x interface{}) { *h = append(*h, x.(*mempool.TxDesc)) }
+
+func (h *feeRateHeap) Pop() interface{} {
+	old := *h
+	desc := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return desc
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,287 @@
+package mining
+
+import (
+	"blockchain-node/internal/testutil"
+	"blockchain-node/pkg/blockchain"
+	"blockchain-node/pkg/mempool"
+	"blockchain-node/pkg/wallet"
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNewBlockTemplate(t *testing.T) {
+	bc := testutil.NewChain(t, testutil.NewClock())
+	w := testutil.NewWallet(t)
+	pool := mempool.New(bc, mempool.DefaultConfig())
+
+	blocks := testutil.MineBlocks(t, bc, w.GetAddress(), int(blockchain.RegTestParams.CoinbaseMaturity)+1)
+	coin := testutil.Output(&blocks[0].Transactions[0], 0)
+	parent := testutil.Spend(t, w, coin, coin.Value/2, 1000, 0)
+	child := testutil.Spend(t, w, testutil.Output(parent, 0), parent.Outputs[0].Value/2, 5000, 0)
+	for _, tx := range []*blockchain.Transaction{parent, child} {
+		if _, err := pool.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction: %v", err)
+		}
+	}
+
+	template, err := NewGenerator(bc, pool).NewBlockTemplate(w.GetAddress())
+	if err != nil {
+		t.Fatalf("NewBlockTemplate: %v", err)
+	}
+
+	if len(template.Transactions) != 2 || template.Transactions[0].ID != parent.ID || template.Transactions[1].ID != child.ID {
+		t.Fatalf("template holds %+v, want %s then %s", template.Transactions, parent.ID, child.ID)
+	}
+	if depends := template.Transactions[1].Depends; !slices.Equal(depends, []int{0}) {
+		t.Errorf("child depends on %v, want [0]", depends)
+	}
+	if template.Fees != 6000 {
+		t.Errorf("template fees are %d, want 6000", template.Fees)
+	}
+	subsidy := blockchain.CalcBlockSubsidy(template.Block.Header.Height, bc.Params())
+	if template.CoinbaseValue != subsidy+template.Fees {
+		t.Errorf("coinbase value is %d, want subsidy %d plus fees %d", template.CoinbaseValue, subsidy, template.Fees)
+	}
+	if template.Size != template.Block.GetSize() {
+		t.Errorf("template size is %d, block is %d bytes", template.Size, template.Block.GetSize())
+	}
+
+	if err := blockchain.NewMiner(0).Solve(context.Background(), template.Block); err != nil {
+		t.Fatalf("Solve: %v", err)
+	}
+	if err := bc.SubmitBlock(template.Block); err != nil {
+		t.Fatalf("SubmitBlock of the template: %v", err)
+	}
+	if count := pool.Count(); count != 0 {
+		t.Errorf("pool holds %d transactions after the template was mined, want 0", count)
+	}
+}
+
+func TestGeneratorMine(t *testing.T) {
+	bc := testutil.NewChain(t, testutil.NewClock())
+	w := testutil.NewWallet(t)
+	pool := mempool.New(bc, mempool.DefaultConfig())
+
+	blocks := testutil.MineBlocks(t, bc, w.GetAddress(), int(blockchain.RegTestParams.CoinbaseMaturity)+1)
+	coin := testutil.Output(&blocks[0].Transactions[0], 0)
+	tx := testutil.Spend(t, w, coin, coin.Value/2, 1000, 0)
+	if _, err := pool.AddTransaction(tx); err != nil {
+		t.Fatalf("AddTransaction: %v", err)
+	}
+
+	block, err := NewGenerator(bc, pool).Mine(context.Background(), blockchain.NewMiner(2), w.GetAddress())
+	if err != nil {
+		t.Fatalf("Mine: %v", err)
+	}
+	if tip := bc.GetLatestBlock(); tip.Header.Hash != block.Header.Hash {
+		t.Errorf("tip is %s, want the mined block %s", tip.Header.Hash, block.Header.Hash)
+	}
+	if len(block.Transactions) != 2 || block.Transactions[1].ID != tx.ID {
+		t.Errorf("mined block holds %d transactions, want the coinbase and %s", len(block.Transactions), tx.ID)
+	}
+}
+
+// spendFirstOutput builds and signs a transaction paying value to w from the
+// first output of the transaction txID, worth coinValue.
+func spendFirstOutput(t *testing.T, w *wallet.Wallet, txID string, coinValue, value, fee int64) *blockchain.Transaction {
+	t.Helper()
+
+	coin := blockchain.UTXO{
+		OutPoint: blockchain.OutPoint{TxID: txID, Index: 0},
+		Value:    coinValue,
+		Address:  w.GetAddress(),
+	}
+	return testutil.Spend(t, w, coin, value, fee, 0)
+}
+
+func TestNewBlockTemplateDropsRefusedTransactions(t *testing.T) {
+	w := testutil.NewWallet(t)
+	subsidy := blockchain.RegTestParams.InitialSubsidy
+
+	// The pool follows one node, the generator builds on another that
+	// shares its chain except for a block spending the second coinbase
+	bc := testutil.NewChain(t, testutil.NewClock())
+	pool := mempool.New(bc, mempool.DefaultConfig())
+
+	other := testutil.NewChain(t, testutil.NewClock())
+	blocks := testutil.MineBlocks(t, bc, w.GetAddress(), int(blockchain.RegTestParams.CoinbaseMaturity)+2)
+	for _, block := range blocks {
+		if err := other.SubmitBlock(block); err != nil {
+			t.Fatalf("SubmitBlock on the other node: %v", err)
+		}
+	}
+
+	conflict := spendFirstOutput(t, w, blocks[1].Transactions[0].ID, subsidy, subsidy/2, 1000)
+	if _, err := other.MineBlock(w.GetAddress(), []blockchain.Transaction{*conflict}); err != nil {
+		t.Fatalf("MineBlock with the conflicting spend: %v", err)
+	}
+
+	valid := spendFirstOutput(t, w, blocks[0].Transactions[0].ID, subsidy, subsidy/2, 1000)
+	refused := spendFirstOutput(t, w, blocks[1].Transactions[0].ID, subsidy, subsidy/4, 2000)
+	child := spendFirstOutput(t, w, refused.ID, subsidy/4, subsidy/8, 3000)
+	for _, tx := range []*blockchain.Transaction{valid, refused, child} {
+		if _, err := pool.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction(%s): %v", tx.ID, err)
+		}
+	}
+
+	template, err := NewGenerator(other, pool).NewBlockTemplate(w.GetAddress())
+	if err != nil {
+		t.Fatalf("NewBlockTemplate: %v", err)
+	}
+
+	if len(template.Transactions) != 1 || template.Transactions[0].ID != valid.ID {
+		t.Fatalf("template holds %+v, want only %s", template.Transactions, valid.ID)
+	}
+	if template.Fees != 1000 {
+		t.Errorf("template fees are %d, want 1000", template.Fees)
+	}
+
+	if err := blockchain.NewMiner(0).Solve(context.Background(), template.Block); err != nil {
+		t.Fatalf("Solve: %v", err)
+	}
+	if err := other.SubmitBlock(template.Block); err != nil {
+		t.Errorf("SubmitBlock of the template: %v", err)
+	}
+}
+
+// testDesc describes a pool transaction paying fee for size bytes and
+// spending an output of each of parents, or a confirmed output if none.
+// seq orders acceptance.
+func testDesc(id string, fee int64, size, seq int, parents ...string) *mempool.TxDesc {
+	tx := &blockchain.Transaction{ID: id}
+	if len(parents) == 0 {
+		parents = []string{"confirmed-" + id}
+	}
+	for _, parent := range parents {
+		tx.Inputs = append(tx.Inputs, blockchain.TxInput{TxID: parent})
+	}
+
+	return &mempool.TxDesc{
+		Tx:    tx,
+		Fee:   fee,
+		Size:  size,
+		Added: testutil.Start.Add(time.Duration(seq) * time.Second),
+	}
+}
+
+func descIDs(descs []*mempool.TxDesc) []string {
+	ids := make([]string, len(descs))
+	for i, desc := range descs {
+		ids[i] = desc.Tx.ID
+	}
+	return ids
+}
+
+func TestSelectTransactions(t *testing.T) {
+	tests := []struct {
+		name     string
+		descs    []*mempool.TxDesc
+		maxSize  int
+		maxCount int
+		want     []string
+	}{
+		{
+			name:     "empty pool",
+			maxSize:  1000,
+			maxCount: 10,
+		},
+		{
+			name:     "highest fee rate first",
+			descs:    []*mempool.TxDesc{testDesc("a", 1000, 100, 0), testDesc("b", 3000, 100, 1), testDesc("c", 4000, 200, 2)},
+			maxSize:  1000,
+			maxCount: 10,
+			want:     []string{"b", "c", "a"},
+		},
+		{
+			name:     "equal fee rates by acceptance",
+			descs:    []*mempool.TxDesc{testDesc("b", 1000, 100, 1), testDesc("a", 2000, 200, 0)},
+			maxSize:  1000,
+			maxCount: 10,
+			want:     []string{"a", "b"},
+		},
+		{
+			name:     "parent before a better-paying child",
+			descs:    []*mempool.TxDesc{testDesc("child", 10000, 100, 1, "parent"), testDesc("other", 500, 100, 2), testDesc("parent", 100, 100, 0)},
+			maxSize:  1000,
+			maxCount: 10,
+			want:     []string{"other", "parent", "child"},
+		},
+		{
+			name:     "child waits for every parent",
+			descs:    []*mempool.TxDesc{testDesc("p1", 3000, 100, 0), testDesc("c", 9000, 100, 2, "p1", "p2"), testDesc("p2", 1000, 100, 1)},
+			maxSize:  1000,
+			maxCount: 10,
+			want:     []string{"p1", "p2", "c"},
+		},
+		{
+			name:     "child spending one parent twice",
+			descs:    []*mempool.TxDesc{testDesc("p", 1000, 100, 0), testDesc("c", 2000, 100, 1, "p", "p")},
+			maxSize:  1000,
+			maxCount: 10,
+			want:     []string{"p", "c"},
+		},
+		{
+			name:     "skips what does not fit",
+			descs:    []*mempool.TxDesc{testDesc("a", 18000, 600, 0), testDesc("b", 10000, 500, 1), testDesc("c", 3000, 300, 2)},
+			maxSize:  1000,
+			maxCount: 10,
+			want:     []string{"a", "c"},
+		},
+		{
+			name:     "skipped parent takes its children",
+			descs:    []*mempool.TxDesc{testDesc("p", 27000, 900, 0), testDesc("c", 5000, 100, 1, "p"), testDesc("o", 5000, 500, 2)},
+			maxSize:  600,
+			maxCount: 10,
+			want:     []string{"o"},
+		},
+		{
+			name:     "count limit",
+			descs:    []*mempool.TxDesc{testDesc("a", 1000, 100, 0), testDesc("b", 3000, 100, 1), testDesc("c", 2000, 100, 2)},
+			maxSize:  1000,
+			maxCount: 2,
+			want:     []string{"b", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := descIDs(selectTransactions(tt.descs, tt.maxSize, tt.maxCount))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("selectTransactions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithoutDescendants(t *testing.T) {
+	selected := []*mempool.TxDesc{
+		testDesc("a", 1000, 100, 0),
+		testDesc("b", 1000, 100, 1, "a"),
+		testDesc("c", 1000, 100, 2),
+		testDesc("d", 1000, 100, 3, "b", "c"),
+		testDesc("e", 1000, 100, 4, "c"),
+	}
+
+	tests := []struct {
+		index int
+		want  []string
+	}{
+		{0, []string{"c", "e"}},
+		{1, []string{"a", "c", "e"}},
+		{2, []string{"a", "b"}},
+		{3, []string{"a", "b", "c", "e"}},
+		{4, []string{"a", "b", "c", "d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(selected[tt.index].Tx.ID, func(t *testing.T) {
+			got := descIDs(withoutDescendants(selected, tt.index))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("withoutDescendants(%d) = %v, want %v", tt.index, got, tt.want)
+			}
+		})
+	}
+}
@@ -16,9 +16,10 @@ type Storage interface {
 	DeleteTransaction(txID string) error
 	
 	// UTXO operations
-	SaveUTXO(address string, outputs []blockchain.TxOutput) error
-	GetUTXO(address string) ([]blockchain.TxOutput, error)
-	DeleteUTXO(address string) error
+	SaveUTXO(utxo *blockchain.UTXO) error
+	GetUTXO(outpoint blockchain.OutPoint) (*blockchain.UTXO, error)
+	GetUTXOsByAddress(address string) ([]blockchain.UTXO, error)
+	DeleteUTXO(outpoint blockchain.OutPoint) error
 	
 	// Metadata operations
 	SaveMetadata(key string, value []byte) error
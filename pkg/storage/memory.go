@@ -8,12 +8,12 @@ import (
 
 // MemoryStorage implements in-memory storage for testing and development
 type MemoryStorage struct {
-	blocks       map[string]*blockchain.Block         // hash -> block
-	blocksByHeight map[int64]*blockchain.Block        // height -> block
-	transactions map[string]*blockchain.Transaction   // txID -> transaction
-	utxos        map[string][]blockchain.TxOutput     // address -> UTXOs
-	metadata     map[string][]byte                    // key -> value
-	mutex        sync.RWMutex
+	blocks         map[string]*blockchain.Block             // hash -> block
+	blocksByHeight map[int64]*blockchain.Block              // height -> block
+	transactions   map[string]*blockchain.Transaction       // txID -> transaction
+	utxos          map[blockchain.OutPoint]*blockchain.UTXO // outpoint -> UTXO
+	metadata       map[string][]byte                        // key -> value
+	mutex          sync.RWMutex
 }
 
 // NewMemoryStorage creates a new in-memory storage instance
@@ -22,7 +22,7 @@ func NewMemoryStorage() *MemoryStorage {
 		blocks:         make(map[string]*blockchain.Block),
 		blocksByHeight: make(map[int64]*blockchain.Block),
 		transactions:   make(map[string]*blockchain.Transaction),
-		utxos:          make(map[string][]blockchain.TxOutput),
+		utxos:          make(map[blockchain.OutPoint]*blockchain.UTXO),
 		metadata:       make(map[string][]byte),
 	}
 }
@@ -138,46 +138,59 @@ func (ms *MemoryStorage) DeleteTransaction(txID string) error {
 	return nil
 }
 
-// SaveUTXO saves UTXO data for an address
-func (ms *MemoryStorage) SaveUTXO(address string, outputs []blockchain.TxOutput) error {
+// SaveUTXO saves an unspent output keyed by its outpoint
+func (ms *MemoryStorage) SaveUTXO(utxo *blockchain.UTXO) error {
 	ms.mutex.Lock()
 	defer ms.mutex.Unlock()
 	
-	if outputs == nil {
-		outputs = []blockchain.TxOutput{}
+	if utxo == nil {
+		return fmt.Errorf("utxo cannot be nil")
 	}
 	
 	// Create a copy to prevent external modification
-	utxoCopy := make([]blockchain.TxOutput, len(outputs))
-	copy(utxoCopy, outputs)
+	utxoCopy := *utxo
 	
-	ms.utxos[address] = utxoCopy
+	ms.utxos[utxo.OutPoint] = &utxoCopy
 	return nil
 }
 
-// GetUTXO retrieves UTXO data for an address
-func (ms *MemoryStorage) GetUTXO(address string) ([]blockchain.TxOutput, error) {
+// GetUTXO retrieves an unspent output by outpoint
+func (ms *MemoryStorage) GetUTXO(outpoint blockchain.OutPoint) (*blockchain.UTXO, error) {
 	ms.mutex.RLock()
 	defer ms.mutex.RUnlock()
 	
-	utxos, exists := ms.utxos[address]
+	utxo, exists := ms.utxos[outpoint]
 	if !exists {
-		return []blockchain.TxOutput{}, nil // Return empty slice, not error
+		return nil, fmt.Errorf("utxo not found: %s", outpoint)
 	}
 	
 	// Return a copy to prevent external modification
-	result := make([]blockchain.TxOutput, len(utxos))
-	copy(result, utxos)
+	result := *utxo
+	
+	return &result, nil
+}
+
+// GetUTXOsByAddress retrieves all unspent outputs paying to an address
+func (ms *MemoryStorage) GetUTXOsByAddress(address string) ([]blockchain.UTXO, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	
+	result := []blockchain.UTXO{} // Return empty slice, not error
+	for _, utxo := range ms.utxos {
+		if utxo.Address == address {
+			result = append(result, *utxo)
+		}
+	}
 	
 	return result, nil
 }
 
-// DeleteUTXO removes UTXO data for an address
-func (ms *MemoryStorage) DeleteUTXO(address string) error {
+// DeleteUTXO removes an unspent output
+func (ms *MemoryStorage) DeleteUTXO(outpoint blockchain.OutPoint) error {
 	ms.mutex.Lock()
 	defer ms.mutex.Unlock()
 	
-	delete(ms.utxos, address)
+	delete(ms.utxos, outpoint)
 	return nil
 }
 
@@ -237,7 +250,7 @@ func (ms *MemoryStorage) Clear() error {
 	ms.blocks = make(map[string]*blockchain.Block)
 	ms.blocksByHeight = make(map[int64]*blockchain.Block)
 	ms.transactions = make(map[string]*blockchain.Transaction)
-	ms.utxos = make(map[string][]blockchain.TxOutput)
+	ms.utxos = make(map[blockchain.OutPoint]*blockchain.UTXO)
 	ms.metadata = make(map[string][]byte)
 	
 	return nil
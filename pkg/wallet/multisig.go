@@ -0,0 +1,280 @@
+package wallet
+
+import (
+	"blockchain-node/pkg/blockchain"
+	"blockchain-node/pkg/crypto"
+	"encoding/hex"
+	"fmt"
+)
+
+// MultiSig is an M-of-N pay-to-script-hash address: coins sent to it can
+// only be spent with signatures from Required of the PublicKeys. Anyone
+// holding the redeem script can rebuild the rest.
+type MultiSig struct {
+	Address      string            `json:"address"`
+	RedeemScript blockchain.Script `json:"redeem_script"`
+	Required     int               `json:"required"`
+	PublicKeys   []string          `json:"public_keys"` // Hex compressed keys, in script order
+}
+
+// NewMultiSig creates the address requiring required signatures from the
+// hex public keys. version is the network's script address version.
+func NewMultiSig(required int, publicKeys []string, version byte) (*MultiSig, error) {
+	keys := make([][]byte, len(publicKeys))
+	for i, publicKey := range publicKeys {
+		if _, err := crypto.PublicKeyFromHex(publicKey); err != nil {
+			return nil, fmt.Errorf("public key %d: %v", i, err)
+		}
+
+		key, err := hex.DecodeString(publicKey)
+		if err != nil || len(key) != 33 {
+			return nil, fmt.Errorf("public key %d must be a compressed public key", i)
+		}
+		keys[i] = key
+	}
+
+	redeemScript, err := blockchain.MultiSigScript(required, keys)
+	if err != nil {
+		return nil, err
+	}
+	return MultiSigFromRedeemScript(redeemScript, version)
+}
+
+// MultiSigFromRedeemScript recovers a multisig address from its redeem
+// script.
+func MultiSigFromRedeemScript(redeemScript blockchain.Script, version byte) (*MultiSig, error) {
+	required, keys, err := blockchain.ParseMultiSigScript(redeemScript)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKeys := make([]string, len(keys))
+	for i, key := range keys {
+		publicKeys[i] = hex.EncodeToString(key)
+	}
+
+	return &MultiSig{
+		Address:      crypto.GenerateScriptAddress(redeemScript, version),
+		RedeemScript: redeemScript,
+		Required:     required,
+		PublicKeys:   publicKeys,
+	}, nil
+}
+
+// MultiSigTransaction is a spend from a multisig address on its way between
+// co-signers. It is passed around as JSON, each co-signer adding signatures,
+// until Finalize can build the unlocking scripts.
+type MultiSigTransaction struct {
+	Transaction  *blockchain.Transaction `json:"transaction"`
+	PrevOutputs  []blockchain.UTXO       `json:"prev_outputs"` // Output spent by each input
+	RedeemScript blockchain.Script       `json:"redeem_script"`
+	Signatures   []map[string]string     `json:"signatures"` // For each input, hex signatures by hex public key
+}
+
+// NewMultiSigTransaction builds an unsigned payment of amount to to from the
+// multisig's coins, returning change to the multisig address. The fee paid
+// is the larger of fee and feeRate (satoshis per byte) times the signed
+// size.
+func NewMultiSigTransaction(ms *MultiSig, coins []blockchain.UTXO, to string, amount, fee, feeRate int64) (*MultiSigTransaction, error) {
+	placeholders := make([][]byte, ms.Required)
+	for i := range placeholders {
+		placeholders[i] = make([]byte, 64)
+	}
+	unlockingSize := len(blockchain.MultiSigUnlockingScript(placeholders, ms.RedeemScript))
+
+	tx, prevOuts, err := blockchain.NewTxBuilder(coins, ms.Address).
+		AddOutput(to, amount).
+		SetFee(fee).
+		SetFeeRate(feeRate).
+		SetUnlockingScriptSize(unlockingSize).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	signatures := make([]map[string]string, len(tx.Inputs))
+	for i := range signatures {
+		signatures[i] = make(map[string]string)
+	}
+
+	return &MultiSigTransaction{
+		Transaction:  tx,
+		PrevOutputs:  prevOuts,
+		RedeemScript: ms.RedeemScript,
+		Signatures:   signatures,
+	}, nil
+}
+
+// check makes sure a transaction received from elsewhere is consistent,
+// every input spending from the redeem script's address, before it is
+// signed or finalized.
+func (mtx *MultiSigTransaction) check() (*MultiSig, error) {
+	if mtx.Transaction == nil {
+		return nil, fmt.Errorf("missing transaction")
+	}
+
+	inputs := len(mtx.Transaction.Inputs)
+	if inputs == 0 || len(mtx.PrevOutputs) != inputs || len(mtx.Signatures) != inputs {
+		return nil, fmt.Errorf("expected previous outputs and signatures for %d inputs", inputs)
+	}
+
+	address, err := crypto.StringToAddress(mtx.PrevOutputs[0].Address)
+	if err != nil || len(address) == 0 {
+		return nil, fmt.Errorf("invalid address %q", mtx.PrevOutputs[0].Address)
+	}
+
+	ms, err := MultiSigFromRedeemScript(mtx.RedeemScript, address[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid redeem script: %v", err)
+	}
+
+	for i, prevOut := range mtx.PrevOutputs {
+		input := mtx.Transaction.Inputs[i]
+		if prevOut.OutPoint.TxID != input.TxID || prevOut.OutPoint.Index != input.OutputIndex {
+			return nil, fmt.Errorf("previous output %d does not match input %d", i, i)
+		}
+
+		if prevOut.Address != ms.Address {
+			return nil, fmt.Errorf("input %d spends from %s, not the redeem script's address %s", i, prevOut.Address, ms.Address)
+		}
+
+		if mtx.Signatures[i] == nil {
+			mtx.Signatures[i] = make(map[string]string)
+		}
+	}
+
+	return ms, nil
+}
+
+// AddSignature records a co-signer's hex signature for an input after
+// checking that it is valid and made by one of the multisig's keys.
+func (mtx *MultiSigTransaction) AddSignature(inputIndex int, publicKey, signature string) error {
+	ms, err := mtx.check()
+	if err != nil {
+		return err
+	}
+
+	if inputIndex < 0 || inputIndex >= len(mtx.Transaction.Inputs) {
+		return fmt.Errorf("input index %d out of range", inputIndex)
+	}
+
+	if !ms.hasKey(publicKey) {
+		return fmt.Errorf("public key %s is not a key of this multisig", publicKey)
+	}
+
+	pubKey, err := crypto.PublicKeyFromHex(publicKey)
+	if err != nil {
+		return err
+	}
+
+	sigHash := mtx.Transaction.SignatureHash(inputIndex, &mtx.PrevOutputs[inputIndex])
+	if !crypto.VerifyHex(sigHash, signature, pubKey) {
+		return fmt.Errorf("invalid signature for input %d by %s", inputIndex, publicKey)
+	}
+
+	mtx.Signatures[inputIndex][publicKey] = signature
+	return nil
+}
+
+func (ms *MultiSig) hasKey(publicKey string) bool {
+	for _, key := range ms.PublicKeys {
+		if key == publicKey {
+			return true
+		}
+	}
+	return false
+}
+
+// Missing returns how many more signatures are needed before every input
+// can be finalized.
+func (mtx *MultiSigTransaction) Missing() (int, error) {
+	ms, err := mtx.check()
+	if err != nil {
+		return 0, err
+	}
+
+	missing := 0
+	for _, signatures := range mtx.Signatures {
+		signed := 0
+		for _, publicKey := range ms.PublicKeys {
+			if _, exists := signatures[publicKey]; exists {
+				signed++
+			}
+		}
+
+		if n := ms.Required - signed; n > missing {
+			missing = n
+		}
+	}
+	return missing, nil
+}
+
+// Finalize builds each input's unlocking script from the first Required
+// signatures in key order and returns the signed transaction.
+func (mtx *MultiSigTransaction) Finalize() (*blockchain.Transaction, error) {
+	ms, err := mtx.check()
+	if err != nil {
+		return nil, err
+	}
+
+	tx := *mtx.Transaction
+	tx.Inputs = append([]blockchain.TxInput(nil), mtx.Transaction.Inputs...)
+
+	for i := range tx.Inputs {
+		var signatures [][]byte
+		for _, publicKey := range ms.PublicKeys {
+			signature, exists := mtx.Signatures[i][publicKey]
+			if !exists {
+				continue
+			}
+
+			signatureBytes, err := hex.DecodeString(signature)
+			if err != nil {
+				return nil, fmt.Errorf("input %d: invalid signature hex: %v", i, err)
+			}
+
+			if signatures = append(signatures, signatureBytes); len(signatures) == ms.Required {
+				break
+			}
+		}
+
+		if len(signatures) < ms.Required {
+			return nil, fmt.Errorf("input %d has %d of %d required signatures", i, len(signatures), ms.Required)
+		}
+
+		tx.Inputs[i].UnlockingScript = blockchain.MultiSigUnlockingScript(signatures, mtx.RedeemScript)
+	}
+
+	return &tx, nil
+}
+
+// SignMultiSig adds the wallet's signature to every input of a multisig
+// transaction whose keys include the wallet's.
+func (w *Wallet) SignMultiSig(mtx *MultiSigTransaction) error {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	if _, err := mtx.check(); err != nil {
+		return err
+	}
+
+	publicKey := w.KeyPair.GetPublicKeyHex()
+
+	for i := range mtx.Transaction.Inputs {
+		sigHash := mtx.Transaction.SignatureHash(i, &mtx.PrevOutputs[i])
+		if sigHash == nil {
+			return fmt.Errorf("input %d: transaction cannot be encoded for signing", i)
+		}
+
+		signature, err := crypto.SignHex(sigHash, w.KeyPair.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("failed to create signature for input %d: %v", i, err)
+		}
+
+		if err := mtx.AddSignature(i, publicKey, signature); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
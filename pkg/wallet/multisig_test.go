@@ -0,0 +1,159 @@
+package wallet
+
+import (
+	"blockchain-node/pkg/blockchain"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// newTestMultiSig returns a 2-of-3 multisig address for regtest and the
+// wallets holding its keys.
+func newTestMultiSig(t *testing.T) (*MultiSig, []*Wallet) {
+	t.Helper()
+
+	var signers []*Wallet
+	var publicKeys []string
+	for i := 0; i < 3; i++ {
+		w := newTestWallet(t)
+		signers = append(signers, w)
+		publicKeys = append(publicKeys, w.GetPublicKey())
+	}
+
+	ms, err := NewMultiSig(2, publicKeys, blockchain.RegTestParams.ScriptAddressVersion)
+	if err != nil {
+		t.Fatalf("NewMultiSig: %v", err)
+	}
+	return ms, signers
+}
+
+func TestMultiSigRoundTrip(t *testing.T) {
+	params := blockchain.RegTestParams
+	params.CoinbaseMaturity = 1
+	bc, err := blockchain.NewBlockchainWithParams(&params)
+	if err != nil {
+		t.Fatalf("NewBlockchainWithParams: %v", err)
+	}
+	ms, signers := newTestMultiSig(t)
+	to := newTestWallet(t)
+
+	for i := 0; i < 2; i++ {
+		if _, err := bc.MineBlock(ms.Address, nil); err != nil {
+			t.Fatalf("MineBlock: %v", err)
+		}
+	}
+
+	mtx, err := NewMultiSigTransaction(ms, bc.FindUTXO(ms.Address), to.Address, 70*coin, 0, 0)
+	if err != nil {
+		t.Fatalf("NewMultiSigTransaction: %v", err)
+	}
+
+	if err := signers[0].SignMultiSig(mtx); err != nil {
+		t.Fatalf("SignMultiSig: %v", err)
+	}
+	if missing, err := mtx.Missing(); err != nil || missing != 1 {
+		t.Fatalf("Missing after one signature = %d, %v, want 1", missing, err)
+	}
+	if _, err := mtx.Finalize(); err == nil {
+		t.Fatal("Finalize accepted one of two required signatures")
+	}
+
+	// The partly signed transaction reaches the second co-signer as JSON
+	data, err := json.Marshal(mtx)
+	if err != nil {
+		t.Fatalf("encoding: %v", err)
+	}
+	var received MultiSigTransaction
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatalf("decoding: %v", err)
+	}
+
+	if err := signers[2].SignMultiSig(&received); err != nil {
+		t.Fatalf("SignMultiSig: %v", err)
+	}
+	if missing, err := received.Missing(); err != nil || missing != 0 {
+		t.Fatalf("Missing after two signatures = %d, %v, want 0", missing, err)
+	}
+
+	tx, err := received.Finalize()
+	if err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+	for i := range tx.Inputs {
+		if err := blockchain.VerifyScript(tx, i, &received.PrevOutputs[i]); err != nil {
+			t.Errorf("VerifyScript(%d): %v", i, err)
+		}
+	}
+
+	if _, err := bc.MineBlock(to.Address, []blockchain.Transaction{*tx}); err != nil {
+		t.Fatalf("MineBlock rejected the multisig spend: %v", err)
+	}
+	if got := bc.GetBalance(to.Address); got != 120*coin {
+		t.Errorf("recipient balance = %d, want 70 coins plus a 50 coin subsidy", got)
+	}
+	if got := bc.GetBalance(ms.Address); got != 30*coin {
+		t.Errorf("multisig balance = %d, want change of 30 coins", got)
+	}
+}
+
+func TestMultiSigTransactionRejects(t *testing.T) {
+	ms, signers := newTestMultiSig(t)
+	to := newTestWallet(t)
+	outsider := newTestWallet(t)
+
+	coins := []blockchain.UTXO{
+		{OutPoint: blockchain.OutPoint{TxID: strings.Repeat("a", 64), Index: 0}, Value: 50 * coin, Address: ms.Address},
+	}
+
+	tests := []struct {
+		name   string
+		signer *Wallet
+		change func(mtx *MultiSigTransaction)
+	}{
+		{"key outside the multisig", outsider, func(mtx *MultiSigTransaction) {}},
+		{"previous output of another input", signers[0], func(mtx *MultiSigTransaction) {
+			mtx.PrevOutputs[0].OutPoint.Index++
+		}},
+		{"previous output at another address", signers[0], func(mtx *MultiSigTransaction) {
+			mtx.PrevOutputs[0].Address = to.Address
+		}},
+		{"missing previous output", signers[0], func(mtx *MultiSigTransaction) {
+			mtx.PrevOutputs = nil
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mtx, err := NewMultiSigTransaction(ms, coins, to.Address, 20*coin, 0, 0)
+			if err != nil {
+				t.Fatalf("NewMultiSigTransaction: %v", err)
+			}
+			tt.change(mtx)
+
+			if err := tt.signer.SignMultiSig(mtx); err == nil {
+				t.Error("SignMultiSig succeeded")
+			}
+			if len(mtx.Signatures[0]) != 0 {
+				t.Errorf("recorded signatures %v", mtx.Signatures[0])
+			}
+			if _, err := mtx.Finalize(); err == nil {
+				t.Error("Finalize succeeded")
+			}
+		})
+	}
+
+	// A valid signature is refused for a key outside the multisig
+	mtx, err := NewMultiSigTransaction(ms, coins, to.Address, 20*coin, 0, 0)
+	if err != nil {
+		t.Fatalf("NewMultiSigTransaction: %v", err)
+	}
+	if err := signers[0].SignMultiSig(mtx); err != nil {
+		t.Fatalf("SignMultiSig: %v", err)
+	}
+	if err := mtx.AddSignature(0, outsider.GetPublicKey(), mtx.Signatures[0][signers[0].GetPublicKey()]); err == nil {
+		t.Error("AddSignature accepted a key outside the multisig")
+	}
+	if err := mtx.AddSignature(0, signers[1].GetPublicKey(), mtx.Signatures[0][signers[0].GetPublicKey()]); err == nil {
+		t.Error("AddSignature accepted another key's signature")
+	}
+}
@@ -3,6 +3,8 @@ package wallet
 import (
 	"blockchain-node/pkg/blockchain"
 	"blockchain-node/pkg/crypto"
+	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -25,13 +27,20 @@ type WalletData struct {
 }
 
 
+// NewWallet creates a wallet with a mainnet address.
 func NewWallet() (*Wallet, error) {
+	return NewWalletWithVersion(crypto.AddressVersionMainNet)
+}
+
+// NewWalletWithVersion creates a wallet whose address carries the given
+// network version byte, usually ChainParams.AddressVersion.
+func NewWalletWithVersion(version byte) (*Wallet, error) {
 	keyPair, err := crypto.GenerateKeyPair()
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate key pair: %v", err)
 	}
 	
-	address := crypto.GenerateAddressFromKeyPair(keyPair, crypto.AddressVersionMainNet)
+	address := crypto.GenerateAddressFromKeyPair(keyPair, version)
 	
 	return &Wallet{
 		KeyPair: keyPair,
@@ -41,13 +50,13 @@ func NewWallet() (*Wallet, error) {
 }
 
 
-func NewWalletFromPrivateKey(privateKeyHex string) (*Wallet, error) {
+func NewWalletFromPrivateKey(privateKeyHex string, version byte) (*Wallet, error) {
 	keyPair, err := crypto.PrivateKeyFromHex(privateKeyHex)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create key pair from private key: %v", err)
 	}
 	
-	address := crypto.GenerateAddressFromKeyPair(keyPair, crypto.AddressVersionMainNet)
+	address := crypto.GenerateAddressFromKeyPair(keyPair, version)
 	
 	return &Wallet{
 		KeyPair: keyPair,
@@ -87,22 +96,30 @@ func (w *Wallet) GetBalance() int64 {
 	return w.Balance
 }
 
-func (w *Wallet) CreateTransaction(to string, amount int64, bc *blockchain.Blockchain) (*blockchain.Transaction, error) {
+// CreateTransaction builds and signs a payment of amount to to. The fee paid is
+// the larger of fee and feeRate (satoshis per byte) times the signed size.
+// Outputs pending already spends, if it is not nil, are not selected.
+func (w *Wallet) CreateTransaction(to string, amount, fee, feeRate int64, bc *blockchain.Blockchain, pending blockchain.SpentOutputs) (*blockchain.Transaction, error) {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 	
-	w.Balance = bc.GetBalance(w.Address)
+	balance := bc.GetBalanceDetails(w.Address)
+	w.Balance = balance.Total
 	
-	if w.Balance < amount {
-		return nil, fmt.Errorf("insufficient funds: have %d, need %d", w.Balance, amount)
+	if balance.Spendable < amount+fee {
+		return nil, fmt.Errorf("insufficient spendable funds: have %d (%d more immature), need %d", balance.Spendable, balance.Immature, amount+fee)
 	}
 	
-	tx, err := bc.CreateTransaction(w.Address, to, amount)
+	tx, prevOuts, err := blockchain.NewTxBuilder(bc.FindAvailableUTXO(w.Address, pending), w.Address).
+		AddOutput(to, amount).
+		SetFee(fee).
+		SetFeeRate(feeRate).
+		Build()
 	if err != nil {
 		return nil, err
 	}
 	
-	err = w.SignTransaction(tx)
+	err = w.SignTransaction(tx, prevOuts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign transaction: %v", err)
 	}
@@ -110,56 +127,126 @@ func (w *Wallet) CreateTransaction(to string, amount int64, bc *blockchain.Block
 	return tx, nil
 }
 
-func (w *Wallet) SignTransaction(tx *blockchain.Transaction) error {
-	w.mutex.RLock()
-	defer w.mutex.RUnlock()
+// SignTransaction signs every input separately; prevOuts[i] is the output spent by input i.
+func (w *Wallet) SignTransaction(tx *blockchain.Transaction, prevOuts []blockchain.UTXO) error {
+	// No lock here: CreateTransaction calls this while holding w.mutex and the key pair never changes
+	if len(prevOuts) != len(tx.Inputs) {
+		return fmt.Errorf("expected %d previous outputs, got %d", len(tx.Inputs), len(prevOuts))
+	}
 	
-	txCopy := blockchain.Transaction{
-		ID:        tx.ID,
-		Inputs:    tx.Inputs,
-		Outputs:   tx.Outputs,
-		Timestamp: tx.Timestamp,
+	publicKey, err := hex.DecodeString(w.KeyPair.GetPublicKeyHex())
+	if err != nil {
+		return fmt.Errorf("failed to encode public key: %v", err)
 	}
 	
-	txData, err := json.Marshal(txCopy)
+	for i := range tx.Inputs {
+		if !w.owns(&prevOuts[i]) {
+			if prevOuts[i].Address == "" {
+				return fmt.Errorf("input %d spends an output locked by a script the wallet cannot sign for", i)
+			}
+			return fmt.Errorf("input %d spends an output owned by %s", i, prevOuts[i].Address)
+		}
+		
+		sigHash := tx.SignatureHash(i, &prevOuts[i])
+		if sigHash == nil {
+			return fmt.Errorf("input %d: transaction cannot be encoded for signing", i)
+		}
+		
+		signatureHex, err := crypto.SignHex(sigHash, w.KeyPair.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("failed to create signature for input %d: %v", i, err)
+		}
+		
+		signature, err := hex.DecodeString(signatureHex)
+		if err != nil {
+			return fmt.Errorf("failed to encode signature for input %d: %v", i, err)
+		}
+		
+		tx.Inputs[i].UnlockingScript = blockchain.SignatureScript(signature, publicKey)
+	}
+	
+	// The ID leaves out unlocking scripts, so signing does not change it
+	return nil
+}
+
+// owns reports whether the wallet's key alone can spend an output: one paid
+// to its address, or a time-locked one paid to its key.
+func (w *Wallet) owns(prevOut *blockchain.UTXO) bool {
+	if len(prevOut.LockingScript) == 0 {
+		return prevOut.Address == w.Address
+	}
+	
+	_, _, pubKeyHash, err := blockchain.ParseTimeLockScript(prevOut.LockingScript)
 	if err != nil {
-		return fmt.Errorf("failed to marshal transaction: %v", err)
+		return false
 	}
 	
-	signature, err := crypto.SignHex(txData, w.KeyPair.PrivateKey)
+	ownHash, err := crypto.ExtractPublicKeyHash(w.Address)
+	return err == nil && bytes.Equal(pubKeyHash, ownHash)
+}
+
+// SpendTimeLocked builds and signs a transaction moving a time-locked output
+// paid to the wallet's key to its address, less the larger of fee and
+// feeRate (satoshis per byte) times the signed size. The output's lock is
+// copied into the transaction's lock time or the input's sequence, so the
+// transaction can be mined as soon as the output unlocks.
+func (w *Wallet) SpendTimeLocked(prevOut blockchain.UTXO, fee, feeRate int64) (*blockchain.Transaction, error) {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	
+	lock, relative, _, err := blockchain.ParseTimeLockScript(prevOut.LockingScript)
 	if err != nil {
-		return fmt.Errorf("failed to create signature: %v", err)
+		return nil, fmt.Errorf("output %s: %v", prevOut.OutPoint, err)
 	}
 	
+	input := blockchain.TxInput{
+		TxID:        prevOut.OutPoint.TxID,
+		OutputIndex: prevOut.OutPoint.Index,
+	}
+	if relative {
+		input.Sequence = uint32(lock)
+	}
 	
-	tx.Signature = signature
+	tx := blockchain.NewTransaction([]blockchain.TxInput{input}, []blockchain.TxOutput{{Value: prevOut.Value, Address: w.Address}})
+	if !relative {
+		tx.LockTime = lock
+	}
 	
-	for i := range tx.Inputs {
-		tx.Inputs[i].PublicKey = w.GetPublicKey()
-		tx.Inputs[i].Signature = signature
+	// Size the fee with a full-length placeholder for the signature
+	tx.Inputs[0].UnlockingScript = blockchain.SignatureScript(make([]byte, 64), make([]byte, 33))
+	if rateFee := feeRate * int64(tx.GetSize()); rateFee > fee {
+		fee = rateFee
 	}
+	tx.Inputs[0].UnlockingScript = nil
 	
-	return nil
+	if tx.Outputs[0].Value -= fee; tx.Outputs[0].Value < blockchain.DustThreshold {
+		return nil, fmt.Errorf("output of %d is too small to pay a fee of %d", prevOut.Value, fee)
+	}
+	tx.SetID()
+	
+	if err := w.SignTransaction(tx, []blockchain.UTXO{prevOut}); err != nil {
+		return nil, fmt.Errorf("failed to sign transaction: %v", err)
+	}
+	
+	return tx, nil
 }
 
-func (w *Wallet) VerifyTransaction(tx *blockchain.Transaction) bool {
+func (w *Wallet) VerifyTransaction(tx *blockchain.Transaction, prevOuts []blockchain.UTXO) bool {
 	w.mutex.RLock()
 	defer w.mutex.RUnlock()
 	
-	txCopy := blockchain.Transaction{
-		ID:        tx.ID,
-		Inputs:    tx.Inputs,
-		Outputs:   tx.Outputs,
-		Timestamp: tx.Timestamp,
+	if len(prevOuts) != len(tx.Inputs) {
+		return false
 	}
 	
-	txData, err := json.Marshal(txCopy)
-	if err != nil {
-		return false
+	// Lock times are not checked here, only that the scripts are satisfied
+	for i := range tx.Inputs {
+		if err := blockchain.VerifyScript(tx, i, &prevOuts[i]); err != nil {
+			return false
+		}
 	}
 	
-
-	return crypto.VerifyHex(txData, tx.Signature, w.KeyPair.PublicKey)
+	return true
 }
 
 func (w *Wallet) SaveToFile(filename string) error {
@@ -204,7 +291,13 @@ func LoadFromFile(filename string) (*Wallet, error) {
 	}
 	
 	
-	wallet, err := NewWalletFromPrivateKey(walletData.PrivateKey)
+	// The saved address records which network the wallet belongs to
+	addressBytes, err := crypto.StringToAddress(walletData.Address)
+	if err != nil || len(addressBytes) == 0 {
+		return nil, fmt.Errorf("invalid address in wallet file")
+	}
+	
+	wallet, err := NewWalletFromPrivateKey(walletData.PrivateKey, addressBytes[0])
 	if err != nil {
 		return nil, fmt.Errorf("failed to create wallet from private key: %v", err)
 	}
@@ -230,7 +323,7 @@ func (w *Wallet) GetTransactionHistory(bc *blockchain.Blockchain) []blockchain.T
 			involved := false
 			
 			for _, input := range tx.Inputs {
-				if input.PublicKey == w.GetPublicKey() {
+				if input.PublicKey() == w.GetPublicKey() {
 					involved = true
 					break
 				}
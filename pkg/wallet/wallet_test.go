@@ -0,0 +1,89 @@
+package wallet
+
+import (
+	"blockchain-node/pkg/blockchain"
+	"bytes"
+	"slices"
+	"testing"
+)
+
+const coin = 100000000
+
+func newTestWallet(t *testing.T) *Wallet {
+	t.Helper()
+
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatalf("NewWallet: %v", err)
+	}
+	return w
+}
+
+func TestCreateTransactionSignsEachInput(t *testing.T) {
+	// Coinbase outputs mature after one block so they can be spent straight away
+	params := blockchain.RegTestParams
+	params.CoinbaseMaturity = 1
+	bc, err := blockchain.NewBlockchainWithParams(&params)
+	if err != nil {
+		t.Fatalf("NewBlockchainWithParams: %v", err)
+	}
+	w := newTestWallet(t)
+	to := newTestWallet(t)
+
+	for i := 0; i < 2; i++ {
+		if _, err := bc.MineBlock(w.Address, nil); err != nil {
+			t.Fatalf("MineBlock: %v", err)
+		}
+	}
+	prevOuts := bc.FindUTXO(w.Address)
+
+	tx, err := w.CreateTransaction(to.Address, 70*coin, 0, 0, bc, nil)
+	if err != nil {
+		t.Fatalf("CreateTransaction: %v", err)
+	}
+	if len(tx.Inputs) != 2 {
+		t.Fatalf("CreateTransaction spent %d inputs, want 2", len(tx.Inputs))
+	}
+	if bytes.Equal(tx.Inputs[0].UnlockingScript, tx.Inputs[1].UnlockingScript) {
+		t.Error("both inputs carry the same signature")
+	}
+	if !w.VerifyTransaction(tx, prevOuts) {
+		t.Error("VerifyTransaction rejected the wallet's own transaction")
+	}
+
+	// Each signature covers the value of the output it spends
+	wrongValue := slices.Clone(prevOuts)
+	wrongValue[1].Value--
+	if w.VerifyTransaction(tx, wrongValue) {
+		t.Error("VerifyTransaction accepted a signature against the wrong output value")
+	}
+
+	if _, err := bc.MineBlock(w.Address, []blockchain.Transaction{*tx}); err != nil {
+		t.Fatalf("MineBlock rejected the signed transaction: %v", err)
+	}
+	if got := bc.GetBalance(to.Address); got != 70*coin {
+		t.Errorf("recipient balance = %d, want %d", got, 70*coin)
+	}
+	if got := bc.GetBalance(w.Address); got != 80*coin {
+		t.Errorf("sender balance = %d, want change of 30 coins plus a 50 coin subsidy", got)
+	}
+}
+
+func TestSignTransactionRejectsOtherOutputs(t *testing.T) {
+	w := newTestWallet(t)
+	other := newTestWallet(t)
+
+	prevOuts := []blockchain.UTXO{
+		{OutPoint: blockchain.OutPoint{TxID: "aa", Index: 0}, Value: 30, Address: w.Address},
+		{OutPoint: blockchain.OutPoint{TxID: "bb", Index: 0}, Value: 30, Address: other.Address},
+	}
+	inputs := []blockchain.TxInput{{TxID: "aa", OutputIndex: 0}, {TxID: "bb", OutputIndex: 0}}
+	tx := blockchain.NewTransaction(inputs, []blockchain.TxOutput{{Value: 50, Address: other.Address}})
+
+	if err := w.SignTransaction(tx, prevOuts[:1]); err == nil {
+		t.Error("SignTransaction accepted fewer previous outputs than inputs")
+	}
+	if err := w.SignTransaction(tx, prevOuts); err == nil {
+		t.Error("SignTransaction signed an input spending another address's output")
+	}
+}